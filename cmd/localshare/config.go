@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newConfigCmd creates the "config" command group for managing config files
+func newConfigCmd(configFile *string) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage LocalShare configuration files",
+		// Errors here come from the files being managed, not from usage
+		SilenceUsage: true,
+	}
+
+	configCmd.AddCommand(newConfigInitCmd(), newConfigValidateCmd(configFile))
+	return configCmd
+}
+
+// newConfigInitCmd creates the "config init" command
+func newConfigInitCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "init [path]",
+		Short: "Write a commented config file template",
+		Long: `Write a config file containing every setting at its default value.
+The format follows the file extension: TOML for .toml, YAML otherwise.`,
+		Example: `  localshare config init
+  localshare config init ~/.config/localshare/config.toml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "localshare.yaml"
+			if len(args) == 1 {
+				path = args[0]
+			}
+
+			if !force {
+				if _, err := os.Stat(path); err == nil {
+					return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+				}
+			}
+
+			// The template may hold passwords once filled in
+			if err := os.WriteFile(path, []byte(config.Template(path)), 0600); err != nil {
+				return fmt.Errorf("failed to write config file: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote config template to %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing file")
+	return cmd
+}
+
+// newConfigValidateCmd creates the "config validate" command
+func newConfigValidateCmd(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file and environment for errors",
+		Long: `Load the config file (from --config, LOCALSHARE_CONFIG or the default
+search path) together with LOCALSHARE_* environment variables and check
+the result the same way the server does at startup.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := resolveConfigPath(*configFile)
+
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
+			}
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+
+			if path == "" {
+				fmt.Fprintln(cmd.OutOrStdout(), "No config file found; defaults and environment are valid")
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", path)
+			return nil
+		},
+	}
+}
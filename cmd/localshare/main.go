@@ -1,16 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/OderoCeasar/localshare/internal/config"
 	"github.com/OderoCeasar/localshare/internal/server"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func main() {
-	var cfg config.Config
+	cfg := config.Default()
+	var configFile string
+	var loader config.Loader
 
 	rootCmd := &cobra.Command{
 		Use:   "localshare",
@@ -30,34 +34,139 @@ files with teammates on the same network without cloud services.`,
   LocalShare --admin --admin-pass secret123
 
   # Custom port and directory
-  LocalShare --port 3000 --dir ~/my-shares`,
+  LocalShare --port 3000 --dir ~/my-shares
+
+  # Expose the share to S3 tools (aws s3 cp --endpoint-url http://host:9000)
+  LocalShare --s3-port 9000 --s3-access-key share --s3-secret-key secret123
+
+  # Serve the share over SFTP for headless machines (sftp -P 2222 admin@host)
+  LocalShare --sftp-port 2222 --admin --admin-pass secret123
+
+  # Load settings from a config file (flags still take precedence)
+  LocalShare --config ./localshare.yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runServer(&cfg)
+			return runServer(&cfg, loader)
 		},
+		// main reports errors itself
+		SilenceErrors: true,
 	}
 
 	// Define flags
-	rootCmd.Flags().IntVarP(&cfg.Port, "port", "p", 8080, "Port to run the server on")
-	rootCmd.Flags().StringVarP(&cfg.UploadDir, "dir", "d", "./uploads", "Directory to store uploaded files")
-	rootCmd.Flags().StringVar(&cfg.PIN, "pin", "", "Optional PIN for file access (4-6 digits)")
-	rootCmd.Flags().BoolVar(&cfg.AdminAuth, "admin", false, "Enable admin authentication for uploads")
-	rootCmd.Flags().StringVar(&cfg.AdminUser, "admin-user", "admin", "Admin username (when --admin is enabled)")
-	rootCmd.Flags().StringVar(&cfg.AdminPass, "admin-pass", "", "Admin password (required when --admin is enabled)")
-	rootCmd.Flags().Int64Var(&cfg.MaxFileSizeMB, "max-size", 500, "Maximum file size in MB")
-
-	// Add validation
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Path to a YAML or TOML config file (default: search localshare.yaml/.toml)")
+	bindFlags(rootCmd.Flags(), &cfg)
+
+	// Load config file and environment, then validate
 	rootCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		overrides := make(map[string]string)
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			if f.Name != "config" {
+				overrides[f.Name] = f.Value.String()
+			}
+		})
+
+		path := resolveConfigPath(configFile)
+		loaded, err := loadConfig(path, overrides)
+		if err != nil {
+			return err
+		}
+		cfg = *loaded
+
+		// Reloads re-read the same file and keep the command-line overrides
+		loader = func() (*config.Config, error) {
+			if path == "" {
+				return nil, errors.New("no config file to reload (start with --config)")
+			}
+			return loadConfig(path, overrides)
+		}
+
 		return cfg.Validate()
 	}
 
+	rootCmd.AddCommand(newConfigCmd(&configFile))
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func runServer(cfg *config.Config) error {
-	srv, err := server.New(cfg)
+// resolveConfigPath picks the config file from the --config flag, the
+// LOCALSHARE_CONFIG environment variable or the default search path
+func resolveConfigPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if envPath := os.Getenv(config.EnvConfigFile); envPath != "" {
+		return envPath
+	}
+	return config.FindFile()
+}
+
+// bindFlags registers the server flags on flags, writing into cfg
+func bindFlags(flags *pflag.FlagSet, cfg *config.Config) {
+	flags.IntVarP(&cfg.Port, "port", "p", cfg.Port, "Port to run the server on")
+	flags.StringVarP(&cfg.UploadDir, "dir", "d", cfg.UploadDir, "Directory to store uploaded files")
+	flags.StringVar(&cfg.PIN, "pin", cfg.PIN, "Optional PIN for file access (4-6 digits)")
+	flags.BoolVar(&cfg.AdminAuth, "admin", cfg.AdminAuth, "Enable admin authentication for uploads")
+	flags.StringVar(&cfg.AdminUser, "admin-user", cfg.AdminUser, "Admin username (when --admin is enabled)")
+	flags.StringVar(&cfg.AdminPass, "admin-pass", cfg.AdminPass, "Admin password (required when --admin is enabled)")
+	flags.Int64Var(&cfg.MaxFileSizeMB, "max-size", cfg.MaxFileSizeMB, "Maximum file size in MB")
+	flags.Int64Var(&cfg.QuotaMB, "quota", cfg.QuotaMB, "Total storage quota for shared files in MB (0 for no quota)")
+	flags.Int64Var(&cfg.MinFreeMB, "min-free", cfg.MinFreeMB, "Free disk space in MB that uploads must leave")
+	flags.BoolVar(&cfg.Dedup, "dedup", cfg.Dedup, "Store identical uploads once (--dedup=false to keep separate copies)")
+	flags.IntVar(&cfg.MaxTTLHours, "max-ttl", cfg.MaxTTLHours, "Longest expiry in hours uploaders may choose for a file (0 for no limit)")
+	flags.IntVar(&cfg.RetentionMaxAgeHours, "retention-max-age", cfg.RetentionMaxAgeHours, "Delete files older than this many hours (0 to keep them)")
+	flags.Int64Var(&cfg.RetentionMaxSizeMB, "retention-max-size", cfg.RetentionMaxSizeMB, "Delete the oldest files while the share exceeds this many MB (0 for no limit)")
+	flags.IntVar(&cfg.TrashDays, "trash-days", cfg.TrashDays, "Days deleted files stay in the trash before being purged (0 to delete immediately)")
+	flags.IntVar(&cfg.MaxVersions, "max-versions", cfg.MaxVersions, "Previous versions kept when a file is overwritten (0 to disable)")
+	flags.Int64Var(&cfg.VersionsMaxSizeMB, "versions-max-size", cfg.VersionsMaxSizeMB, "Total size in MB of kept versions before the oldest are dropped (0 for no limit)")
+	flags.BoolVar(&cfg.HashBLAKE3, "blake3", cfg.HashBLAKE3, "Compute BLAKE3 checksums in addition to SHA-256")
+	flags.BoolVar(&cfg.SearchIndex, "search-index", cfg.SearchIndex, "Index the content of text, Markdown and source files for full-text search")
+	flags.IntVar(&cfg.ArchiveMaxEntries, "archive-max-entries", cfg.ArchiveMaxEntries, "Most entries a zip or tar archive may have to be browsed")
+	flags.Int64Var(&cfg.ArchiveMaxSizeMB, "archive-max-size", cfg.ArchiveMaxSizeMB, "Most MB a zip or tar archive may expand to when browsed")
+	flags.StringVar(&cfg.WebDir, "web-dir", cfg.WebDir, "Serve the frontend from this directory instead of the embedded build")
+	flags.IntVar(&cfg.S3Port, "s3-port", cfg.S3Port, "Port for the S3-compatible API (disabled when 0)")
+	flags.StringVar(&cfg.S3Bucket, "s3-bucket", cfg.S3Bucket, "Bucket name exposed by the S3-compatible API")
+	flags.StringVar(&cfg.S3AccessKey, "s3-access-key", cfg.S3AccessKey, "Access key ID for the S3-compatible API")
+	flags.StringVar(&cfg.S3SecretKey, "s3-secret-key", cfg.S3SecretKey, "Secret access key for the S3-compatible API")
+	flags.IntVar(&cfg.SFTPPort, "sftp-port", cfg.SFTPPort, "Port for the built-in SFTP server (disabled when 0)")
+	flags.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log output format: text or json")
+	flags.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum log level: debug, info, warn or error")
+	flags.StringVar(&cfg.AccessLog, "access-log", cfg.AccessLog, "File to record every request in (disabled when empty)")
+	flags.StringVar(&cfg.AccessLogFormat, "access-log-format", cfg.AccessLogFormat, "Access log format: common, combined or json")
+	flags.IntVar(&cfg.AccessLogMaxSizeMB, "access-log-max-size", cfg.AccessLogMaxSizeMB, "Rotate the access log when it exceeds this size in MB (0 to disable)")
+	flags.IntVar(&cfg.AccessLogRotateHours, "access-log-rotate-hours", cfg.AccessLogRotateHours, "Rotate the access log after this many hours (0 to disable)")
+	flags.IntVar(&cfg.AccessLogMaxBackups, "access-log-max-backups", cfg.AccessLogMaxBackups, "Number of rotated access logs to keep (0 to keep all)")
+	flags.BoolVar(&cfg.AccessLogCompress, "access-log-compress", cfg.AccessLogCompress, "Gzip rotated access logs")
+	flags.StringVar(&cfg.MetricsToken, "metrics-token", cfg.MetricsToken, "Bearer token required to scrape /metrics")
+	flags.Int64Var(&cfg.HealthMinFreeMB, "health-min-free", cfg.HealthMinFreeMB, "Report not ready when free disk space falls below this many MB")
+}
+
+// loadConfig builds a configuration from defaults, the config file at path
+// and environment variables, then applies the flags given on the command
+// line so that they take precedence over everything else
+func loadConfig(path string, overrides map[string]string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := pflag.NewFlagSet("overrides", pflag.ContinueOnError)
+	bindFlags(flags, &cfg)
+	for name, value := range overrides {
+		if err := flags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value for --%s: %w", name, err)
+		}
+		if key := cfg.KeyOf(flags.Lookup(name).Value); key != "" {
+			cfg.SetOverride(key, "--"+name)
+		}
+	}
+
+	return &cfg, nil
+}
+
+func runServer(cfg *config.Config, loader config.Loader) error {
+	srv, err := server.New(cfg, loader)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		env       map[string]string
+		flags     map[string]string
+		wantPIN   string
+		wantSize  int64
+		wantAdmin bool
+		overrides map[string]string
+		wantErr   string
+	}{
+		{
+			name:     "file",
+			file:     "pin: \"1111\"\nmax_file_size_mb: 100\n",
+			wantPIN:  "1111",
+			wantSize: 100,
+		},
+		{
+			name:      "environment over file",
+			file:      "pin: \"1111\"\nmax_file_size_mb: 100\n",
+			env:       map[string]string{"LOCALSHARE_PIN": "2222"},
+			wantPIN:   "2222",
+			wantSize:  100,
+			overrides: map[string]string{"pin": "LOCALSHARE_PIN"},
+		},
+		{
+			name:      "flags over environment and file",
+			file:      "pin: \"1111\"\nmax_file_size_mb: 100\n",
+			env:       map[string]string{"LOCALSHARE_PIN": "2222", "LOCALSHARE_MAX_FILE_SIZE_MB": "200"},
+			flags:     map[string]string{"pin": "3333"},
+			wantPIN:   "3333",
+			wantSize:  200,
+			overrides: map[string]string{"pin": "--pin", "max_file_size_mb": "LOCALSHARE_MAX_FILE_SIZE_MB"},
+		},
+		{
+			name:      "flag names differ from keys",
+			flags:     map[string]string{"max-size": "50", "admin": "true", "admin-pass": "secret123"},
+			wantSize:  50,
+			wantAdmin: true,
+			overrides: map[string]string{"max_file_size_mb": "--max-size", "admin_auth": "--admin", "admin_pass": "--admin-pass"},
+		},
+		{
+			name:    "invalid flag value",
+			flags:   map[string]string{"max-size": "lots"},
+			wantErr: "invalid value for --max-size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "localshare.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := loadConfig(path, tt.flags)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+
+			wantSize := tt.wantSize
+			if wantSize == 0 {
+				wantSize = 500
+			}
+			if cfg.PIN != tt.wantPIN || cfg.MaxFileSizeMB != wantSize || cfg.AdminAuth != tt.wantAdmin {
+				t.Errorf("got pin %q, max size %d, admin %v; want %q, %d, %v",
+					cfg.PIN, cfg.MaxFileSizeMB, cfg.AdminAuth, tt.wantPIN, wantSize, tt.wantAdmin)
+			}
+			if len(cfg.Overrides) != len(tt.overrides) {
+				t.Errorf("Overrides = %v, want %v", cfg.Overrides, tt.overrides)
+			}
+			for key, source := range tt.overrides {
+				if cfg.Overrides[key] != source {
+					t.Errorf("Overrides[%q] = %q, want %q", key, cfg.Overrides[key], source)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package accesslog
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueSize is how many entries may wait for the disk before new ones are dropped
+const queueSize = 4096
+
+// Options configures an access log
+type Options struct {
+	Path           string
+	Format         string
+	MaxSizeMB      int
+	RotateInterval time.Duration
+	MaxBackups     int
+	Compress       bool
+}
+
+// Logger writes access log entries from a background goroutine so that a
+// slow disk never delays request handling. If the queue fills up, entries
+// are dropped and counted rather than blocking the caller.
+type Logger struct {
+	format  string
+	file    *rotatingFile
+	entries chan Entry
+	dropped atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New opens the access log file and starts the background writer
+func New(opts Options) (*Logger, error) {
+	file := &rotatingFile{
+		path:       opts.Path,
+		maxSize:    int64(opts.MaxSizeMB) * 1024 * 1024,
+		interval:   opts.RotateInterval,
+		maxBackups: opts.MaxBackups,
+		compress:   opts.Compress,
+	}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		format:  opts.Format,
+		file:    file,
+		entries: make(chan Entry, queueSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+
+	return l, nil
+}
+
+// Log queues an entry without blocking
+func (l *Logger) Log(e Entry) {
+	select {
+	case l.entries <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many entries were discarded because the queue was full
+func (l *Logger) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close flushes queued entries and closes the file
+func (l *Logger) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.entries)
+	})
+	<-l.done
+	return l.file.Close()
+}
+
+// run writes queued entries until the logger is closed
+func (l *Logger) run() {
+	defer close(l.done)
+
+	var reportedDrops int64
+	for e := range l.entries {
+		if _, err := l.file.Write(formatEntry(l.format, e)); err != nil {
+			slog.Error("access log write failed", slog.String("error", err.Error()))
+		}
+
+		if dropped := l.dropped.Load(); dropped > reportedDrops {
+			slog.Warn("access log entries dropped", slog.Int64("count", dropped-reportedDrops))
+			reportedDrops = dropped
+		}
+	}
+}
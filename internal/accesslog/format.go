@@ -0,0 +1,114 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+// clfTimeFormat is the timestamp layout used by Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Entry is one completed request
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	ClientIP  string        `json:"clientIp"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method"`
+	URI       string        `json:"uri"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"userAgent,omitempty"`
+	Latency   time.Duration `json:"-"`
+	RequestID string        `json:"requestId,omitempty"`
+}
+
+// ValidFormat reports whether format names a supported output format
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatCommon, FormatCombined, FormatJSON:
+		return true
+	}
+	return false
+}
+
+// formatEntry renders e as a single line, including the trailing newline
+func formatEntry(format string, e Entry) []byte {
+	switch format {
+	case FormatJSON:
+		line, err := json.Marshal(struct {
+			Entry
+			LatencyMS float64 `json:"latencyMs"`
+		}{e, float64(e.Latency.Microseconds()) / 1000})
+		if err != nil {
+			return nil
+		}
+		return append(line, '\n')
+	case FormatCommon:
+		return []byte(commonLine(e) + "\n")
+	default:
+		return []byte(fmt.Sprintf("%s %s %s\n", commonLine(e), quote(e.Referer), quote(e.UserAgent)))
+	}
+}
+
+// commonLine renders the Common Log Format fields:
+//
+//	host ident authuser [date] "request" status bytes
+func commonLine(e Entry) string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %s %d %s",
+		dash(e.ClientIP),
+		dash(escape(e.User)),
+		e.Time.Format(clfTimeFormat),
+		quote(e.Method+" "+e.URI+" "+e.Proto),
+		e.Status,
+		bytes,
+	)
+}
+
+// quote wraps s in double quotes, escaping characters that would break the line
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return `"` + escape(s) + `"`
+}
+
+// escape backslash-escapes quotes and replaces control characters
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
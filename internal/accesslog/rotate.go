@@ -0,0 +1,164 @@
+package accesslog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into rotated file names
+const backupTimeFormat = "20060102-150405"
+
+// rotatingFile is an append-only log file that is rotated when it grows past
+// maxSize bytes or has been open longer than interval. Rotated files are
+// renamed to <name>-<timestamp><ext>, optionally gzipped, and only the
+// newest maxBackups are kept. It is not safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	compress   bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// open opens (or creates) the active log file for appending
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("failed to create access log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends p, rotating first if the limits would be exceeded
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	sizeExceeded := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	intervalElapsed := f.interval > 0 && f.size > 0 && time.Since(f.opened) >= f.interval
+	if sizeExceeded || intervalElapsed {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the active log file
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate moves the active file aside, starts a new one and prunes old backups
+func (f *rotatingFile) rotate() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().Format(backupTimeFormat), ext)
+	if err := os.Rename(f.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate access log: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if f.compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+
+	return f.prune()
+}
+
+// prune removes the oldest backups beyond maxBackups
+func (f *rotatingFile) prune() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(f.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return err
+	}
+
+	// Timestamped names sort chronologically
+	sort.Strings(matches)
+	for len(matches) > f.maxBackups {
+		os.Remove(matches[0])
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to compress access log: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to compress access log: %w", err)
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(out.Name())
+		return fmt.Errorf("failed to compress access log: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return fmt.Errorf("failed to compress access log: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to compress access log: %w", err)
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
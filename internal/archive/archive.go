@@ -0,0 +1,335 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// Archive formats that can be read
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+var (
+	// ErrUnsupported is returned for files that are not zip or tar archives
+	ErrUnsupported = errors.New("only zip, tar and tar.gz archives are supported")
+
+	// ErrTooManyEntries is returned for archives with more entries than allowed
+	ErrTooManyEntries = errors.New("archive has too many entries")
+
+	// ErrTooLarge is returned when an archive expands to more than allowed
+	ErrTooLarge = errors.New("archive expands to more than the size limit")
+
+	// ErrFormat is returned for archives that are corrupt or not in the
+	// format their name suggests
+	ErrFormat = errors.New("malformed archive")
+
+	// ErrUnsafeName is returned for entry names that are absolute or would
+	// land outside the directory the archive is extracted to
+	ErrUnsafeName = errors.New("unsafe entry name")
+
+	// errStop ends a walk early without an error
+	errStop = errors.New("stop")
+)
+
+// Type is the kind of an archive entry
+type Type int
+
+// Kinds of archive entries. Only files and directories are ever read or
+// extracted.
+const (
+	TypeFile Type = iota
+	TypeDir
+	TypeSymlink
+	// TypeHardlink entries refer to another entry of the archive by name
+	TypeHardlink
+	TypeOther
+)
+
+// Entry describes one entry of an archive
+type Entry struct {
+	// Name is the cleaned, slash-separated path of the entry, or its name as
+	// stored if Unsafe
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Type    Type
+	// Unsafe is set for entries whose names escape the archive's root
+	Unsafe bool
+}
+
+// Limits bound what reading an archive may cost, against decompression
+// bombs
+type Limits struct {
+	// MaxEntries is the most entries an archive may have
+	MaxEntries int
+	// MaxSize is the most bytes an archive may expand to
+	MaxSize int64
+}
+
+// Detect returns the format of the named archive, judging by its extension,
+// or an empty string if it is not a supported archive
+func Detect(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz
+	default:
+		return ""
+	}
+}
+
+// CleanName turns an entry name into a clean relative slash-separated path.
+// Backslashes are taken as separators, as some zip tools write them. Names
+// that are absolute, climb out with "..", or use the reserved state
+// directory name are unsafe.
+func CleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", ErrUnsafeName
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrUnsafeName
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == fileutil.StateDirName {
+			return "", ErrUnsafeName
+		}
+	}
+	return cleaned, nil
+}
+
+// TrimExt returns name without its archive extension
+func TrimExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// Walk calls fn for every entry of the archive at filePath, which is in
+// format, in the order they are stored. For files, r reads the entry's
+// content; fn may leave it unread. Walking stops at the first error fn
+// returns. Walk fails with ErrTooManyEntries or ErrTooLarge once the archive
+// exceeds limits.
+func Walk(filePath, format string, limits Limits, fn func(e Entry, r io.Reader) error) error {
+	var err error
+	switch format {
+	case FormatZip:
+		err = walkZip(filePath, limits, fn)
+	case FormatTar:
+		err = walkTar(filePath, false, limits, fn)
+	case FormatTarGz:
+		err = walkTar(filePath, true, limits, fn)
+	default:
+		err = ErrUnsupported
+	}
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
+
+// Open calls fn with the content of the named file entry, reporting
+// fs.ErrNotExist if the archive has no such file
+func Open(filePath, format, name string, limits Limits, fn func(e Entry, r io.Reader) error) error {
+	found := false
+	err := Walk(filePath, format, limits, func(e Entry, r io.Reader) error {
+		if e.Unsafe || e.Type != TypeFile || e.Name != name {
+			return nil
+		}
+		if e.Size > limits.MaxSize {
+			return ErrTooLarge
+		}
+		found = true
+		if err := fn(e, r); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err == nil && !found {
+		return fs.ErrNotExist
+	}
+	return err
+}
+
+// walkZip walks a zip archive. Its directory lists every entry with its
+// size up front, and reading an entry fails if it expands past that size.
+func walkZip(filePath string, limits Limits, fn func(e Entry, r io.Reader) error) error {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer zr.Close()
+
+	if len(zr.File) > limits.MaxEntries {
+		return ErrTooManyEntries
+	}
+
+	var total int64
+	for _, f := range zr.File {
+		e := newEntry(f.Name, int64(f.UncompressedSize64), f.Modified, f.Mode())
+		if e.Type != TypeFile {
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		total += e.Size
+		if f.UncompressedSize64 > uint64(limits.MaxSize) || total > limits.MaxSize {
+			return ErrTooLarge
+		}
+		if err := walkZipFile(f, e, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZipFile calls fn with the content of one zip entry
+func walkZipFile(f *zip.File, e Entry, fn func(e Entry, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer rc.Close()
+	return fn(e, &entryReader{r: rc})
+}
+
+// walkTar walks a tar archive, gzip-compressed if compressed. Entries can
+// only be found by reading through the archive, so everything decompressed
+// counts towards limits.MaxSize.
+func walkTar(filePath string, compressed bool, limits Limits, fn func(e Entry, r io.Reader) error) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(&cappedReader{r: r, remaining: limits.MaxSize})
+	for count := 0; ; count++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrTooLarge) {
+				return ErrTooLarge
+			}
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		if count >= limits.MaxEntries {
+			return ErrTooManyEntries
+		}
+
+		e := newEntry(hdr.Name, hdr.Size, hdr.ModTime, hdr.FileInfo().Mode())
+		if hdr.Typeflag == tar.TypeLink {
+			e.Type = TypeHardlink
+		}
+		var content io.Reader
+		if e.Type == TypeFile {
+			content = &entryReader{r: tr}
+		} else {
+			e.Size = 0
+		}
+		if err := fn(e, content); err != nil {
+			return err
+		}
+	}
+}
+
+// newEntry describes an entry from its stored name and mode
+func newEntry(name string, size int64, modTime time.Time, mode fs.FileMode) Entry {
+	e := Entry{Name: name, Size: size, ModTime: modTime}
+	switch {
+	case mode.IsRegular():
+		e.Type = TypeFile
+	case mode.IsDir():
+		e.Type = TypeDir
+		e.Size = 0
+	case mode&fs.ModeSymlink != 0:
+		// A zip symlink's content is its target, which is never read
+		e.Type = TypeSymlink
+		e.Size = 0
+	default:
+		e.Type = TypeOther
+	}
+
+	cleaned, err := CleanName(name)
+	if err != nil {
+		e.Unsafe = true
+	} else {
+		e.Name = cleaned
+	}
+	return e
+}
+
+// entryReader reads an entry's content, reporting corrupt data as ErrFormat
+// so it can be told apart from failures to store what was read
+type entryReader struct {
+	r io.Reader
+}
+
+func (e *entryReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, ErrTooLarge) {
+		err = fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	return n, err
+}
+
+// cappedReader fails with ErrTooLarge once more than remaining bytes are
+// read through it
+type cappedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > c.remaining+1 {
+		p = p[:c.remaining+1]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,352 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntry is an entry to write into a test archive
+type testEntry struct {
+	name    string
+	content string
+	mode    fs.FileMode
+	// link is the target of symlinks and hard links
+	link     string
+	hardlink bool
+}
+
+var testLimits = Limits{MaxEntries: 100, MaxSize: 1 << 20}
+
+// writeZip writes entries into a new zip archive and returns its path
+func writeZip(t *testing.T, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := e.content
+		if mode&fs.ModeSymlink != 0 {
+			content = e.link
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeTemp(t, "test.zip", buf.Bytes())
+}
+
+// writeTar writes entries into a new tar archive, gzip-compressed if
+// compressed, and returns its path
+func writeTar(t *testing.T, entries []testEntry, compressed bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compressed {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		switch {
+		case e.hardlink:
+			hdr.Typeflag, hdr.Linkname = tar.TypeLink, e.link
+		case e.mode&fs.ModeSymlink != 0:
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.link
+		case e.mode&fs.ModeNamedPipe != 0:
+			hdr.Typeflag = tar.TypeFifo
+		case e.mode.IsDir():
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		default:
+			hdr.Typeflag, hdr.Size = tar.TypeReg, int64(len(e.content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.WriteString(tw, e.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := "test.tar"
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		name = "test.tar.gz"
+	}
+	return writeTemp(t, name, buf.Bytes())
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeArchive writes entries into a new archive in format
+func writeArchive(t *testing.T, format string, entries []testEntry) string {
+	t.Helper()
+	switch format {
+	case FormatZip:
+		return writeZip(t, entries)
+	case FormatTar:
+		return writeTar(t, entries, false)
+	default:
+		return writeTar(t, entries, true)
+	}
+}
+
+var formats = []string{FormatZip, FormatTar, FormatTarGz}
+
+func TestDetect(t *testing.T) {
+	tests := map[string]string{
+		"a.zip":        FormatZip,
+		"A.ZIP":        FormatZip,
+		"a.tar":        FormatTar,
+		"a.tar.gz":     FormatTarGz,
+		"a.tgz":        FormatTarGz,
+		"a.gz":         "",
+		"zip":          "",
+		"notes.zip.md": "",
+	}
+	for name, want := range tests {
+		if got := Detect(name); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "a.txt", want: "a.txt"},
+		{name: "dir/", want: "dir"},
+		{name: "./dir//b.txt", want: "dir/b.txt"},
+		{name: "dir\\b.txt", want: "dir/b.txt"},
+		{name: "dir/../b.txt", want: "b.txt"},
+		{name: "", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../evil.txt", wantErr: true},
+		{name: "dir/../../evil.txt", wantErr: true},
+		{name: "..\\evil.txt", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "\\evil.txt", wantErr: true},
+		{name: "C:/evil.txt", wantErr: true},
+		{name: "c:evil.txt", wantErr: true},
+		{name: "nul\x00.txt", wantErr: true},
+		{name: ".localshare/trash/x", wantErr: true},
+		{name: "dir/.localshare", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := CleanName(tt.name)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnsafeName) {
+				t.Errorf("CleanName(%q) = %q, %v; want ErrUnsafeName", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CleanName(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTrimExt(t *testing.T) {
+	tests := map[string]string{
+		"site.zip":    "site",
+		"site.TAR.GZ": "site",
+		"site.tgz":    "site",
+		"site.tar":    "site",
+		"site":        "site",
+	}
+	for name, want := range tests {
+		if got := TrimExt(name); got != want {
+			t.Errorf("TrimExt(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	entries := []testEntry{
+		{name: "dir/", mode: fs.ModeDir | 0755},
+		{name: "dir/a.txt", content: "hello"},
+		{name: "../evil.txt", content: "evil"},
+		{name: "link", mode: fs.ModeSymlink | 0777, link: "/etc/passwd"},
+	}
+
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			path := writeArchive(t, format, entries)
+
+			var got []Entry
+			contents := make(map[string]string)
+			err := Walk(path, format, testLimits, func(e Entry, r io.Reader) error {
+				got = append(got, e)
+				if r != nil {
+					data, err := io.ReadAll(r)
+					if err != nil {
+						return err
+					}
+					contents[e.Name] = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Walk: %v", err)
+			}
+
+			want := []Entry{
+				{Name: "dir", Type: TypeDir},
+				{Name: "dir/a.txt", Size: 5, Type: TypeFile},
+				{Name: "../evil.txt", Size: 4, Type: TypeFile, Unsafe: true},
+				{Name: "link", Type: TypeSymlink},
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range want {
+				g := got[i]
+				if g.Name != want[i].Name || g.Size != want[i].Size || g.Type != want[i].Type || g.Unsafe != want[i].Unsafe {
+					t.Errorf("entry %d = %+v, want %+v", i, g, want[i])
+				}
+			}
+			if contents["dir/a.txt"] != "hello" {
+				t.Errorf("content of dir/a.txt = %q, want %q", contents["dir/a.txt"], "hello")
+			}
+		})
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	many := make([]testEntry, 11)
+	for i := range many {
+		many[i] = testEntry{name: strings.Repeat("f", i+1), content: "x"}
+	}
+	// Highly compressible, so the archive itself is small
+	bomb := []testEntry{{name: "bomb.txt", content: strings.Repeat("0", 64<<10)}}
+	spread := []testEntry{
+		{name: "a.txt", content: strings.Repeat("a", 600)},
+		{name: "b.txt", content: strings.Repeat("b", 600)},
+	}
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		wantErr error
+	}{
+		{name: "within limits", entries: spread, limits: Limits{MaxEntries: 2, MaxSize: 4096}},
+		{name: "too many entries", entries: many, limits: Limits{MaxEntries: 10, MaxSize: 1 << 20}, wantErr: ErrTooManyEntries},
+		{name: "one file too large", entries: bomb, limits: Limits{MaxEntries: 10, MaxSize: 1 << 10}, wantErr: ErrTooLarge},
+		{name: "total too large", entries: spread, limits: Limits{MaxEntries: 10, MaxSize: 1000}, wantErr: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		for _, format := range formats {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				path := writeArchive(t, format, tt.entries)
+				err := Walk(path, format, tt.limits, func(e Entry, r io.Reader) error {
+					if r != nil {
+						_, err := io.Copy(io.Discard, r)
+						return err
+					}
+					return nil
+				})
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Walk error = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkMalformed(t *testing.T) {
+	path := writeTemp(t, "broken.zip", []byte("not an archive"))
+	for _, format := range formats {
+		err := Walk(path, format, testLimits, func(Entry, io.Reader) error { return nil })
+		if !errors.Is(err, ErrFormat) {
+			t.Errorf("Walk(%s) error = %v, want ErrFormat", format, err)
+		}
+	}
+	if err := Walk(path, "rar", testLimits, nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Walk(rar) error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	entries := []testEntry{
+		{name: "a.txt", content: "first"},
+		{name: "../a.txt", content: "evil"},
+		{name: "big.txt", content: strings.Repeat("b", 2048)},
+		{name: "link", mode: fs.ModeSymlink | 0777, link: "a.txt"},
+	}
+
+	tests := []struct {
+		name    string
+		entry   string
+		limits  Limits
+		want    string
+		wantErr error
+	}{
+		{name: "file", entry: "a.txt", limits: testLimits, want: "first"},
+		{name: "missing", entry: "b.txt", limits: testLimits, wantErr: fs.ErrNotExist},
+		{name: "unsafe name", entry: "../a.txt", limits: testLimits, wantErr: fs.ErrNotExist},
+		{name: "symlink", entry: "link", limits: testLimits, wantErr: fs.ErrNotExist},
+		{name: "too large", entry: "big.txt", limits: Limits{MaxEntries: 10, MaxSize: 1024}, wantErr: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		for _, format := range formats {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				path := writeArchive(t, format, entries)
+				var got string
+				err := Open(path, format, tt.entry, tt.limits, func(e Entry, r io.Reader) error {
+					data, err := io.ReadAll(r)
+					got = string(data)
+					return err
+				})
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open error = %v, want %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("Open read %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrLink is returned for archives containing symbolic or hard links,
+	// which could point extracted files outside their directory
+	ErrLink = errors.New("archive contains a link")
+
+	// ErrSpecialFile is returned for archives containing devices, pipes and
+	// other entries that are neither files nor directories
+	ErrSpecialFile = errors.New("archive contains a special file")
+
+	// ErrFileTooLarge is returned for archives containing a file over the
+	// maximum file size
+	ErrFileTooLarge = errors.New("archive contains a file over the maximum file size")
+)
+
+// ExtractOptions controls what Extract accepts and how it writes files
+type ExtractOptions struct {
+	Limits
+	// MaxFileSize is the largest file that may be extracted
+	MaxFileSize int64
+	// Wrap, if set, wraps the writer of every extracted file, for instance
+	// to enforce a storage quota
+	Wrap func(w io.Writer) io.Writer
+}
+
+// Summary counts what was extracted from an archive
+type Summary struct {
+	Files int
+	Dirs  int
+	Bytes int64
+}
+
+// Extract unpacks the archive at filePath, which is in format, into dir.
+// The whole archive is refused at the first entry with an unsafe name, a
+// link or a special file, so dir should be a fresh directory that is
+// discarded if extraction fails.
+func Extract(filePath, format, dir string, opts ExtractOptions) (Summary, error) {
+	var sum Summary
+	err := Walk(filePath, format, opts.Limits, func(e Entry, r io.Reader) error {
+		switch {
+		case e.Unsafe:
+			return fmt.Errorf("%w: %s", ErrUnsafeName, e.Name)
+		case e.Type == TypeSymlink || e.Type == TypeHardlink:
+			return fmt.Errorf("%w: %s", ErrLink, e.Name)
+		case e.Type == TypeOther:
+			return fmt.Errorf("%w: %s", ErrSpecialFile, e.Name)
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(e.Name))
+		if e.Type == TypeDir {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			sum.Dirs++
+			return nil
+		}
+
+		if e.Size > opts.MaxFileSize {
+			return fmt.Errorf("%w: %s", ErrFileTooLarge, e.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		written, err := extractFile(dst, r, e.ModTime, opts)
+		if err != nil {
+			return err
+		}
+		sum.Files++
+		sum.Bytes += written
+		return nil
+	})
+	return sum, err
+}
+
+// extractFile writes one entry's content to dst. The entry's recorded size
+// is checked up front; the limit here catches content that is longer.
+func extractFile(dst string, r io.Reader, modTime time.Time, opts ExtractOptions) (int64, error) {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	var w io.Writer = f
+	if opts.Wrap != nil {
+		w = opts.Wrap(f)
+	}
+	written, err := io.Copy(w, io.LimitReader(r, opts.MaxFileSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if written > opts.MaxFileSize {
+		return 0, fmt.Errorf("%w: %s", ErrFileTooLarge, filepath.Base(dst))
+	}
+
+	if !modTime.IsZero() {
+		// The modification time is a nicety; the content is what matters
+		os.Chtimes(dst, time.Time{}, modTime)
+	}
+	return written, nil
+}
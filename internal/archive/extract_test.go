@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// limitedWriter fails once more than n bytes are written, as a quota would
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+var errQuota = errors.New("quota exceeded")
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errQuota
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
+
+func TestExtract(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			path := writeArchive(t, format, []testEntry{
+				{name: "site/", mode: fs.ModeDir | 0755},
+				{name: "site/index.html", content: "<h1>hi</h1>"},
+				{name: "site/css/app.css", content: "body{}"},
+			})
+			dir := t.TempDir()
+
+			sum, err := Extract(path, format, dir, ExtractOptions{Limits: testLimits, MaxFileSize: 1024})
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if sum.Files != 2 || sum.Dirs != 1 || sum.Bytes != 17 {
+				t.Errorf("summary = %+v, want 2 files, 1 dir, 17 bytes", sum)
+			}
+			for name, want := range map[string]string{"site/index.html": "<h1>hi</h1>", "site/css/app.css": "body{}"} {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil || string(data) != want {
+					t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		opts    ExtractOptions
+		// formats limits the case to some formats, as zip cannot store
+		// hard links or pipes
+		formats []string
+		wantErr error
+	}{
+		{
+			name:    "parent traversal",
+			entries: []testEntry{{name: "ok.txt", content: "ok"}, {name: "../../evil.txt", content: "evil"}},
+			wantErr: ErrUnsafeName,
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/tmp/evil.txt", content: "evil"}},
+			wantErr: ErrUnsafeName,
+		},
+		{
+			name:    "state directory",
+			entries: []testEntry{{name: ".localshare/versions/index.json", content: "{}"}},
+			wantErr: ErrUnsafeName,
+		},
+		{
+			name:    "symlink",
+			entries: []testEntry{{name: "passwd", mode: fs.ModeSymlink | 0777, link: "/etc/passwd"}},
+			wantErr: ErrLink,
+		},
+		{
+			name:    "symlink then file through it",
+			entries: []testEntry{{name: "out", mode: fs.ModeSymlink | 0777, link: "/tmp"}, {name: "out/evil.txt", content: "evil"}},
+			wantErr: ErrLink,
+		},
+		{
+			name:    "hard link",
+			entries: []testEntry{{name: "shadow", hardlink: true, link: "/etc/shadow"}},
+			formats: []string{FormatTar, FormatTarGz},
+			wantErr: ErrLink,
+		},
+		{
+			name:    "named pipe",
+			entries: []testEntry{{name: "fifo", mode: fs.ModeNamedPipe | 0644}},
+			formats: []string{FormatTar, FormatTarGz},
+			wantErr: ErrSpecialFile,
+		},
+		{
+			name:    "file over the maximum file size",
+			entries: []testEntry{{name: "big.bin", content: strings.Repeat("x", 2048)}},
+			opts:    ExtractOptions{Limits: testLimits, MaxFileSize: 1024},
+			wantErr: ErrFileTooLarge,
+		},
+		{
+			name:    "archive over the size limit",
+			entries: []testEntry{{name: "a.bin", content: strings.Repeat("a", 800)}, {name: "b.bin", content: strings.Repeat("b", 800)}},
+			opts:    ExtractOptions{Limits: Limits{MaxEntries: 10, MaxSize: 1024}, MaxFileSize: 1024},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "quota",
+			entries: []testEntry{{name: "a.bin", content: strings.Repeat("a", 800)}},
+			opts: ExtractOptions{Limits: testLimits, MaxFileSize: 1024, Wrap: func(w io.Writer) io.Writer {
+				return &limitedWriter{w: w, n: 100}
+			}},
+			wantErr: errQuota,
+		},
+	}
+
+	for _, tt := range tests {
+		fmts := tt.formats
+		if fmts == nil {
+			fmts = formats
+		}
+		for _, format := range fmts {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				opts := tt.opts
+				if opts.MaxEntries == 0 {
+					opts = ExtractOptions{Limits: testLimits, MaxFileSize: 1 << 20}
+				}
+				path := writeArchive(t, format, tt.entries)
+				root := t.TempDir()
+				dir := filepath.Join(root, "out", "extract")
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err := Extract(path, format, dir, opts)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Extract error = %v, want %v", err, tt.wantErr)
+				}
+
+				// Nothing may have been written outside the target directory
+				filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+					if err == nil && !d.IsDir() && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+						t.Errorf("extraction wrote %s outside its directory", p)
+					}
+					if err == nil && d.Type()&fs.ModeSymlink != 0 {
+						t.Errorf("extraction created the link %s", p)
+					}
+					return nil
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+)
+
+// Actions recorded in the audit trail
+const (
+	ActionUpload      = "upload"
+	ActionDownload    = "download"
+	ActionDelete      = "delete"
+	ActionRename      = "rename"
+	ActionExpire      = "expire"
+	ActionRestore     = "restore"
+	ActionPurge       = "purge"
+	ActionEdit        = "edit"
+	ActionExtract     = "extract"
+	ActionLogin       = "login"
+	ActionLoginFailed = "login_failed"
+)
+
+// Protocols an action can arrive through
+const (
+	ProtocolHTTP = "http"
+	ProtocolS3   = "s3"
+	ProtocolSFTP = "sftp"
+)
+
+// FileName is the audit trail's file inside the state directory
+const FileName = "audit.jsonl"
+
+// maxLineSize bounds a single event line when reading the trail back
+const maxLineSize = 64 * 1024
+
+// ValidAction reports whether action names a recorded action
+func ValidAction(action string) bool {
+	switch action {
+	case ActionUpload, ActionDownload, ActionDelete, ActionRename, ActionExpire, ActionRestore, ActionPurge, ActionEdit, ActionExtract, ActionLogin, ActionLoginFailed:
+		return true
+	}
+	return false
+}
+
+// Log is an append-only audit trail stored as one JSON event per line.
+// Existing lines are never rewritten, so the file can be shipped or
+// inspected with standard tools while the server is running.
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens (or creates) the audit trail at path
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Record appends an event, stamping the current time if none is set.
+// Failures are logged rather than returned so that auditing never fails
+// the operation being audited. A nil Log records nothing.
+func (l *Log) Record(e models.AuditEvent) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		slog.Error("audit log write failed", slog.String("action", e.Action), slog.String("error", err.Error()))
+	}
+}
+
+// Close closes the audit trail
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Filter selects events from the audit trail. Zero values match everything.
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Actions []string
+	Limit   int
+}
+
+// matches reports whether e passes the filter
+func (f Filter) matches(e models.AuditEvent) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if len(f.Actions) == 0 {
+		return true
+	}
+	for _, action := range f.Actions {
+		if e.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the matching events, newest first. When more than
+// f.Limit events match, only the newest f.Limit are returned and
+// truncated is true.
+func (l *Log) Query(f Filter) (events []models.AuditEvent, truncated bool, err error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	for scanner.Scan() {
+		var e models.AuditEvent
+		// Skip lines that cannot be decoded, such as a write in progress
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !f.matches(e) {
+			continue
+		}
+
+		events = append(events, e)
+		if f.Limit > 0 && len(events) > f.Limit {
+			events = events[1:]
+			truncated = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	// The file is in chronological order; callers want the newest first
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, truncated, nil
+}
+
+// WriteCSV writes events as CSV with a header row
+func WriteCSV(w io.Writer, events []models.AuditEvent) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "action", "protocol", "actor", "client_ip", "filename", "target", "size", "sha256"})
+	for _, e := range events {
+		cw.Write([]string{
+			e.Time.Format(time.RFC3339),
+			e.Action,
+			e.Protocol,
+			csvSafe(e.Actor),
+			e.ClientIP,
+			csvSafe(e.Filename),
+			csvSafe(e.Target),
+			strconv.FormatInt(e.Size, 10),
+			e.SHA256,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe neutralizes values that spreadsheet applications would evaluate
+// as formulas, since file names and usernames are user-controlled
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
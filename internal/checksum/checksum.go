@@ -0,0 +1,244 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"lukechampine.com/blake3"
+)
+
+// FileName is the checksum index's file inside the state directory
+const FileName = "checksums.json"
+
+// ErrMismatch is returned when content does not match an expected checksum
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Sums holds the checksums of a file's content as lowercase hex
+type Sums struct {
+	SHA256 string `json:"sha256"`
+	BLAKE3 string `json:"blake3,omitempty"`
+	// MD5 is only known for objects put over S3, whose ETag it is: the MD5
+	// of the content, or for multipart uploads the MD5 of the parts' MD5s
+	// followed by the number of parts
+	MD5 string `json:"md5,omitempty"`
+}
+
+// Verify compares the sums against expected values, ignoring empty ones
+func (s Sums) Verify(sha256Sum, blake3Sum string) error {
+	if sha256Sum != "" && !strings.EqualFold(sha256Sum, s.SHA256) {
+		return fmt.Errorf("%w: expected SHA-256 %s, got %s", ErrMismatch, strings.ToLower(sha256Sum), s.SHA256)
+	}
+	if blake3Sum != "" && !strings.EqualFold(blake3Sum, s.BLAKE3) {
+		return fmt.Errorf("%w: expected BLAKE3 %s, got %s", ErrMismatch, strings.ToLower(blake3Sum), s.BLAKE3)
+	}
+	return nil
+}
+
+// Hasher computes checksums of data as it is written
+type Hasher struct {
+	sha256 hash.Hash
+	blake3 hash.Hash
+}
+
+// NewHasher creates a hasher computing SHA-256 and, if withBLAKE3 is set, BLAKE3
+func NewHasher(withBLAKE3 bool) *Hasher {
+	h := &Hasher{sha256: sha256.New()}
+	if withBLAKE3 {
+		h.blake3 = blake3.New(32, nil)
+	}
+	return h
+}
+
+// Write adds p to every checksum
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.blake3 != nil {
+		h.blake3.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sums returns the checksums of everything written so far
+func (h *Hasher) Sums() Sums {
+	sums := Sums{SHA256: hex.EncodeToString(h.sha256.Sum(nil))}
+	if h.blake3 != nil {
+		sums.BLAKE3 = hex.EncodeToString(h.blake3.Sum(nil))
+	}
+	return sums
+}
+
+// entry is the checksums recorded for one file. Size and ModTime identify
+// the content they were computed from; once the file changes, by any
+// protocol or directly on disk, the entry no longer applies.
+type entry struct {
+	Sums
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Store keeps the checksums of shared files, persisted as a JSON object
+// keyed by file name
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// Open loads the checksum index at path, starting empty if it does not exist
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksum index: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse checksum index: %w", err)
+	}
+	return s, nil
+}
+
+// Get returns the recorded checksums of the file described by info, if
+// they still match its content
+func (s *Store) Get(info os.FileInfo) (Sums, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[info.Name()]
+	if !ok || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return Sums{}, false
+	}
+	return e.Sums, true
+}
+
+// Set records the checksums of the file at filePath
+func (s *Store) Set(filePath string, sums Sums) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[info.Name()] = entry{Sums: sums, Size: info.Size(), ModTime: info.ModTime().UTC()}
+	return s.save()
+}
+
+// Remove forgets the checksums recorded for the named file
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[name]; !ok {
+		return nil
+	}
+	delete(s.entries, name)
+	return s.save()
+}
+
+// Rename moves the checksums recorded for oldName to newName
+func (s *Store) Rename(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[oldName]
+	if !ok {
+		if _, ok := s.entries[newName]; !ok {
+			return nil
+		}
+		delete(s.entries, newName)
+		return s.save()
+	}
+	delete(s.entries, oldName)
+	s.entries[newName] = e
+	return s.save()
+}
+
+// Compute returns the checksums of the file at filePath, hashing it and
+// recording the result if none are recorded yet. BLAKE3 is included when
+// withBLAKE3 is set.
+func (s *Store) Compute(filePath string, withBLAKE3 bool) (Sums, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return Sums{}, err
+	}
+	known, ok := s.Get(info)
+	if ok && (known.BLAKE3 != "" || !withBLAKE3) {
+		return known, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Sums{}, err
+	}
+	defer f.Close()
+
+	h := NewHasher(withBLAKE3)
+	if _, err := io.Copy(h, f); err != nil {
+		return Sums{}, err
+	}
+
+	// Don't record sums for a file that changed while it was read
+	sums := h.Sums()
+	sums.MD5 = known.MD5
+	if after, err := f.Stat(); err == nil && after.Size() == info.Size() && after.ModTime().Equal(info.ModTime()) {
+		s.mu.Lock()
+		s.entries[info.Name()] = entry{Sums: sums, Size: info.Size(), ModTime: info.ModTime().UTC()}
+		err = s.save()
+		s.mu.Unlock()
+		if err != nil {
+			return Sums{}, err
+		}
+	}
+	return sums, nil
+}
+
+// Prune drops entries for files that no longer exist in dir
+func (s *Store) Prune(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for name := range s.entries {
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			delete(s.entries, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the index atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save checksum index: %w", err)
+	}
+	return nil
+}
@@ -4,17 +4,116 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/accesslog"
+	"github.com/OderoCeasar/localshare/internal/logging"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Port          int
-	UploadDir     string
-	PIN           string
-	AdminAuth     bool
-	AdminUser     string
-	AdminPass     string
-	MaxFileSizeMB int64
+	Port          int    `yaml:"port" toml:"port"`
+	UploadDir     string `yaml:"upload_dir" toml:"upload_dir"`
+	PIN           string `yaml:"pin" toml:"pin"`
+	AdminAuth     bool   `yaml:"admin_auth" toml:"admin_auth"`
+	AdminUser     string `yaml:"admin_user" toml:"admin_user"`
+	AdminPass     string `yaml:"admin_pass" toml:"admin_pass"`
+	MaxFileSizeMB int64  `yaml:"max_file_size_mb" toml:"max_file_size_mb"`
+
+	// WebDir serves the frontend from disk instead of the embedded build
+	WebDir string `yaml:"web_dir" toml:"web_dir"`
+
+	// Storage limits
+	QuotaMB   int64 `yaml:"quota_mb" toml:"quota_mb"`
+	MinFreeMB int64 `yaml:"min_free_mb" toml:"min_free_mb"`
+
+	// Dedup stores identical uploads once, with every copy linked to it
+	Dedup bool `yaml:"dedup" toml:"dedup"`
+
+	// Retention
+	MaxTTLHours          int   `yaml:"max_ttl_hours" toml:"max_ttl_hours"`
+	RetentionMaxAgeHours int   `yaml:"retention_max_age_hours" toml:"retention_max_age_hours"`
+	RetentionMaxSizeMB   int64 `yaml:"retention_max_size_mb" toml:"retention_max_size_mb"`
+
+	// TrashDays is how long deleted files can be restored; 0 deletes immediately
+	TrashDays int `yaml:"trash_days" toml:"trash_days"`
+
+	// Versions of overwritten files
+	MaxVersions       int   `yaml:"max_versions" toml:"max_versions"`
+	VersionsMaxSizeMB int64 `yaml:"versions_max_size_mb" toml:"versions_max_size_mb"`
+
+	// HashBLAKE3 computes BLAKE3 checksums alongside SHA-256
+	HashBLAKE3 bool `yaml:"hash_blake3" toml:"hash_blake3"`
+
+	// SearchIndex indexes the content of text files for full-text search
+	SearchIndex bool `yaml:"search_index" toml:"search_index"`
+
+	// Limits on reading archives, against decompression bombs
+	ArchiveMaxEntries int   `yaml:"archive_max_entries" toml:"archive_max_entries"`
+	ArchiveMaxSizeMB  int64 `yaml:"archive_max_size_mb" toml:"archive_max_size_mb"`
+
+	// S3-compatible endpoint
+	S3Port      int    `yaml:"s3_port" toml:"s3_port"`
+	S3Bucket    string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3AccessKey string `yaml:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key" toml:"s3_secret_key"`
+
+	// SFTP listener
+	SFTPPort int `yaml:"sftp_port" toml:"sftp_port"`
+
+	// Logging
+	LogFormat string `yaml:"log_format" toml:"log_format"`
+	LogLevel  string `yaml:"log_level" toml:"log_level"`
+
+	// Access log
+	AccessLog            string `yaml:"access_log" toml:"access_log"`
+	AccessLogFormat      string `yaml:"access_log_format" toml:"access_log_format"`
+	AccessLogMaxSizeMB   int    `yaml:"access_log_max_size_mb" toml:"access_log_max_size_mb"`
+	AccessLogRotateHours int    `yaml:"access_log_rotate_hours" toml:"access_log_rotate_hours"`
+	AccessLogMaxBackups  int    `yaml:"access_log_max_backups" toml:"access_log_max_backups"`
+	AccessLogCompress    bool   `yaml:"access_log_compress" toml:"access_log_compress"`
+
+	// Monitoring
+	MetricsToken    string `yaml:"metrics_token" toml:"metrics_token"`
+	HealthMinFreeMB int64  `yaml:"health_min_free_mb" toml:"health_min_free_mb"`
+
+	// ConfigFile is the file the configuration was loaded from, if any
+	ConfigFile string `yaml:"-" toml:"-"`
+
+	// Overrides maps the file keys of settings given as environment
+	// variables or command-line flags to where they were given, e.g.
+	// "pin" to "--pin". Such settings win over the config file on reload.
+	Overrides map[string]string `yaml:"-" toml:"-"`
+}
+
+// Default returns the configuration used when no file, environment
+// variable or flag overrides a setting
+func Default() Config {
+	return Config{
+		Port:          8080,
+		UploadDir:     "./uploads",
+		AdminUser:     "admin",
+		MaxFileSizeMB: 500,
+		MinFreeMB:     100,
+		Dedup:         true,
+		SearchIndex:   true,
+		TrashDays:     30,
+		MaxVersions:   5,
+		S3Bucket:      "localshare",
+		LogFormat:     logging.FormatText,
+		LogLevel:      "info",
+
+		ArchiveMaxEntries: 10000,
+		ArchiveMaxSizeMB:  10240,
+
+		AccessLogFormat:      accesslog.FormatCombined,
+		AccessLogMaxSizeMB:   100,
+		AccessLogRotateHours: 24,
+		AccessLogMaxBackups:  7,
+		AccessLogCompress:    true,
+
+		HealthMinFreeMB: 100,
+	}
 }
 
 // MaxFileSize returns the maximum file size in bytes
@@ -22,6 +121,43 @@ func (c *Config) MaxFileSize() int64 {
 	return c.MaxFileSizeMB * 1024 * 1024
 }
 
+// QuotaBytes returns the storage quota in bytes, or 0 when unlimited
+func (c *Config) QuotaBytes() int64 {
+	return c.QuotaMB * 1024 * 1024
+}
+
+// MinFreeBytes returns the free disk space uploads must leave, in bytes
+func (c *Config) MinFreeBytes() int64 {
+	return c.MinFreeMB * 1024 * 1024
+}
+
+// MaxTTL returns the longest expiry an uploader may choose, or 0 for no limit
+func (c *Config) MaxTTL() time.Duration {
+	return time.Duration(c.MaxTTLHours) * time.Hour
+}
+
+// RetentionMaxAge returns how long files are kept, or 0 to keep them indefinitely
+func (c *Config) RetentionMaxAge() time.Duration {
+	return time.Duration(c.RetentionMaxAgeHours) * time.Hour
+}
+
+// RetentionMaxSize returns the total size in bytes above which the oldest
+// files are evicted, or 0 for no limit
+func (c *Config) RetentionMaxSize() int64 {
+	return c.RetentionMaxSizeMB * 1024 * 1024
+}
+
+// VersionsMaxSize returns the total size in bytes that kept versions may
+// take up, or 0 for no limit
+func (c *Config) VersionsMaxSize() int64 {
+	return c.VersionsMaxSizeMB * 1024 * 1024
+}
+
+// ArchiveMaxSize returns the most bytes an archive may expand to when read
+func (c *Config) ArchiveMaxSize() int64 {
+	return c.ArchiveMaxSizeMB * 1024 * 1024
+}
+
 // IsPINProtected returns whether PIN protection is enabled
 func (c *Config) IsPINProtected() bool {
 	return c.PIN != ""
@@ -32,6 +168,21 @@ func (c *Config) IsAdminAuthEnabled() bool {
 	return c.AdminAuth
 }
 
+// IsS3Enabled returns whether the S3-compatible endpoint should be started
+func (c *Config) IsS3Enabled() bool {
+	return c.S3Port != 0
+}
+
+// IsSFTPEnabled returns whether the SFTP listener should be started
+func (c *Config) IsSFTPEnabled() bool {
+	return c.SFTPPort != 0
+}
+
+// IsAccessLogEnabled returns whether requests should be written to an access log file
+func (c *Config) IsAccessLogEnabled() bool {
+	return c.AccessLog != ""
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	// Validate port
@@ -64,9 +215,89 @@ func (c *Config) Validate() error {
 		return errors.New("max file size cannot exceed 10000 MB (10 GB)")
 	}
 
+	// Validate storage limits
+	if c.QuotaMB < 0 || c.MinFreeMB < 0 {
+		return errors.New("storage quota and free space reserve cannot be negative")
+	}
+
+	// Validate retention policy
+	if c.MaxTTLHours < 0 || c.RetentionMaxAgeHours < 0 || c.RetentionMaxSizeMB < 0 {
+		return errors.New("maximum TTL, retention age and retention size cannot be negative")
+	}
+	if c.TrashDays < 0 {
+		return errors.New("trash_days cannot be negative")
+	}
+
+	// Validate versioning limits
+	if c.MaxVersions < 0 || c.VersionsMaxSizeMB < 0 {
+		return errors.New("max_versions and versions_max_size_mb cannot be negative")
+	}
+
+	// Validate archive limits
+	if c.ArchiveMaxEntries < 1 || c.ArchiveMaxSizeMB < 1 {
+		return errors.New("archive_max_entries and archive_max_size_mb must be at least 1")
+	}
+
+	// Validate S3 endpoint configuration
+	if c.IsS3Enabled() {
+		if c.S3Port < 1 || c.S3Port > 65535 {
+			return fmt.Errorf("S3 port must be between 1 and 65535, got %d", c.S3Port)
+		}
+		if c.S3Port == c.Port {
+			return errors.New("S3 port must differ from the HTTP port")
+		}
+		if !isValidBucketName(c.S3Bucket) {
+			return fmt.Errorf("invalid S3 bucket name %q (3-63 lowercase letters, digits, dots or hyphens)", c.S3Bucket)
+		}
+		if c.S3AccessKey == "" || c.S3SecretKey == "" {
+			return errors.New("S3 access key and secret key are required when the S3 endpoint is enabled (use --s3-access-key and --s3-secret-key)")
+		}
+		if len(c.S3SecretKey) < 8 {
+			return errors.New("S3 secret key must be at least 8 characters")
+		}
+	}
+
+	// Validate SFTP listener configuration
+	if c.IsSFTPEnabled() {
+		if c.SFTPPort < 1 || c.SFTPPort > 65535 {
+			return fmt.Errorf("SFTP port must be between 1 and 65535, got %d", c.SFTPPort)
+		}
+		if c.SFTPPort == c.Port || (c.IsS3Enabled() && c.SFTPPort == c.S3Port) {
+			return errors.New("SFTP port must differ from the HTTP and S3 ports")
+		}
+	}
+
+	// Validate logging configuration
+	if !logging.ValidFormat(c.LogFormat) {
+		return fmt.Errorf("invalid log format %q (use text or json)", c.LogFormat)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	if c.HealthMinFreeMB < 0 {
+		return errors.New("health_min_free_mb cannot be negative")
+	}
+
+	// Validate access log configuration
+	if c.IsAccessLogEnabled() {
+		if !accesslog.ValidFormat(c.AccessLogFormat) {
+			return fmt.Errorf("invalid access log format %q (use common, combined or json)", c.AccessLogFormat)
+		}
+		if c.AccessLogMaxSizeMB < 0 || c.AccessLogRotateHours < 0 || c.AccessLogMaxBackups < 0 {
+			return errors.New("access log size, rotation interval and backup count cannot be negative")
+		}
+	}
+
 	return nil
 }
 
+// isValidBucketName checks if the name follows the S3 bucket naming rules
+func isValidBucketName(name string) bool {
+	matched, _ := regexp.MatchString(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`, name)
+	return matched
+}
+
 // isValidPIN checks if the PIN is 4-6 digits
 func isValidPIN(pin string) bool {
 	matched, _ := regexp.MatchString(`^\d{4,6}$`, pin)
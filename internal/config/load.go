@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// EnvPrefix is prepended to the upper-cased file key of each setting to
+// form its environment variable, e.g. LOCALSHARE_MAX_FILE_SIZE_MB
+const EnvPrefix = "LOCALSHARE_"
+
+// EnvConfigFile names the environment variable that selects a config file
+const EnvConfigFile = EnvPrefix + "CONFIG"
+
+// DefaultPaths returns the locations searched for a config file when none
+// is given explicitly, in order of preference
+func DefaultPaths() []string {
+	paths := []string{
+		"localshare.yaml",
+		"localshare.yml",
+		"localshare.toml",
+	}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(dir, "localshare", "config.yaml"),
+			filepath.Join(dir, "localshare", "config.yml"),
+			filepath.Join(dir, "localshare", "config.toml"),
+		)
+	}
+
+	return paths
+}
+
+// FindFile returns the first default config file that exists, or "" if none do
+func FindFile() string {
+	for _, path := range DefaultPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load builds a configuration from the defaults, the config file at path
+// (if any) and LOCALSHARE_* environment variables, in increasing order of
+// precedence. Command-line flags are applied on top by the caller.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := LoadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := ApplyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// LoadFile decodes a YAML or TOML config file into cfg. Keys missing from
+// the file keep their current values; unknown keys are rejected.
+func LoadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := yaml.UnmarshalWithOptions(data, cfg, yaml.Strict()); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		}
+	case ".toml":
+		if err := toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(cfg); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	cfg.ConfigFile = path
+	return nil
+}
+
+// ApplyEnv overrides settings from LOCALSHARE_* environment variables
+func ApplyEnv(cfg *Config) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		name := EnvPrefix + strings.ToUpper(key)
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for %s: expected true or false", raw, name)
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for %s: expected an integer", raw, name)
+			}
+			field.SetInt(n)
+		}
+		cfg.SetOverride(key, name)
+	}
+
+	return nil
+}
+
+// SetOverride records that the setting with the given file key was set by
+// source, an environment variable or command-line flag
+func (c *Config) SetOverride(key, source string) {
+	if c.Overrides == nil {
+		c.Overrides = make(map[string]string)
+	}
+	c.Overrides[key] = source
+}
+
+// KeyOf returns the file key of the setting field points to, or "" if it
+// does not point to a field of c. field is usually the value of a flag
+// bound to one of the fields, which shares the field's address.
+func (c *Config) KeyOf(field any) string {
+	ptr := reflect.ValueOf(field)
+	if ptr.Kind() != reflect.Pointer {
+		return ""
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).Addr().Pointer() == ptr.Pointer() {
+			return t.Field(i).Tag.Get("yaml")
+		}
+	}
+	return ""
+}
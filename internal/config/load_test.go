@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a config file named name with content into a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := "port: 9000\npin: \"1234\"\nmax_file_size_mb: 100\n"
+	tomlFile := "port = 9000\npin = \"1234\"\nmax_file_size_mb = 100\n"
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		env       map[string]string
+		wantPort  int
+		wantPIN   string
+		wantSize  int64
+		overrides map[string]string
+	}{
+		{
+			name:     "defaults only",
+			wantPort: 8080,
+			wantSize: 500,
+		},
+		{
+			name:     "yaml file over defaults",
+			file:     "localshare.yaml",
+			content:  yamlFile,
+			wantPort: 9000,
+			wantPIN:  "1234",
+			wantSize: 100,
+		},
+		{
+			name:     "toml file over defaults",
+			file:     "localshare.toml",
+			content:  tomlFile,
+			wantPort: 9000,
+			wantPIN:  "1234",
+			wantSize: 100,
+		},
+		{
+			name:      "environment over file",
+			file:      "localshare.yaml",
+			content:   yamlFile,
+			env:       map[string]string{"LOCALSHARE_PIN": "5678", "LOCALSHARE_MAX_FILE_SIZE_MB": "200"},
+			wantPort:  9000,
+			wantPIN:   "5678",
+			wantSize:  200,
+			overrides: map[string]string{"pin": "LOCALSHARE_PIN", "max_file_size_mb": "LOCALSHARE_MAX_FILE_SIZE_MB"},
+		},
+		{
+			name:      "environment without file",
+			env:       map[string]string{"LOCALSHARE_PORT": "3000"},
+			wantPort:  3000,
+			wantSize:  500,
+			overrides: map[string]string{"port": "LOCALSHARE_PORT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, tt.file, tt.content)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Port != tt.wantPort || cfg.PIN != tt.wantPIN || cfg.MaxFileSizeMB != tt.wantSize {
+				t.Errorf("got port %d, pin %q, max size %d; want %d, %q, %d",
+					cfg.Port, cfg.PIN, cfg.MaxFileSizeMB, tt.wantPort, tt.wantPIN, tt.wantSize)
+			}
+			if cfg.ConfigFile != path {
+				t.Errorf("ConfigFile = %q, want %q", cfg.ConfigFile, path)
+			}
+			if len(cfg.Overrides) != len(tt.overrides) {
+				t.Errorf("Overrides = %v, want %v", cfg.Overrides, tt.overrides)
+			}
+			for key, source := range tt.overrides {
+				if cfg.Overrides[key] != source {
+					t.Errorf("Overrides[%q] = %q, want %q", key, cfg.Overrides[key], source)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "unknown yaml key", file: "c.yaml", content: "prot: 9000\n", wantErr: "invalid config file"},
+		{name: "unknown toml key", file: "c.toml", content: "prot = 9000\n", wantErr: "invalid config file"},
+		{name: "wrong type", file: "c.yaml", content: "port: lots\n", wantErr: "invalid config file"},
+		{name: "unsupported format", file: "c.json", content: "{}", wantErr: "unsupported config file format"},
+		{name: "invalid integer env", env: map[string]string{"LOCALSHARE_PORT": "eighty"}, wantErr: "LOCALSHARE_PORT"},
+		{name: "invalid bool env", env: map[string]string{"LOCALSHARE_DEDUP": "maybe"}, wantErr: "LOCALSHARE_DEDUP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, tt.file, tt.content)
+			}
+
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadEmptyYAML(t *testing.T) {
+	cfg, err := Load(writeFile(t, "empty.yaml", "\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != Default().Port {
+		t.Errorf("Port = %d, want default %d", cfg.Port, Default().Port)
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	cfg := Default()
+	tests := []struct {
+		field any
+		want  string
+	}{
+		{&cfg.PIN, "pin"},
+		{&cfg.AdminAuth, "admin_auth"},
+		{&cfg.MaxFileSizeMB, "max_file_size_mb"},
+		{&cfg.ConfigFile, "-"},
+		{new(string), ""},
+		{cfg.Port, ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.KeyOf(tt.field); got != tt.want {
+			t.Errorf("KeyOf(%T) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		values  map[string]any
+		want    string
+	}{
+		{
+			name:    "yaml replaces and appends",
+			file:    "c.yaml",
+			content: "# The PIN\npin: \"1234\"\nport: 8080\n",
+			values:  map[string]any{"pin": "4321", "admin_auth": true},
+			want:    "# The PIN\npin: \"4321\"\nport: 8080\nadmin_auth: true\n",
+		},
+		{
+			name:    "toml replaces",
+			file:    "c.toml",
+			content: "max_file_size_mb = 500\n",
+			values:  map[string]any{"max_file_size_mb": int64(2000)},
+			want:    "max_file_size_mb = 2000\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.file, tt.content)
+			if err := UpdateFile(path, tt.values); err != nil {
+				t.Fatalf("UpdateFile: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("file = %q, want %q", data, tt.want)
+			}
+
+			// The updated file must still load
+			if _, err := Load(path); err != nil {
+				t.Errorf("Load after update: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// UpdateFile sets the given top-level keys in a config file, rewriting
+// matching "key: value" (YAML) or "key = value" (TOML) lines in place and
+// appending keys that are missing. Comments and all other lines are kept,
+// so files generated by Template stay readable after an update.
+func UpdateFile(path string, values map[string]any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	separator := ": "
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		separator = " = "
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for key, value := range values {
+		line := key + separator + formatValue(value)
+		pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(key) + `\s*[:=]`)
+
+		found := false
+		for i, existing := range lines {
+			if pattern.MatchString(existing) {
+				lines[i] = line
+				found = true
+				break
+			}
+		}
+		if !found {
+			lines = append(lines, line)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated config
+	if err := fileutil.WriteFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
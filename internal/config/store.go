@@ -0,0 +1,127 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Loader produces a fresh configuration, e.g. by re-reading the config file
+type Loader func() (*Config, error)
+
+// Store holds the active configuration and lets it be replaced while the
+// server is running. Readers call Get once per request and use that
+// snapshot throughout, so a reload never mixes old and new settings.
+type Store struct {
+	current atomic.Pointer[Config]
+
+	// mu serializes updates so concurrent reloads and edits don't interleave
+	mu sync.Mutex
+
+	// The session tokens are random, independent of each other and replaced
+	// whenever their credentials change, so a session from a previous run or
+	// verified against an older PIN or password is not honoured, and a
+	// PIN-verified session can never pass as an admin one
+	pinToken   atomic.Pointer[string]
+	adminToken atomic.Pointer[string]
+}
+
+// NewStore creates a store holding cfg
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	s.pinToken.Store(newToken())
+	s.adminToken.Store(newToken())
+	return s
+}
+
+// Get returns the active configuration. The result must not be modified.
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Set replaces the active configuration, rotating the session tokens whose
+// underlying credentials changed
+func (s *Store) Set(next *Config) {
+	prev := s.current.Swap(next)
+	if prev.PIN != next.PIN {
+		s.pinToken.Store(newToken())
+	}
+	if prev.AdminUser != next.AdminUser || prev.AdminPass != next.AdminPass || prev.AdminAuth != next.AdminAuth {
+		s.adminToken.Store(newToken())
+	}
+}
+
+// Update applies fn to a copy of the active configuration and makes the
+// result active if fn succeeds and it validates. Updates are serialized.
+func (s *Store) Update(fn func(next *Config) error) (*Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := *s.Get()
+	if err := fn(&next); err != nil {
+		return nil, err
+	}
+
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	s.Set(&next)
+	return &next, nil
+}
+
+// PINToken identifies the current PIN; sessions verified against an older PIN hold a stale token
+func (s *Store) PINToken() string {
+	return *s.pinToken.Load()
+}
+
+// AdminToken identifies the current admin credentials; logins made with older credentials hold a stale token
+func (s *Store) AdminToken() string {
+	return *s.adminToken.Load()
+}
+
+// newToken returns a random session token
+func newToken() *string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	return &token
+}
+
+// CheckReload reports settings that differ between c and next but can
+// only take effect after a restart, such as listener ports
+func (c *Config) CheckReload(next *Config) error {
+	var fields []string
+	if c.Port != next.Port {
+		fields = append(fields, "port")
+	}
+	if c.UploadDir != next.UploadDir {
+		fields = append(fields, "upload_dir")
+	}
+	if c.S3Port != next.S3Port {
+		fields = append(fields, "s3_port")
+	}
+	if c.SFTPPort != next.SFTPPort {
+		fields = append(fields, "sftp_port")
+	}
+	if c.WebDir != next.WebDir {
+		fields = append(fields, "web_dir")
+	}
+	if c.LogFormat != next.LogFormat {
+		fields = append(fields, "log_format")
+	}
+	if c.AccessLog != next.AccessLog || c.AccessLogFormat != next.AccessLogFormat ||
+		c.AccessLogMaxSizeMB != next.AccessLogMaxSizeMB || c.AccessLogRotateHours != next.AccessLogRotateHours ||
+		c.AccessLogMaxBackups != next.AccessLogMaxBackups || c.AccessLogCompress != next.AccessLogCompress {
+		fields = append(fields, "access_log settings")
+	}
+
+	if len(fields) > 0 {
+		return fmt.Errorf("changing %s requires a restart", strings.Join(fields, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import "testing"
+
+func TestStoreTokens(t *testing.T) {
+	base := Default()
+	base.PIN = "1234"
+	base.AdminAuth = true
+	base.AdminPass = "secret123"
+
+	tests := []struct {
+		name        string
+		change      func(c *Config)
+		rotatePIN   bool
+		rotateAdmin bool
+	}{
+		{name: "unrelated setting", change: func(c *Config) { c.MaxFileSizeMB = 100 }},
+		{name: "pin", change: func(c *Config) { c.PIN = "5678" }, rotatePIN: true},
+		{name: "pin removed", change: func(c *Config) { c.PIN = "" }, rotatePIN: true},
+		{name: "admin password", change: func(c *Config) { c.AdminPass = "another1" }, rotateAdmin: true},
+		{name: "admin user", change: func(c *Config) { c.AdminUser = "root" }, rotateAdmin: true},
+		{name: "admin auth disabled", change: func(c *Config) { c.AdminAuth = false }, rotateAdmin: true},
+		{
+			name:        "pin and password",
+			change:      func(c *Config) { c.PIN = "5678"; c.AdminPass = "another1" },
+			rotatePIN:   true,
+			rotateAdmin: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			s := NewStore(&cfg)
+			pinToken, adminToken := s.PINToken(), s.AdminToken()
+
+			if len(pinToken) != 64 || len(adminToken) != 64 {
+				t.Fatalf("token lengths = %d, %d; want 64", len(pinToken), len(adminToken))
+			}
+			if pinToken == adminToken {
+				t.Fatal("PIN and admin tokens are equal")
+			}
+
+			if _, err := s.Update(func(next *Config) error {
+				tt.change(next)
+				return nil
+			}); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			if rotated := s.PINToken() != pinToken; rotated != tt.rotatePIN {
+				t.Errorf("PIN token rotated = %v, want %v", rotated, tt.rotatePIN)
+			}
+			if rotated := s.AdminToken() != adminToken; rotated != tt.rotateAdmin {
+				t.Errorf("admin token rotated = %v, want %v", rotated, tt.rotateAdmin)
+			}
+			if s.PINToken() == s.AdminToken() {
+				t.Error("PIN and admin tokens are equal after update")
+			}
+		})
+	}
+}
+
+func TestStoreTokensPerInstance(t *testing.T) {
+	cfg := Default()
+	a, b := NewStore(&cfg), NewStore(&cfg)
+	if a.PINToken() == b.PINToken() || a.AdminToken() == b.AdminToken() {
+		t.Error("stores created from the same configuration share a token")
+	}
+}
+
+func TestStoreUpdateInvalid(t *testing.T) {
+	cfg := Default()
+	cfg.PIN = "1234"
+	s := NewStore(&cfg)
+	pinToken := s.PINToken()
+
+	if _, err := s.Update(func(next *Config) error {
+		next.PIN = "12"
+		return nil
+	}); err == nil {
+		t.Fatal("Update accepted an invalid PIN")
+	}
+	if s.Get().PIN != "1234" || s.PINToken() != pinToken {
+		t.Error("a rejected update changed the active configuration")
+	}
+}
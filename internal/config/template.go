@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// templateEntry is one setting in the generated config template
+type templateEntry struct {
+	key     string
+	comment string
+	value   any
+}
+
+// templateSection groups related settings under a heading
+type templateSection struct {
+	title   string
+	entries []templateEntry
+}
+
+// templateSections lists every setting written by Template, with its default value
+func templateSections() []templateSection {
+	d := Default()
+	return []templateSection{
+		{"Server", []templateEntry{
+			{"port", "Port to run the HTTP server on", d.Port},
+			{"upload_dir", "Directory to store uploaded files", d.UploadDir},
+			{"max_file_size_mb", "Maximum file size in MB (1-10000)", d.MaxFileSizeMB},
+			{"web_dir", "Serve the frontend from this directory instead of the embedded build (for frontend development)", d.WebDir},
+		}},
+		{"Storage", []templateEntry{
+			{"quota_mb", "Total size in MB the shared files may take up (0 for no quota)", d.QuotaMB},
+			{"min_free_mb", "Reject uploads that would leave less than this many MB free on disk", d.MinFreeMB},
+			{"dedup", "Store identical uploads once and link every copy to the same content", d.Dedup},
+		}},
+		{"Retention", []templateEntry{
+			{"max_ttl_hours", "Longest expiry in hours uploaders may choose for a file (0 for no limit)", d.MaxTTLHours},
+			{"retention_max_age_hours", "Delete files older than this many hours (0 to keep them)", d.RetentionMaxAgeHours},
+			{"retention_max_size_mb", "Delete the oldest files while the share exceeds this many MB (0 for no limit)", d.RetentionMaxSizeMB},
+			{"trash_days", "Days deleted files stay in the trash before being purged (0 to delete immediately)", d.TrashDays},
+		}},
+		{"Versioning", []templateEntry{
+			{"max_versions", "Previous versions kept when a file is overwritten (0 to disable)", d.MaxVersions},
+			{"versions_max_size_mb", "Total size in MB of kept versions before the oldest are dropped (0 for no limit)", d.VersionsMaxSizeMB},
+		}},
+		{"Checksums", []templateEntry{
+			{"hash_blake3", "Compute BLAKE3 checksums in addition to SHA-256", d.HashBLAKE3},
+		}},
+		{"Search", []templateEntry{
+			{"search_index", "Index the content of text, Markdown and source files for full-text search", d.SearchIndex},
+		}},
+		{"Archives", []templateEntry{
+			{"archive_max_entries", "Most entries a zip or tar archive may have to be browsed", d.ArchiveMaxEntries},
+			{"archive_max_size_mb", "Most MB a zip or tar archive may expand to when browsed", d.ArchiveMaxSizeMB},
+		}},
+		{"Access control", []templateEntry{
+			{"pin", "Optional PIN for file access (4-6 digits, empty to disable)", d.PIN},
+			{"admin_auth", "Require admin authentication for uploads and deletes", d.AdminAuth},
+			{"admin_user", "Admin username", d.AdminUser},
+			{"admin_pass", "Admin password (at least 6 characters, required when admin_auth is true)", d.AdminPass},
+		}},
+		{"S3-compatible API", []templateEntry{
+			{"s3_port", "Port for the S3-compatible API (0 to disable)", d.S3Port},
+			{"s3_bucket", "Bucket name exposed over S3", d.S3Bucket},
+			{"s3_access_key", "Access key ID S3 clients sign requests with", d.S3AccessKey},
+			{"s3_secret_key", "Secret access key (at least 8 characters)", d.S3SecretKey},
+		}},
+		{"SFTP", []templateEntry{
+			{"sftp_port", "Port for the built-in SFTP server (0 to disable)", d.SFTPPort},
+		}},
+		{"Logging", []templateEntry{
+			{"log_format", "Log output format: text or json", d.LogFormat},
+			{"log_level", "Minimum log level: debug, info, warn or error", d.LogLevel},
+		}},
+		{"Access log", []templateEntry{
+			{"access_log", "File to record every request in (empty to disable)", d.AccessLog},
+			{"access_log_format", "Access log format: common, combined or json", d.AccessLogFormat},
+			{"access_log_max_size_mb", "Rotate when the file exceeds this size in MB (0 to disable)", d.AccessLogMaxSizeMB},
+			{"access_log_rotate_hours", "Rotate after this many hours (0 to disable)", d.AccessLogRotateHours},
+			{"access_log_max_backups", "Number of rotated files to keep (0 to keep all)", d.AccessLogMaxBackups},
+			{"access_log_compress", "Gzip rotated files", d.AccessLogCompress},
+		}},
+		{"Monitoring", []templateEntry{
+			{"metrics_token", "Bearer token required to scrape /metrics (empty to allow anyone)", d.MetricsToken},
+			{"health_min_free_mb", "Report not ready when free disk space falls below this many MB", d.HealthMinFreeMB},
+		}},
+	}
+}
+
+// Template returns a commented config file with every setting at its
+// default value. The format follows the extension of path: TOML for
+// .toml, YAML otherwise.
+func Template(path string) string {
+	separator := ": "
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		separator = " = "
+	}
+
+	var b strings.Builder
+	b.WriteString("# LocalShare configuration\n")
+	b.WriteString("#\n")
+	b.WriteString("# Precedence: command-line flags > LOCALSHARE_* environment variables > this file > defaults.\n")
+	b.WriteString("# Every key can also be set as an environment variable, e.g. LOCALSHARE_PORT=3000.\n")
+
+	for _, section := range templateSections() {
+		fmt.Fprintf(&b, "\n# --- %s ---\n", section.title)
+		for _, entry := range section.entries {
+			fmt.Fprintf(&b, "\n# %s\n", entry.comment)
+			fmt.Fprintf(&b, "%s%s%s\n", entry.key, separator, formatValue(entry.value))
+		}
+	}
+
+	return b.String()
+}
+
+// formatValue renders a default value in syntax valid for both YAML and TOML
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
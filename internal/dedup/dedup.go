@@ -0,0 +1,208 @@
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// clone makes dst a copy-on-write clone of src. Tests replace it on
+// filesystems that cannot clone files.
+var clone = fileutil.Clone
+
+// Store keeps uploaded content once per SHA-256 checksum. Shared files are
+// copy-on-write clones of the stored content, so identical uploads take up
+// disk space once while every protocol keeps seeing plain files. Clones are
+// separate files: each keeps its own modification time, and an edit to one
+// never changes the others. Stored content is referenced by the shared
+// files whose recorded checksum it matches, and Collect removes content
+// that none do any more.
+type Store struct {
+	config    *config.Store
+	dir       string
+	checksums *checksum.Store
+
+	// supported is whether the filesystem can clone files
+	supported bool
+
+	mu sync.Mutex
+}
+
+// Open creates a content store in dir. checksums identifies the content
+// of shared files.
+func Open(cfg *config.Store, dir string, checksums *checksum.Store) (*Store, error) {
+	s := &Store{
+		config:    cfg,
+		dir:       dir,
+		checksums: checksums,
+	}
+
+	probe, err := os.CreateTemp(dir, "probe-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open content store: %w", err)
+	}
+	probe.Close()
+	s.supported = clone(probe.Name(), probe.Name()+".clone") == nil
+	os.Remove(probe.Name() + ".clone")
+	os.Remove(probe.Name())
+
+	return s, nil
+}
+
+// Intern makes the staged file at src share its content with earlier
+// uploads of the same content, or stores the content if it is new. src must
+// be on the same filesystem as the store. Where files cannot be cloned the
+// staged file is left as an independent copy.
+func (s *Store) Intern(src, sha256Sum string) error {
+	if !s.supported || !s.config.Get().Dedup || sha256Sum == "" {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object := filepath.Join(s.dir, sha256Sum)
+	if stored, err := os.Stat(object); err == nil && stored.Size() == info.Size() {
+		// Swap the staged copy for a clone of the stored content, dated
+		// and permitted like the upload it stands in for
+		cloned := src + ".clone"
+		if err := clone(object, cloned); err != nil {
+			return fmt.Errorf("failed to clone stored content: %w", err)
+		}
+		if err := os.Chmod(cloned, info.Mode().Perm()); err != nil {
+			os.Remove(cloned)
+			return err
+		}
+		if err := os.Chtimes(cloned, time.Time{}, info.ModTime()); err != nil {
+			os.Remove(cloned)
+			return err
+		}
+		if err := os.Rename(cloned, src); err != nil {
+			os.Remove(cloned)
+			return err
+		}
+		return nil
+	}
+
+	// Content of a different size under this checksum was damaged on
+	// disk, so store the new upload in its place
+	os.Remove(object)
+	if err := clone(src, object); err != nil {
+		return fmt.Errorf("failed to store content: %w", err)
+	}
+	return nil
+}
+
+// Collect removes stored content that no shared file references any more,
+// returning how many objects it removed. Files in the trash and kept
+// versions are clones that hold their own content, so they need none.
+// Content stored for an upload that is not yet in place may be removed
+// too, which only costs later uploads of it their sharing.
+func (s *Store) Collect() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.supported {
+		return 0, nil
+	}
+
+	refs, err := s.references()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read content store: %w", err)
+	}
+
+	removed := 0
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || refs[entry.Name()] > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// Stats reports the stored content and the disk space deduplication saves
+func (s *Store) Stats() (models.DedupStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := models.DedupStats{Enabled: s.supported && s.config.Get().Dedup}
+	if !s.supported {
+		return stats, nil
+	}
+
+	refs, err := s.references()
+	if err != nil {
+		return stats, err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read content store: %w", err)
+	}
+
+	for _, entry := range entries {
+		n := refs[entry.Name()]
+		if !entry.Type().IsRegular() || n == 0 {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		// The first reference is the copy that would have been stored anyway
+		stats.Objects++
+		stats.References += n
+		stats.StoredBytes += info.Size()
+		stats.SavedBytes += int64(n-1) * info.Size()
+	}
+	return stats, nil
+}
+
+// references counts the shared files holding each stored checksum. Only
+// files whose recorded checksums still match count, so a file edited in
+// place no longer references the content it was cloned from.
+func (s *Store) references() (map[string]int, error) {
+	uploadDir := s.config.Get().UploadDir
+	files, err := fileutil.ListFiles(uploadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]int)
+	for _, f := range files {
+		if f.IsDir {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(uploadDir, f.Name))
+		if err != nil {
+			continue
+		}
+		if sums, ok := s.checksums.Get(info); ok {
+			refs[sums.SHA256]++
+		}
+	}
+	return refs, nil
+}
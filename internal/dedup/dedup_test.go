@@ -0,0 +1,315 @@
+package dedup
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// copyFile stands in for clones on filesystems that cannot clone files.
+// A copy behaves as a clone does apart from the disk space it takes.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// testStore is a content store over a fresh upload directory
+type testStore struct {
+	*Store
+	config    *config.Store
+	checksums *checksum.Store
+	uploadDir string
+	objects   string
+}
+
+func newTestStore(t *testing.T) *testStore {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	store := config.NewStore(&cfg)
+
+	objects, err := fileutil.StateDir(cfg.UploadDir, "objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums, err := checksum.Open(filepath.Join(t.TempDir(), checksum.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(store, objects, checksums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.supported {
+		clone = copyFile
+		t.Cleanup(func() { clone = fileutil.Clone })
+		if s, err = Open(store, objects, checksums); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &testStore{Store: s, config: store, checksums: checksums, uploadDir: cfg.UploadDir, objects: objects}
+}
+
+// upload writes content to name as an upload finished at modTime would
+// leave it, interned and with its checksum recorded under sum
+func (ts *testStore) upload(t *testing.T, name, content, sum string, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(ts.uploadDir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Time{}, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Intern(path, sum); err != nil {
+		t.Fatalf("Intern(%s): %v", name, err)
+	}
+	if sum != "" {
+		if err := ts.checksums.Set(path, checksum.Sums{SHA256: sum}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func modTime(t *testing.T, path string) time.Time {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.ModTime()
+}
+
+func TestIntern(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// second is the upload after a.txt, holding "hello" under sum "h1"
+		content, sum string
+		dedup        bool
+		wantStored   bool
+	}{
+		{name: "identical content", content: "hello", sum: "h1", dedup: true, wantStored: true},
+		{name: "different content", content: "world", sum: "w1", dedup: true, wantStored: true},
+		{name: "damaged stored content", content: "hello!", sum: "h1", dedup: true, wantStored: true},
+		{name: "dedup disabled", content: "hello", sum: "h1"},
+		{name: "no checksum", content: "hello", dedup: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestStore(t)
+			a := ts.upload(t, "a.txt", "hello", "h1", earlier)
+
+			if !tt.dedup {
+				ts.config.Update(func(next *config.Config) error {
+					next.Dedup = false
+					return nil
+				})
+			}
+			b := ts.upload(t, "b.txt", tt.content, tt.sum, later)
+
+			if got := readFile(t, b); got != tt.content {
+				t.Errorf("b.txt = %q, want %q", got, tt.content)
+			}
+			if info, _ := os.Stat(b); info.Mode().Perm() != 0644 {
+				t.Errorf("b.txt mode = %v, want the upload's 0644", info.Mode().Perm())
+			}
+			// Each file keeps the time it was uploaded
+			if got := modTime(t, b); !got.Equal(later) {
+				t.Errorf("b.txt modified %v, want its upload time %v", got, later)
+			}
+			if got := modTime(t, a); !got.Equal(earlier) {
+				t.Errorf("a.txt modified %v, want its upload time %v", got, earlier)
+			}
+			if _, err := os.Stat(b + ".clone"); !os.IsNotExist(err) {
+				t.Errorf("Intern left its temporary clone behind: %v", err)
+			}
+			if tt.wantStored && readFile(t, filepath.Join(ts.objects, tt.sum)) != tt.content {
+				t.Errorf("b.txt is not stored under %s", tt.sum)
+			}
+		})
+	}
+}
+
+func TestInPlaceEdit(t *testing.T) {
+	ts := newTestStore(t)
+	now := time.Now()
+	a := ts.upload(t, "a.txt", "hello", "h1", now)
+	b := ts.upload(t, "b.txt", "hello", "h1", now)
+
+	// An edit on disk, as an editor saving in place makes, changes one copy
+	f, err := os.OpenFile(b, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("jelly")
+	f.Close()
+
+	if got := readFile(t, a); got != "hello" {
+		t.Errorf("a.txt = %q after editing b.txt, want %q", got, "hello")
+	}
+	if got := readFile(t, filepath.Join(ts.objects, "h1")); got != "hello" {
+		t.Errorf("stored content = %q after editing b.txt, want %q", got, "hello")
+	}
+	if got := readFile(t, ts.upload(t, "c.txt", "hello", "h1", now)); got != "hello" {
+		t.Errorf("c.txt = %q, want %q", got, "hello")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	ts := newTestStore(t)
+	now := time.Now()
+	a := ts.upload(t, "a.txt", "hello", "h1", now)
+	b := ts.upload(t, "b.txt", "hello", "h1", now)
+	c := ts.upload(t, "c.txt", "world", "w1", now)
+
+	stats, err := ts.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Objects != 2 || stats.References != 3 || stats.StoredBytes != 10 || stats.SavedBytes != 5 {
+		t.Errorf("Stats = %+v, want 2 objects, 3 references, 10 stored and 5 saved bytes", stats)
+	}
+
+	// A trashed copy holds its own content, so removing the stored
+	// content never loses it
+	trashed := filepath.Join(ts.uploadDir, ".localshare", "trashed")
+	if err := os.Rename(c, trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	// c.txt's content went with it; a.txt's is still held by b.txt
+	steps := []struct {
+		remove      string
+		wantRemoved int
+		wantObjects []string
+	}{
+		{remove: a, wantRemoved: 1, wantObjects: []string{"h1"}},
+		{remove: b, wantRemoved: 1, wantObjects: nil},
+	}
+	for _, step := range steps {
+		if err := os.Remove(step.remove); err != nil {
+			t.Fatal(err)
+		}
+		removed, err := ts.Collect()
+		if err != nil {
+			t.Fatalf("Collect: %v", err)
+		}
+		if removed != step.wantRemoved {
+			t.Errorf("after removing %s, Collect removed %d, want %d", filepath.Base(step.remove), removed, step.wantRemoved)
+		}
+		entries, _ := os.ReadDir(ts.objects)
+		if len(entries) != len(step.wantObjects) {
+			t.Errorf("after removing %s, %d objects left, want %v", filepath.Base(step.remove), len(entries), step.wantObjects)
+		}
+	}
+	if got := readFile(t, trashed); got != "world" {
+		t.Errorf("trashed copy = %q, want %q", got, "world")
+	}
+}
+
+func TestDedupRetention(t *testing.T) {
+	ts := newTestStore(t)
+	earlier := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	later := earlier.Add(time.Hour)
+
+	// a.txt is uploaded to expire in an hour, then the same content is
+	// uploaded again as b.txt, to be kept indefinitely
+	expiry, err := retention.Open(filepath.Join(t.TempDir(), retention.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := ts.upload(t, "a.txt", "hello", "h1", earlier)
+	if err := expiry.Set("a.txt", modTime(t, a), earlier.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	b := ts.upload(t, "b.txt", "hello", "h1", later)
+
+	// Sharing content must not cost a.txt the expiry its uploader chose
+	cfg := ts.config.Get()
+	files, err := fileutil.ListFiles(ts.uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		want := f.Name == "a.txt"
+		if expires := retention.Expiry(cfg, expiry, f) != nil; expires != want {
+			t.Errorf("%s expires = %v, want %v", f.Name, expires, want)
+		}
+	}
+
+	stateDir := func(name string) string {
+		dir, err := fileutil.StateDir(ts.uploadDir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	meta, err := metadata.Open(filepath.Join(stateDir("metadata"), metadata.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := trash.Open(ts.config, stateDir("trash"), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := search.Open(ts.config, filepath.Join(stateDir("search"), search.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	janitor := retention.NewJanitor(ts.config, expiry, nil, bin, index, ts.checksums, events.NewBroker())
+	removed, err := janitor.Sweep(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Sweep removed %d files, want 1", removed)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Errorf("a.txt was not removed once expired: %v", err)
+	}
+
+	// b.txt still references the content, so it is kept
+	if n, err := ts.Collect(); err != nil || n != 0 {
+		t.Errorf("Collect = %d, %v; want 0, nil", n, err)
+	}
+	if got := readFile(t, b); got != "hello" {
+		t.Errorf("b.txt = %q, want %q", got, "hello")
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+)
+
+// Types of events
+const (
+	TypeAdded    = "added"
+	TypeRemoved  = "removed"
+	TypeRenamed  = "renamed"
+	TypeModified = "modified"
+	TypeProgress = "progress"
+)
+
+// bufferSize is how many events a subscriber may fall behind by before
+// further events are dropped for it
+const bufferSize = 64
+
+// announceWindow is how long after a handler announces a change the
+// watcher keeps quiet about the same file, as it would only repeat it
+const announceWindow = 2 * time.Second
+
+// Broker fans events out to every subscriber. Publishing never blocks: a
+// subscriber that cannot keep up misses events rather than holding up
+// uploads.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan models.Event]struct{}
+	// announced records when handlers last reported a change to each file
+	announced map[string]time.Time
+	// observers are told of the changes the watcher reports
+	observers []func(models.Event)
+}
+
+// NewBroker creates a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{
+		subs:      make(map[chan models.Event]struct{}),
+		announced: make(map[string]time.Time),
+	}
+}
+
+// Subscribe returns a channel of events published from now on, and a
+// function to stop them that must be called when done
+func (b *Broker) Subscribe() (<-chan models.Event, func()) {
+	ch := make(chan models.Event, bufferSize)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Observe has f called with every change the watcher reports, that is
+// every change made on disk that no handler announced. f must not block.
+func (b *Broker) Observe(f func(models.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.observers = append(b.observers, f)
+}
+
+// Publish sends e to every subscriber. Changes published here are not
+// repeated by the watcher.
+func (b *Broker) Publish(e models.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.Type != TypeProgress {
+		b.announced[e.Filename] = e.Time
+		if e.NewName != "" {
+			b.announced[e.NewName] = e.Time
+		}
+	}
+	b.send(e)
+}
+
+// publishObserved sends a change the watcher saw on disk, unless a handler
+// already announced a change to the same file
+func (b *Broker) publishObserved(e models.Event) {
+	e.Time = time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for name, at := range b.announced {
+		if e.Time.Sub(at) > announceWindow {
+			delete(b.announced, name)
+		}
+	}
+	if _, ok := b.announced[e.Filename]; ok {
+		return
+	}
+	if _, ok := b.announced[e.NewName]; ok && e.NewName != "" {
+		return
+	}
+	for _, f := range b.observers {
+		f(e)
+	}
+	b.send(e)
+}
+
+// send delivers e to subscribers with room for it. The caller must hold b.mu.
+func (b *Broker) send(e models.Event) {
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// settleDelay is how long a file must go unwritten before it is
+	// reported, so a file being copied in is reported once, complete
+	settleDelay = 300 * time.Millisecond
+
+	// renameWindow is how soon after a file is moved away its new name must
+	// appear for the two to be reported as a rename
+	renameWindow = 200 * time.Millisecond
+
+	// tickInterval is how often settled changes are reported
+	tickInterval = 100 * time.Millisecond
+)
+
+// change is a file being written that has not settled yet
+type change struct {
+	created bool
+	last    time.Time
+}
+
+// Watch reports changes made directly in dir, such as files copied in or
+// removed by hand, to b's subscribers for as long as the process runs.
+// Subdirectories and the internal state directory are not watched.
+func (b *Broker) Watch(dir string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch upload directory: %w", err)
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to watch upload directory: %w", err)
+	}
+
+	go b.watch(w, dir)
+	return nil
+}
+
+// watch turns filesystem notifications into events. Writes are reported
+// once they settle, and a file moved away is paired with the name that
+// appears right after it.
+func (b *Broker) watch(w *fsnotify.Watcher, dir string) {
+	defer w.Close()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]*change)
+	var renamedFrom string
+	var renamedAt time.Time
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(ev.Name)
+			if filepath.Dir(ev.Name) != filepath.Clean(dir) || name == fileutil.StateDirName {
+				continue
+			}
+			now := time.Now()
+
+			switch {
+			case ev.Has(fsnotify.Create):
+				switch {
+				case renamedFrom == name:
+					// Replaced by moving new content into place, as
+					// uploads are
+					renamedFrom = ""
+					pending[name] = &change{last: now}
+				case renamedFrom != "":
+					b.publishObserved(models.Event{Type: TypeRenamed, Filename: renamedFrom, NewName: name})
+					renamedFrom = ""
+				default:
+					if c, ok := pending[name]; ok {
+						c.last = now
+					} else {
+						pending[name] = &change{created: true, last: now}
+					}
+				}
+			case ev.Has(fsnotify.Write):
+				if c, ok := pending[name]; ok {
+					c.last = now
+				} else {
+					pending[name] = &change{last: now}
+				}
+			case ev.Has(fsnotify.Remove):
+				delete(pending, name)
+				b.publishObserved(models.Event{Type: TypeRemoved, Filename: name})
+			case ev.Has(fsnotify.Rename):
+				delete(pending, name)
+				if renamedFrom != "" {
+					b.publishObserved(models.Event{Type: TypeRemoved, Filename: renamedFrom})
+				}
+				renamedFrom, renamedAt = name, now
+			}
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("file watcher error", "error", err)
+
+		case now := <-ticker.C:
+			if renamedFrom != "" && now.Sub(renamedAt) > renameWindow {
+				// Moved out of the directory
+				b.publishObserved(models.Event{Type: TypeRemoved, Filename: renamedFrom})
+				renamedFrom = ""
+			}
+			for name, c := range pending {
+				if now.Sub(c.last) < settleDelay {
+					continue
+				}
+				delete(pending, name)
+
+				info, err := os.Stat(filepath.Join(dir, name))
+				if err != nil {
+					continue
+				}
+				e := models.Event{Type: TypeModified, Filename: name}
+				if c.created {
+					e.Type = TypeAdded
+				}
+				if !info.IsDir() {
+					e.Size = info.Size()
+				}
+				b.publishObserved(e)
+			}
+		}
+	}
+}
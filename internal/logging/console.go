@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorGray   = "\033[90m"
+)
+
+// consoleHandler writes one human-readable line per record:
+//
+//	15:04:05 INFO  request method=GET path=/api/files status=200
+//
+// Values containing spaces or quotes are quoted. When color is enabled the
+// level and any "status" attribute are colored by severity.
+type consoleHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	color bool
+
+	// attrs holds preformatted attributes added with WithAttrs
+	attrs  string
+	prefix string
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler, color bool) *consoleHandler {
+	return &consoleHandler{
+		w:     w,
+		mu:    &sync.Mutex{},
+		level: level,
+		color: color,
+	}
+}
+
+// Enabled reports whether records at level are written
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle formats and writes a record
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	if !r.Time.IsZero() {
+		b.WriteString(h.paint(colorGray, r.Time.Format(time.TimeOnly)))
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(h.paint(levelColor(r.Level), fmt.Sprintf("%-5s", r.Level.String())))
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// WithAttrs returns a handler that includes attrs on every record
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		h.appendAttr(&b, h.prefix, a)
+	}
+
+	clone := *h
+	clone.attrs = h.attrs + b.String()
+	return &clone
+}
+
+// WithGroup returns a handler that qualifies subsequent attribute keys with name
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// appendAttr writes " key=value", flattening groups into dotted keys
+func (h *consoleHandler) appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(b, groupPrefix, ga)
+		}
+		return
+	}
+
+	value := formatValue(a.Value)
+	if a.Key == "status" && a.Value.Kind() == slog.KindInt64 {
+		value = h.paint(statusColor(int(a.Value.Int64())), value)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(h.paint(colorGray, prefix+a.Key+"="))
+	b.WriteString(value)
+}
+
+// paint wraps s in the given color when color output is enabled
+func (h *consoleHandler) paint(color, s string) string {
+	if !h.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// formatValue renders a value, quoting strings that would be ambiguous
+func formatValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		s := v.String()
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			return strconv.Quote(s)
+		}
+		return s
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339)
+	default:
+		return v.String()
+	}
+}
+
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return colorRed
+	case level >= slog.LevelWarn:
+		return colorYellow
+	case level >= slog.LevelInfo:
+		return colorGreen
+	default:
+		return colorGray
+	}
+}
+
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return colorRed
+	case status >= 400:
+		return colorYellow
+	case status >= 300:
+		return colorCyan
+	default:
+		return colorGreen
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Log output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// ValidFormat reports whether format names a supported output format
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// New creates a logger writing to w in the given format. Text output is
+// colored only when w is a terminal. The level is read from level on every
+// call, so it can be changed while the server runs.
+func New(w io.Writer, format string, level *slog.LevelVar) *slog.Logger {
+	if strings.ToLower(format) == FormatJSON {
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+	}
+	return slog.New(newConsoleHandler(w, level, isTerminal(w)))
+}
+
+// isTerminal reports whether w is an interactive terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
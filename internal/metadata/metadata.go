@@ -0,0 +1,266 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// FileName is the metadata index's file inside the state directory
+const FileName = "metadata.json"
+
+// Limits on the editable metadata
+const (
+	MaxDescriptionLength = 2000
+	MaxTags              = 20
+	MaxTagLength         = 50
+)
+
+var (
+	// ErrDescriptionTooLong is returned for a description over MaxDescriptionLength characters
+	ErrDescriptionTooLong = fmt.Errorf("description is longer than %d characters", MaxDescriptionLength)
+
+	// ErrInvalidTags is returned for tags breaking the limits
+	ErrInvalidTags = fmt.Errorf("use at most %d tags of up to %d characters each", MaxTags, MaxTagLength)
+)
+
+// Store keeps the metadata of shared files, persisted as a JSON object keyed
+// by file name
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]models.FileMetadata
+}
+
+// record is the metadata of a file as kept on disk, including the
+// uploader's IP address that API responses leave out
+type record struct {
+	models.FileMetadata
+	UploaderIP string `json:"uploaderIp,omitempty"`
+}
+
+// Open loads the metadata index at path, starting empty if it does not exist
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]models.FileMetadata),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata index: %w", err)
+	}
+	var records map[string]record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata index: %w", err)
+	}
+	for name, r := range records {
+		r.FileMetadata.UploaderIP = r.UploaderIP
+		s.entries[name] = r.FileMetadata
+	}
+	return s, nil
+}
+
+// Get returns the metadata recorded for the named file
+func (s *Store) Get(name string) (models.FileMetadata, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md, ok := s.entries[name]
+	return md, ok
+}
+
+// Set replaces the metadata of the named file
+func (s *Store) Set(name string, md models.FileMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[name] = md
+	return s.save()
+}
+
+// RecordUpload sets the metadata of a newly uploaded file. A file uploaded
+// over an existing one keeps its description and tags unless md has its own.
+func (s *Store) RecordUpload(name string, md models.FileMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.entries[name]; ok {
+		if md.Description == "" {
+			md.Description = prev.Description
+		}
+		if len(md.Tags) == 0 {
+			md.Tags = prev.Tags
+		}
+	}
+	s.entries[name] = md
+	return s.save()
+}
+
+// Update applies the changes in req to the named file's metadata, creating
+// it if none is recorded
+func (s *Store) Update(name string, req models.MetadataUpdateRequest) (models.FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md := s.entries[name]
+	if err := Apply(&md, req); err != nil {
+		return models.FileMetadata{}, err
+	}
+	s.entries[name] = md
+	return md, s.save()
+}
+
+// Remove forgets the metadata of the named file, returning what was recorded
+func (s *Store) Remove(name string) (*models.FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md, ok := s.entries[name]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.entries, name)
+	return &md, s.save()
+}
+
+// Rename moves the metadata recorded for oldName to newName
+func (s *Store) Rename(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md, ok := s.entries[oldName]
+	if !ok {
+		// The new name must not keep the metadata of a file it replaced
+		if _, ok := s.entries[newName]; !ok {
+			return nil
+		}
+		delete(s.entries, newName)
+		return s.save()
+	}
+	delete(s.entries, oldName)
+	s.entries[newName] = md
+	return s.save()
+}
+
+// Prune drops entries for files that no longer exist in dir
+func (s *Store) Prune(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for name := range s.entries {
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			delete(s.entries, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the index atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	records := make(map[string]record, len(s.entries))
+	for name, md := range s.entries {
+		records[name] = record{FileMetadata: md, UploaderIP: md.UploaderIP}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save metadata index: %w", err)
+	}
+	return nil
+}
+
+// New returns the metadata of a file just uploaded by uploader from
+// clientIP, with its MIME type detected from its name and content
+func New(filePath, uploader, clientIP, originalName string) models.FileMetadata {
+	now := time.Now().UTC()
+	return models.FileMetadata{
+		Uploader:         uploader,
+		UploaderIP:       clientIP,
+		UploadedAt:       &now,
+		OriginalFilename: originalName,
+		MIMEType:         DetectType(filePath),
+	}
+}
+
+// DetectType returns the MIME type of the file at filePath, from its
+// extension or else from its first bytes
+func DetectType(filePath string) string {
+	if t := mime.TypeByExtension(filepath.Ext(filePath)); t != "" {
+		return t
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// Apply checks the changes in req against the limits and applies them to md
+func Apply(md *models.FileMetadata, req models.MetadataUpdateRequest) error {
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if len([]rune(description)) > MaxDescriptionLength {
+			return ErrDescriptionTooLong
+		}
+		md.Description = description
+	}
+	if req.Tags != nil {
+		tags, err := NormalizeTags(*req.Tags)
+		if err != nil {
+			return err
+		}
+		md.Tags = tags
+	}
+	return nil
+}
+
+// NormalizeTags trims tags, drops empty and repeated ones, and checks them
+// against the limits. Tags compare case-insensitively; the first spelling wins.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		if len([]rune(tag)) > MaxTagLength {
+			return nil, ErrInvalidTags
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTags {
+		return nil, ErrInvalidTags
+	}
+	return normalized, nil
+}
@@ -0,0 +1,41 @@
+package metadata
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+)
+
+func TestUploaderIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := models.FileMetadata{Uploader: "alice", UploaderIP: "192.168.1.20"}
+	if err := s.RecordUpload("a.txt", md); err != nil {
+		t.Fatal(err)
+	}
+
+	// The address is kept across restarts
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get("a.txt")
+	if !ok || got.UploaderIP != md.UploaderIP || got.Uploader != md.Uploader {
+		t.Fatalf("reopened metadata = %+v, want %+v", got, md)
+	}
+
+	// but never sent to file clients
+	data, err := json.Marshal(models.FileInfo{Name: "a.txt", Metadata: &got})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), md.UploaderIP) {
+		t.Errorf("file listing JSON %s includes the uploader's IP", data)
+	}
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "localshare"
+
+// Transfer directions
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Metrics holds the Prometheus collectors for one server. All methods are
+// safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	bytes           *prometheus.CounterVec
+	activeTransfers *prometheus.GaugeVec
+	authFailures    *prometheus.CounterVec
+}
+
+// New creates the server's metrics, including storage gauges that are
+// measured on the upload directory at scrape time
+func New(cfg *config.Store) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route and status code.",
+		}, []string{"method", "route", "status"}),
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+		}, []string{"method", "route"}),
+
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transferred_bytes_total",
+			Help:      "Bytes uploaded and downloaded by file transfers, by protocol.",
+		}, []string{"protocol", "direction"}),
+
+		activeTransfers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_transfers",
+			Help:      "Uploads and downloads currently in progress, by protocol.",
+		}, []string{"protocol", "direction"}),
+
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Failed PIN, admin, S3 signature and SFTP login attempts, by protocol.",
+		}, []string{"protocol"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.bytes,
+		m.activeTransfers,
+		m.authFailures,
+		newStorageCollector(cfg),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+	})
+}
+
+// ObserveRequest records a completed HTTP request
+func (m *Metrics) ObserveRequest(method, route string, status int, seconds float64) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(seconds)
+}
+
+// AddBytes counts file bytes moved in the given direction
+func (m *Metrics) AddBytes(protocol, direction string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.bytes.WithLabelValues(protocol, direction).Add(float64(n))
+}
+
+// StartTransfer marks a transfer as active and returns a function that marks it finished
+func (m *Metrics) StartTransfer(protocol, direction string) (done func()) {
+	if m == nil {
+		return func() {}
+	}
+	gauge := m.activeTransfers.WithLabelValues(protocol, direction)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// AuthFailed counts a rejected login or request signature
+func (m *Metrics) AuthFailed(protocol string) {
+	if m == nil {
+		return
+	}
+	m.authFailures.WithLabelValues(protocol).Inc()
+}
+
+// storageCollector reports the size of the upload directory and the free
+// space on its filesystem each time metrics are scraped
+type storageCollector struct {
+	config *config.Store
+
+	usedBytes  *prometheus.Desc
+	files      *prometheus.Desc
+	freeBytes  *prometheus.Desc
+	totalBytes *prometheus.Desc
+}
+
+func newStorageCollector(cfg *config.Store) *storageCollector {
+	return &storageCollector{
+		config:     cfg,
+		usedBytes:  prometheus.NewDesc(namespace+"_upload_dir_bytes", "Total size of shared files.", nil, nil),
+		files:      prometheus.NewDesc(namespace+"_upload_dir_files", "Number of shared files.", nil, nil),
+		freeBytes:  prometheus.NewDesc(namespace+"_disk_free_bytes", "Free space on the upload directory's filesystem.", nil, nil),
+		totalBytes: prometheus.NewDesc(namespace+"_disk_total_bytes", "Size of the upload directory's filesystem.", nil, nil),
+	}
+}
+
+// Describe sends the collector's metric descriptions
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.usedBytes
+	ch <- c.files
+	ch <- c.freeBytes
+	ch <- c.totalBytes
+}
+
+// Collect measures the upload directory and its filesystem
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	uploadDir := c.config.Get().UploadDir
+
+	if files, err := fileutil.ListFiles(uploadDir); err == nil {
+		var used int64
+		for _, f := range files {
+			used += f.Size
+		}
+		ch <- prometheus.MustNewConstMetric(c.usedBytes, prometheus.GaugeValue, float64(used))
+		ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, float64(len(files)))
+	}
+
+	if usage, err := fileutil.GetDiskUsage(uploadDir); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.freeBytes, prometheus.GaugeValue, float64(usage.Free))
+		ch <- prometheus.MustNewConstMetric(c.totalBytes, prometheus.GaugeValue, float64(usage.Total))
+	}
+}
@@ -8,6 +8,89 @@ type FileInfo struct {
 	Size         int64     `json:"size"`
 	ModifiedTime time.Time `json:"modifiedTime"`
 	IsDir        bool      `json:"isDir"`
+
+	// ExpiresAt is when the retention policy will remove the file, if ever
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// SHA256 and BLAKE3 are the content checksums in hex, once computed
+	SHA256 string `json:"sha256,omitempty"`
+	BLAKE3 string `json:"blake3,omitempty"`
+	// Metadata describes who uploaded the file and what it is, if recorded
+	Metadata *FileMetadata `json:"metadata,omitempty"`
+}
+
+// FileMetadata is what LocalShare records about a file beyond its content
+type FileMetadata struct {
+	Uploader         string     `json:"uploader,omitempty"`
+	UploadedAt       *time.Time `json:"uploadedAt,omitempty"`
+	OriginalFilename string     `json:"originalFilename,omitempty"`
+	MIMEType         string     `json:"mimeType,omitempty"`
+	Description      string     `json:"description,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+
+	// UploaderIP is kept out of responses to file clients; admins find it
+	// in the audit trail and on trashed files
+	UploaderIP string `json:"-"`
+}
+
+// MetadataUpdateRequest changes the editable metadata of a file. Omitted
+// fields are left unchanged.
+type MetadataUpdateRequest struct {
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+// TextPreview represents the start of a text file, decoded to UTF-8
+type TextPreview struct {
+	Name string `json:"name"`
+	// Language names the syntax to highlight Content with, if known
+	Language string `json:"language,omitempty"`
+	// Encoding is the encoding the file was detected to be in
+	Encoding string `json:"encoding"`
+	Size     int64  `json:"size"`
+	// Lines counts the lines in the whole file, PreviewLines those in Content
+	Lines        int    `json:"lines"`
+	PreviewLines int    `json:"previewLines"`
+	Truncated    bool   `json:"truncated"`
+	Content      string `json:"content"`
+	// HTML is Content rendered as sanitized HTML, for Markdown files
+	HTML string `json:"html,omitempty"`
+}
+
+// ArchiveEntry represents a file, directory or symbolic link inside an archive
+type ArchiveEntry struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	IsDir        bool      `json:"isDir"`
+	Symlink      bool      `json:"symlink,omitempty"`
+}
+
+// ArchiveListResponse represents the entries of an archive. Skipped counts
+// entries left out because their names are unsafe or they are neither
+// files, directories nor symbolic links.
+type ArchiveListResponse struct {
+	Format    string         `json:"format"`
+	Entries   []ArchiveEntry `json:"entries"`
+	TotalSize int64          `json:"totalSize"`
+	Skipped   int            `json:"skipped"`
+}
+
+// Event represents a change to the shared files, or the progress of an
+// upload, sent to clients watching for changes
+type Event struct {
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+	// NewName is where a renamed file went
+	NewName string `json:"newName,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	// UploadID identifies an upload across its progress events; it is the
+	// upload request's X-Request-ID
+	UploadID string `json:"uploadId,omitempty"`
+	// Received counts the bytes of an upload received so far, out of
+	// Expected if the size is known
+	Received int64     `json:"received,omitempty"`
+	Expected int64     `json:"expected,omitempty"`
+	Time     time.Time `json:"time"`
 }
 
 // PINRequest represents a PIN verification request
@@ -26,12 +109,87 @@ type ConfigResponse struct {
 	PINProtected  bool  `json:"pinProtected"`
 	AdminRequired bool  `json:"adminRequired"`
 	MaxFileSize   int64 `json:"maxFileSize"`
+
+	// Storage is omitted if usage could not be measured
+	Storage *StorageUsage `json:"storage,omitempty"`
+}
+
+// StorageUsage reports how much of the available storage is in use
+type StorageUsage struct {
+	UsedBytes  int64 `json:"usedBytes"`
+	QuotaBytes int64 `json:"quotaBytes"`
+	FreeBytes  int64 `json:"freeBytes"`
+}
+
+// AdminStats summarizes the shared files and the disk space they take up
+type AdminStats struct {
+	Files      int        `json:"files"`
+	TotalBytes int64      `json:"totalBytes"`
+	Dedup      DedupStats `json:"dedup"`
+}
+
+// DedupStats describes the content store. References count every file
+// linked to stored content, including trashed files and kept versions.
+type DedupStats struct {
+	Enabled     bool  `json:"enabled"`
+	Objects     int   `json:"objects"`
+	References  int   `json:"references"`
+	StoredBytes int64 `json:"storedBytes"`
+	SavedBytes  int64 `json:"savedBytes"`
+}
+
+// AdminSettings represents the settings an admin can change at runtime. The
+// PIN itself is never sent back, only whether one is set.
+type AdminSettings struct {
+	PINSet        bool  `json:"pinSet"`
+	AdminAuth     bool  `json:"adminAuth"`
+	MaxFileSizeMB int64 `json:"maxFileSizeMB"`
+}
+
+// AdminSettingsRequest represents a partial settings update; omitted fields are left unchanged
+type AdminSettingsRequest struct {
+	PIN           *string `json:"pin"`
+	AdminAuth     *bool   `json:"adminAuth"`
+	MaxFileSizeMB *int64  `json:"maxFileSizeMB"`
+}
+
+// AdminSettingsResponse represents the current settings and whether the last change was saved to disk
+type AdminSettingsResponse struct {
+	Settings  AdminSettings `json:"settings"`
+	Persisted bool          `json:"persisted"`
+	Message   string        `json:"message,omitempty"`
 }
 
 // UploadResponse represents the response after a successful upload
 type UploadResponse struct {
-	Message  string `json:"message"`
-	Filename string `json:"filename"`
+	Message   string     `json:"message"`
+	Filename  string     `json:"filename"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	SHA256    string     `json:"sha256,omitempty"`
+	BLAKE3    string     `json:"blake3,omitempty"`
+	// Extracted is set when an uploaded archive was unpacked instead of stored
+	Extracted *ExtractResult `json:"extracted,omitempty"`
+}
+
+// ExtractRequest represents a request to unpack an archive. An empty target
+// unpacks into a folder named after the archive.
+type ExtractRequest struct {
+	Target string `json:"target"`
+}
+
+// ExtractResult represents what was unpacked from an archive, and the new
+// folder it went into
+type ExtractResult struct {
+	Target string `json:"target"`
+	Files  int    `json:"files"`
+	Dirs   int    `json:"dirs"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// ExtractResponse represents the response after unpacking a stored archive
+type ExtractResponse struct {
+	Message   string        `json:"message"`
+	Extracted ExtractResult `json:"extracted"`
 }
 
 // ErrorResponse represents an error response
@@ -47,5 +205,82 @@ type SuccessResponse struct {
 
 // FilesListResponse represents a list of files
 type FilesListResponse struct {
+	// Path is the folder listed, empty for the upload directory
+	Path  string     `json:"path,omitempty"`
+	Files []FileInfo `json:"files"`
+}
+
+// SearchResponse represents the files matching a search
+type SearchResponse struct {
 	Files []FileInfo `json:"files"`
-}
\ No newline at end of file
+	Total int        `json:"total"`
+}
+
+// AuditEvent represents one recorded file operation or login attempt
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Protocol string    `json:"protocol"`
+	Actor    string    `json:"actor,omitempty"`
+	ClientIP string    `json:"clientIp,omitempty"`
+	Filename string    `json:"filename,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+}
+
+// AuditResponse represents a page of audit events, newest first
+type AuditResponse struct {
+	Events    []AuditEvent `json:"events"`
+	Truncated bool         `json:"truncated"`
+}
+
+// HealthCheck represents the outcome of one readiness check
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthResponse represents the overall health and each check that contributed to it
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// TrashItem represents a deleted file kept in the trash
+type TrashItem struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"originalPath"`
+	Size         int64     `json:"size"`
+	DeletedBy    string    `json:"deletedBy,omitempty"`
+	ClientIP     string    `json:"clientIp,omitempty"`
+	DeletedAt    time.Time `json:"deletedAt"`
+
+	// PurgeAt is when the file will be deleted permanently
+	PurgeAt *time.Time `json:"purgeAt,omitempty"`
+
+	// Metadata is restored along with the file
+	Metadata *FileMetadata `json:"metadata,omitempty"`
+	// UploaderIP is the address the file was uploaded from, which Metadata
+	// does not carry in JSON
+	UploaderIP string `json:"uploaderIp,omitempty"`
+}
+
+// TrashListResponse represents the contents of the trash, most recently deleted first
+type TrashListResponse struct {
+	Items []TrashItem `json:"items"`
+}
+
+// FileVersion represents a previous content of a file, kept when it was overwritten
+type FileVersion struct {
+	ID           string    `json:"id"`
+	Size         int64     `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	ReplacedAt   time.Time `json:"replacedAt"`
+}
+
+// VersionListResponse represents the kept versions of a file, newest first
+type VersionListResponse struct {
+	Filename string        `json:"filename"`
+	Versions []FileVersion `json:"versions"`
+}
@@ -0,0 +1,53 @@
+package preview
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the language names used by common
+// syntax highlighters
+var languages = map[string]string{
+	".txt": "text", ".text": "text", ".log": "log", ".csv": "csv", ".tsv": "csv",
+	".md": "markdown", ".markdown": "markdown", ".rst": "rst", ".adoc": "asciidoc",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".ini": "ini", ".conf": "ini",
+	".xml": "xml", ".html": "html", ".htm": "html", ".css": "css", ".scss": "scss",
+	".go": "go", ".py": "python", ".rb": "ruby", ".rs": "rust", ".java": "java", ".kt": "kotlin", ".swift": "swift",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".hpp": "cpp", ".cc": "cpp", ".cs": "csharp",
+	".js": "javascript", ".jsx": "jsx", ".ts": "typescript", ".tsx": "tsx", ".vue": "vue", ".svelte": "svelte",
+	".php": "php", ".pl": "perl", ".lua": "lua", ".sh": "bash", ".bash": "bash", ".zsh": "bash", ".ps1": "powershell",
+	".sql": "sql", ".r": "r", ".tex": "latex",
+}
+
+// languageNames maps well-known file names without a telling extension to
+// their language
+var languageNames = map[string]string{
+	"dockerfile":  "dockerfile",
+	"makefile":    "makefile",
+	"gemfile":     "ruby",
+	"go.mod":      "go",
+	".gitignore":  "text",
+	".env":        "ini",
+	"readme":      "text",
+	"license":     "text",
+	"changelog":   "text",
+	"caddyfile":   "text",
+	"jenkinsfile": "groovy",
+}
+
+// Language returns the language of the named file for syntax highlighting,
+// or an empty string if it is not known. Rotated logs such as app.log.1 are
+// recognized as logs.
+func Language(name string) string {
+	lower := strings.ToLower(name)
+	if lang, ok := languageNames[lower]; ok {
+		return lang
+	}
+	if lang, ok := languages[filepath.Ext(lower)]; ok {
+		return lang
+	}
+	if strings.Contains(lower, ".log.") {
+		return "log"
+	}
+	return ""
+}
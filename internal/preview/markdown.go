@@ -0,0 +1,41 @@
+package preview
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	// markdown converts GitHub Flavored Markdown. Raw HTML in the source is
+	// left out.
+	markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	// sanitizer keeps only the formatting, links and images Markdown
+	// produces, in case anything unsafe got through
+	sanitizer = newSanitizer()
+)
+
+// newSanitizer allows what user-generated content usually may contain, plus
+// the disabled checkboxes of task lists
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// RenderMarkdown converts Markdown to sanitized HTML, safe to insert into a
+// page
+func RenderMarkdown(source string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		// Conversion only fails when writing to buf does
+		return ""
+	}
+	return sanitizer.Sanitize(buf.String())
+}
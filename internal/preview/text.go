@@ -0,0 +1,203 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+	xencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Number of bytes of a file previewed by default and at most
+const (
+	DefaultLimit = 64 << 10
+	MaxLimit     = 1 << 20
+)
+
+// Encodings text is detected in. Text that is neither UTF-8 nor marked as
+// UTF-16 is taken to be Windows-1252, a superset of Latin-1.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+)
+
+// sniffLength is how much of a file is checked for NUL bytes, which only
+// binary files and UTF-16 text contain
+const sniffLength = 8192
+
+// ErrBinary is returned for files that are not text
+var ErrBinary = errors.New("file is not text")
+
+// Text reads up to limit bytes from the start of a text file, decoded to
+// UTF-8. Markdown files are also rendered as sanitized HTML. The line count
+// covers the whole file, which is read to the end only when truncated.
+func Text(filePath string, limit int) (*models.TextPreview, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	truncated := info.Size() > int64(len(data))
+
+	encoding := detectEncoding(data)
+	if encoding == "" {
+		return nil, ErrBinary
+	}
+	content, err := decode(data, encoding, truncated)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		// End on a whole line where there is one
+		if i := strings.LastIndexByte(content, '\n'); i >= 0 {
+			content = content[:i+1]
+		}
+	}
+
+	previewLines := countLines(content)
+	lines := previewLines
+	if truncated {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if lines, err = countFileLines(f, encoding); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &models.TextPreview{
+		Name:         info.Name(),
+		Language:     Language(info.Name()),
+		Encoding:     encoding,
+		Size:         info.Size(),
+		Lines:        lines,
+		PreviewLines: previewLines,
+		Truncated:    truncated,
+		Content:      content,
+	}
+	if p.Language == "markdown" {
+		p.HTML = RenderMarkdown(content)
+	}
+	return p, nil
+}
+
+// detectEncoding returns the encoding of text starting with data, or an
+// empty string if it looks binary
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE
+	case bytes.IndexByte(data[:min(len(data), sniffLength)], 0) >= 0:
+		return ""
+	case utf8.Valid(trimPartialRune(data)):
+		return EncodingUTF8
+	default:
+		return EncodingWindows1252
+	}
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of data,
+// where reading stopped partway through a character
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax-1 && len(data) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size != 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// decode converts data in encoding to UTF-8 without any byte order mark.
+// Data cut short may end partway through a character, which is dropped.
+func decode(data []byte, encoding string, truncated bool) (string, error) {
+	switch encoding {
+	case EncodingUTF8:
+		data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+		if truncated {
+			data = trimPartialRune(data)
+		}
+		return string(data), nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if truncated && len(data)%2 == 1 {
+			data = data[:len(data)-1]
+		}
+		out, err := utf16(encoding).NewDecoder().Bytes(data)
+		return string(out), err
+	default:
+		out, err := charmap.Windows1252.NewDecoder().Bytes(data)
+		return string(out), err
+	}
+}
+
+// utf16 returns the UTF-16 variant named by encoding, which strips the byte
+// order mark when decoding
+func utf16(encoding string) xencoding.Encoding {
+	if encoding == EncodingUTF16BE {
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+	return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+}
+
+// countFileLines counts the lines of text in encoding read from r. A last
+// line without a newline counts too.
+func countFileLines(r io.Reader, encoding string) (int, error) {
+	// Every other encoding has the newline as a byte of its own
+	if encoding == EncodingUTF16LE || encoding == EncodingUTF16BE {
+		r = utf16(encoding).NewDecoder().Reader(r)
+	}
+
+	buf := make([]byte, 64<<10)
+	lines := 0
+	empty := true
+	var last byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+			empty = false
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !empty && last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+// countLines counts the lines of text. A last line without a newline counts too.
+func countLines(text string) int {
+	lines := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+	return lines
+}
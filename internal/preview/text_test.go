@@ -0,0 +1,77 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextLines(t *testing.T) {
+	utf16le := func(s string) string {
+		b := []byte{0xFF, 0xFE}
+		for _, r := range s {
+			b = append(b, byte(r), 0)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name             string
+		data             string
+		limit            int
+		wantLines        int
+		wantPreviewLines int
+		wantTruncated    bool
+	}{
+		{
+			name:             "whole file",
+			data:             "one\ntwo\nthree",
+			limit:            1024,
+			wantLines:        3,
+			wantPreviewLines: 3,
+		},
+		{
+			name:             "truncated file",
+			data:             strings.Repeat("line\n", 100),
+			limit:            22,
+			wantLines:        100,
+			wantPreviewLines: 4,
+			wantTruncated:    true,
+		},
+		{
+			name:             "truncated without a final newline",
+			data:             strings.Repeat("line\n", 9) + "last",
+			limit:            12,
+			wantLines:        10,
+			wantPreviewLines: 2,
+			wantTruncated:    true,
+		},
+		{
+			name:             "truncated utf-16",
+			data:             utf16le(strings.Repeat("line\n", 50)),
+			limit:            42,
+			wantLines:        50,
+			wantPreviewLines: 4,
+			wantTruncated:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := Text(path, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Lines != tt.wantLines || p.PreviewLines != tt.wantPreviewLines || p.Truncated != tt.wantTruncated {
+				t.Errorf("lines = %d, previewLines = %d, truncated = %v, want %d, %d, %v",
+					p.Lines, p.PreviewLines, p.Truncated, tt.wantLines, tt.wantPreviewLines, tt.wantTruncated)
+			}
+		})
+	}
+}
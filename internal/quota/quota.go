@@ -0,0 +1,279 @@
+package quota
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// measureMaxAge is how long the guard projects storage use from the bytes
+// uploads write before scanning the upload directory and filesystem again
+const measureMaxAge = time.Minute
+
+// usageMaxAge is how long Usage reports a measurement before measuring again
+const usageMaxAge = 30 * time.Second
+
+// keptDirs are the state directories holding deleted files and earlier
+// versions, which take up space like shared files until they are purged
+var keptDirs = []string{"trash", "versions"}
+
+var (
+	// ErrQuotaExceeded is returned when an upload would push the shared
+	// files past the configured storage quota
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+	// ErrInsufficientSpace is returned when an upload would eat into the
+	// free-space reserve of the upload directory's filesystem
+	ErrInsufficientSpace = errors.New("insufficient free disk space")
+)
+
+// Usage describes how much storage the share is using
+type Usage struct {
+	// Used is the total size of the shared files, deleted files in the
+	// trash and kept versions, in bytes
+	Used int64
+	// Quota is the storage quota in bytes, or 0 when unlimited
+	Quota int64
+	// Free is the space left on the filesystem, in bytes
+	Free int64
+}
+
+// Guard enforces the storage quota and free-space reserve across all
+// concurrent uploads. Uploads are staged outside the shared files, so bytes
+// written by transfers still in progress are tracked here and counted
+// against the quota alongside the files already stored.
+type Guard struct {
+	config *config.Store
+
+	mu       sync.Mutex
+	inflight int64
+
+	// Storage use is measured now and then and kept as a running total in
+	// between: finished uploads are counted as stored and every byte
+	// written as taken from the free space. Deleted and discarded files
+	// are only noticed by the next measurement, which is taken before
+	// turning an upload away.
+	measured   bool
+	measuredAt time.Time
+	used       int64
+	free       int64
+	hasFree    bool
+	stored     int64
+	written    int64
+
+	// usage caches what Usage reports, so clients polling it do not each
+	// walk the upload directory
+	usageMu sync.Mutex
+	usage   Usage
+	usageAt time.Time
+}
+
+// NewGuard creates a guard for the configured upload directory
+func NewGuard(cfg *config.Store) *Guard {
+	return &Guard{
+		config: cfg,
+	}
+}
+
+// Usage reports storage use, measured at most usageMaxAge ago
+func (g *Guard) Usage() (Usage, error) {
+	g.usageMu.Lock()
+	defer g.usageMu.Unlock()
+
+	if !g.usageAt.IsZero() && time.Since(g.usageAt) < usageMaxAge {
+		return g.usage, nil
+	}
+
+	cfg := g.config.Get()
+
+	used, err := fileutil.TotalSize(cfg.UploadDir, keptDirs...)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage := Usage{Used: used, Quota: cfg.QuotaBytes()}
+
+	if disk, err := fileutil.GetDiskUsage(cfg.UploadDir); err == nil {
+		usage.Free = int64(disk.Free)
+	}
+
+	g.usage, g.usageAt = usage, time.Now()
+	return usage, nil
+}
+
+// Reserve checks that an upload of expected bytes fits and starts tracking
+// it. Pass 0 when the size is not known in advance; the limits are then
+// enforced as data arrives. The reservation must be released when the
+// transfer ends, whether or not it succeeded.
+func (g *Guard) Reserve(expected int64) (*Reservation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.check(expected); err != nil {
+		return nil, err
+	}
+	return &Reservation{guard: g}, nil
+}
+
+// check reports whether n more bytes fit. The caller must hold g.mu.
+func (g *Guard) check(n int64) error {
+	if !g.measured || time.Since(g.measuredAt) >= measureMaxAge {
+		if err := g.measure(); err != nil {
+			return err
+		}
+		return g.fits(n)
+	}
+
+	// Files may have been removed since the last measurement, so confirm
+	// before turning an upload away
+	if err := g.fits(n); err != nil {
+		if err := g.measure(); err != nil {
+			return err
+		}
+		return g.fits(n)
+	}
+	return nil
+}
+
+// fits compares the last measurement, plus what was stored and written
+// since, with the configured limits. The caller must hold g.mu.
+func (g *Guard) fits(n int64) error {
+	cfg := g.config.Get()
+
+	if quota := cfg.QuotaBytes(); quota > 0 && g.used+g.stored+g.inflight+n > quota {
+		return ErrQuotaExceeded
+	}
+
+	// Platforms without disk usage support cannot enforce a reserve
+	if reserve := cfg.MinFreeBytes(); reserve > 0 && g.hasFree && g.free-g.written-n < reserve {
+		return ErrInsufficientSpace
+	}
+
+	return nil
+}
+
+// measure scans the upload directory and filesystem. The caller must hold g.mu.
+func (g *Guard) measure() error {
+	cfg := g.config.Get()
+
+	g.used = 0
+	if cfg.QuotaBytes() > 0 {
+		// Extracted archives leave files in subdirectories
+		used, err := fileutil.TotalSize(cfg.UploadDir, keptDirs...)
+		if err != nil {
+			return err
+		}
+		g.used = used
+	}
+
+	disk, err := fileutil.GetDiskUsage(cfg.UploadDir)
+	g.free, g.hasFree = int64(disk.Free), err == nil
+
+	g.stored = 0
+	g.written = 0
+	g.measured = true
+	g.measuredAt = time.Now()
+
+	// A full measurement is as good as one made by Usage
+	if cfg.QuotaBytes() > 0 && g.hasFree {
+		g.usageMu.Lock()
+		g.usage = Usage{Used: g.used, Quota: cfg.QuotaBytes(), Free: g.free}
+		g.usageAt = time.Now()
+		g.usageMu.Unlock()
+	}
+	return nil
+}
+
+// Reservation tracks the bytes written by one upload in progress
+type Reservation struct {
+	guard *Guard
+
+	mu       sync.Mutex
+	size     int64
+	released bool
+}
+
+// Grow accounts for n more bytes about to be written, failing if they
+// would not fit
+func (r *Reservation) Grow(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g := r.guard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.check(n); err != nil {
+		return err
+	}
+
+	r.size += n
+	g.inflight += n
+	g.written += n
+	return nil
+}
+
+// Invalidate makes the next upload measure storage use again, for changes
+// made on disk outside any upload
+func (g *Guard) Invalidate() {
+	g.mu.Lock()
+	g.measured = false
+	g.mu.Unlock()
+
+	g.usageMu.Lock()
+	g.usageAt = time.Time{}
+	g.usageMu.Unlock()
+}
+
+// Release stops tracking the upload. Its bytes are counted as stored until
+// the next measurement, as most finished uploads become shared files.
+func (r *Reservation) Release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.released {
+		return
+	}
+	r.released = true
+
+	g := r.guard
+	g.mu.Lock()
+	g.inflight -= r.size
+	g.stored += r.size
+	g.mu.Unlock()
+
+	g.usageMu.Lock()
+	g.usageAt = time.Time{}
+	g.usageMu.Unlock()
+}
+
+// Writer returns a writer that grows the reservation before passing data to w
+func (r *Reservation) Writer(w io.Writer) io.Writer {
+	return &guardedWriter{w: w, r: r}
+}
+
+// guardedWriter enforces the limits on every write
+type guardedWriter struct {
+	w io.Writer
+	r *Reservation
+}
+
+func (w *guardedWriter) Write(p []byte) (int, error) {
+	if err := w.r.Grow(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// IsLimit reports whether err means an upload did not fit
+func IsLimit(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrInsufficientSpace)
+}
@@ -0,0 +1,299 @@
+package quota
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+const kb = 1024
+
+// newTestGuard returns a guard over a fresh upload directory with a 1 MB
+// quota and no free-space reserve
+func newTestGuard(t *testing.T) (*Guard, *config.Store, string) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	cfg.QuotaMB = 1
+	cfg.MinFreeMB = 0
+	store := config.NewStore(&cfg)
+	return NewGuard(store), store, cfg.UploadDir
+}
+
+// writeSized writes a file of size bytes at name, relative to dir
+func writeSized(t *testing.T, dir, name string, size int) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]int
+		expected int64
+		wantErr  error
+	}{
+		{name: "empty", expected: 512 * kb},
+		{name: "exactly the quota", expected: 1024 * kb},
+		{name: "over the quota", expected: 1024*kb + 1, wantErr: ErrQuotaExceeded},
+		{name: "with stored files", files: map[string]int{"a.bin": 600 * kb}, expected: 400 * kb},
+		{name: "stored files leave too little", files: map[string]int{"a.bin": 600 * kb}, expected: 500 * kb, wantErr: ErrQuotaExceeded},
+		{name: "files in subdirectories", files: map[string]int{"site/a.bin": 600 * kb}, expected: 500 * kb, wantErr: ErrQuotaExceeded},
+		{name: "trash counts", files: map[string]int{".localshare/trash/x/a.bin": 600 * kb}, expected: 500 * kb, wantErr: ErrQuotaExceeded},
+		{name: "versions count", files: map[string]int{".localshare/versions/v1": 600 * kb}, expected: 500 * kb, wantErr: ErrQuotaExceeded},
+		{name: "other state does not count", files: map[string]int{".localshare/thumbnails/t.jpg": 600 * kb}, expected: 500 * kb},
+		{name: "unknown size", files: map[string]int{"a.bin": 1024 * kb}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _, dir := newTestGuard(t)
+			for name, size := range tt.files {
+				writeSized(t, dir, name, size)
+			}
+
+			r, err := g.Reserve(tt.expected)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve(%d) error = %v, want %v", tt.expected, err, tt.wantErr)
+			}
+			if err == nil {
+				r.Release()
+			}
+		})
+	}
+}
+
+func TestReservationGrow(t *testing.T) {
+	g, _, _ := newTestGuard(t)
+
+	a, err := g.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := g.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent uploads share the quota
+	if err := a.Grow(600 * kb); err != nil {
+		t.Fatalf("a.Grow: %v", err)
+	}
+	if err := b.Grow(500 * kb); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("b.Grow error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := b.Grow(400 * kb); err != nil {
+		t.Fatalf("b.Grow within the quota: %v", err)
+	}
+
+	// Releasing an upload that was discarded frees its bytes
+	a.Release()
+	a.Release()
+	if err := b.Grow(500 * kb); err != nil {
+		t.Errorf("b.Grow after a was released: %v", err)
+	}
+	b.Release()
+}
+
+func TestReleaseRemeasures(t *testing.T) {
+	g, _, dir := newTestGuard(t)
+
+	r, err := g.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.Writer(&buf).Write(bytes.Repeat([]byte("x"), 700*kb)); err != nil {
+		t.Fatal(err)
+	}
+	// The upload is stored, so its bytes now count as a file
+	if err := os.WriteFile(filepath.Join(dir, "up.bin"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Release()
+
+	if _, err := g.Reserve(400 * kb); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Reserve after a stored upload: error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// Deleting it makes room again, without waiting for a new measurement
+	if err := os.Remove(filepath.Join(dir, "up.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := g.Reserve(400 * kb); err != nil {
+		t.Errorf("Reserve after the file was deleted: %v", err)
+	} else {
+		r.Release()
+	}
+}
+
+func TestRunningTotal(t *testing.T) {
+	g, _, dir := newTestGuard(t)
+
+	// Uploads in many small parts, as S3 multipart clients send them, are
+	// counted as they finish rather than each measured for
+	for i := range 8 {
+		r, err := g.Reserve(100 * kb)
+		if err != nil {
+			t.Fatalf("Reserve for part %d: %v", i, err)
+		}
+		if err := r.Grow(100 * kb); err != nil {
+			t.Fatalf("Grow for part %d: %v", i, err)
+		}
+		r.Release()
+	}
+	measuredAt := g.measuredAt
+	if r, err := g.Reserve(100 * kb); err != nil {
+		t.Fatalf("Reserve within the running total: %v", err)
+	} else {
+		r.Release()
+	}
+	if !g.measuredAt.Equal(measuredAt) {
+		t.Error("an upload that fits the running total measured storage again")
+	}
+
+	// A file copied in by hand is noticed once the watcher reports it
+	writeSized(t, dir, "copied.bin", 300*kb)
+	g.Invalidate()
+	if _, err := g.Reserve(100 * kb); err != nil {
+		t.Errorf("Reserve after invalidating: %v", err)
+	}
+	if g.stored != 0 || g.used != 300*kb {
+		t.Errorf("after invalidating, used = %d and stored = %d, want a fresh measurement of %d", g.used, g.stored, 300*kb)
+	}
+
+	// and in any case by the periodic measurement
+	writeSized(t, dir, "later.bin", 300*kb)
+	g.measuredAt = g.measuredAt.Add(-measureMaxAge)
+	if _, err := g.Reserve(0); err != nil {
+		t.Fatal(err)
+	}
+	if g.used != 600*kb {
+		t.Errorf("after the periodic measurement, used = %d, want %d", g.used, 600*kb)
+	}
+}
+
+func TestGuardedWriter(t *testing.T) {
+	g, _, _ := newTestGuard(t)
+	r, err := g.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+	if _, err := w.Write(make([]byte, 1000*kb)); err != nil {
+		t.Fatalf("Write within the quota: %v", err)
+	}
+	n, err := w.Write(make([]byte, 100*kb))
+	if !IsLimit(err) || n != 0 {
+		t.Errorf("Write over the quota = %d, %v; want 0, a limit error", n, err)
+	}
+	if buf.Len() != 1000*kb {
+		t.Errorf("underlying writer got %d bytes, want %d", buf.Len(), 1000*kb)
+	}
+}
+
+func TestDeduplicatedContentCountsOnce(t *testing.T) {
+	g, _, dir := newTestGuard(t)
+	a := writeSized(t, dir, "a.bin", 400*kb)
+	// Hard-linked files share one copy of their content
+	objects, err := fileutil.StateDir(dir, "objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{filepath.Join(dir, "b.bin"), filepath.Join(dir, "c.bin"), filepath.Join(objects, "obj")} {
+		if err := os.Link(a, link); err != nil {
+			t.Skipf("hard links unsupported: %v", err)
+		}
+	}
+
+	r, err := g.Reserve(600 * kb)
+	if err != nil {
+		t.Fatalf("Reserve with one copy of the content stored: %v", err)
+	}
+	r.Release()
+
+	usage, err := g.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 400*kb {
+		t.Errorf("Used = %d, want %d", usage.Used, 400*kb)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	g, store, dir := newTestGuard(t)
+	writeSized(t, dir, "a.bin", 2048*kb)
+	store.Update(func(next *config.Config) error {
+		next.QuotaMB = 0
+		return nil
+	})
+
+	r, err := g.Reserve(10 * 1024 * kb)
+	if err != nil {
+		t.Fatalf("Reserve without a quota: %v", err)
+	}
+	r.Release()
+}
+
+func TestFreeSpaceReserve(t *testing.T) {
+	g, store, _ := newTestGuard(t)
+	disk, err := fileutil.GetDiskUsage(store.Get().UploadDir)
+	if err != nil {
+		t.Skipf("disk usage unsupported: %v", err)
+	}
+	store.Update(func(next *config.Config) error {
+		next.QuotaMB = 0
+		// More than the filesystem has free
+		next.MinFreeMB = int64(disk.Free)/(1024*1024) + 1
+		return nil
+	})
+
+	if _, err := g.Reserve(1); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("Reserve error = %v, want ErrInsufficientSpace", err)
+	}
+}
+
+func TestUsageCached(t *testing.T) {
+	g, _, dir := newTestGuard(t)
+	writeSized(t, dir, "a.bin", 100*kb)
+
+	first, err := g.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Used != 100*kb || first.Quota != 1024*kb {
+		t.Fatalf("Usage = %+v, want 100 KB used of 1 MB", first)
+	}
+
+	// Files changed outside an upload are picked up once the cache expires
+	writeSized(t, dir, "b.bin", 100*kb)
+	if cached, _ := g.Usage(); cached.Used != first.Used {
+		t.Errorf("cached Used = %d, want %d", cached.Used, first.Used)
+	}
+
+	// A finished upload invalidates it
+	r, err := g.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Release()
+	if fresh, _ := g.Usage(); fresh.Used != 200*kb {
+		t.Errorf("Used after an upload = %d, want %d", fresh.Used, 200*kb)
+	}
+}
@@ -0,0 +1,186 @@
+package retention
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// Actor is recorded in the audit trail for files the janitor removes
+const Actor = "retention"
+
+// ErrInvalidTTL is returned for a TTL that is not a positive duration
+var ErrInvalidTTL = errors.New("use a positive duration such as 12h or 7d")
+
+// ParseTTL parses a TTL given as a Go duration ("90m", "36h") or a whole
+// number of days ("7d")
+func ParseTTL(s string) (time.Duration, error) {
+	var ttl time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, ErrInvalidTTL
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, ErrInvalidTTL
+		}
+		ttl = d
+	}
+
+	if ttl <= 0 {
+		return 0, ErrInvalidTTL
+	}
+	return ttl, nil
+}
+
+// Expiry returns when f will be removed: the earlier of the expiry its
+// uploader chose and the end of the configured maximum age. It returns nil
+// for files kept indefinitely. Eviction to respect the total size limit is
+// not predictable and is not included.
+func Expiry(cfg *config.Config, store *Store, f models.FileInfo) *time.Time {
+	if f.IsDir {
+		return nil
+	}
+
+	expires, _ := store.ExpiresAt(f.Name, f.ModifiedTime)
+	if maxAge := cfg.RetentionMaxAge(); maxAge > 0 {
+		byAge := f.ModifiedTime.Add(maxAge)
+		if expires.IsZero() || byAge.Before(expires) {
+			expires = byAge
+		}
+	}
+
+	if expires.IsZero() {
+		return nil
+	}
+	return &expires
+}
+
+// Janitor removes files that have expired or that push the share past its
+// total size limit. Files it removes go the way of any other delete: to the
+// trash, out of the search index and checksums, announced to clients and
+// recorded in the audit trail.
+type Janitor struct {
+	config    *config.Store
+	store     *Store
+	audit     *audit.Log
+	trash     *trash.Bin
+	index     *search.Index
+	checksums *checksum.Store
+	events    *events.Broker
+}
+
+// NewJanitor creates a janitor enforcing the configured retention policy
+func NewJanitor(cfg *config.Store, store *Store, auditLog *audit.Log, bin *trash.Bin, index *search.Index, checksums *checksum.Store, broker *events.Broker) *Janitor {
+	return &Janitor{
+		config:    cfg,
+		store:     store,
+		audit:     auditLog,
+		trash:     bin,
+		index:     index,
+		checksums: checksums,
+		events:    broker,
+	}
+}
+
+// Sweep removes every file that has expired by now, then evicts the oldest
+// remaining files and folders until the share fits within its total size
+// limit. It returns the number of files and folders removed.
+func (j *Janitor) Sweep(now time.Time) (int, error) {
+	cfg := j.config.Get()
+
+	files, err := fileutil.ListFiles(cfg.UploadDir)
+	if err != nil {
+		return 0, err
+	}
+
+	current := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		current[f.Name] = f.ModifiedTime
+	}
+	if err := j.store.prune(current); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var kept []models.FileInfo
+	var total int64
+	for _, f := range files {
+		// Folders, such as extracted archives, never expire but take up
+		// space like the files in them
+		if f.IsDir {
+			size, err := fileutil.TotalSize(filepath.Join(cfg.UploadDir, f.Name))
+			if err != nil {
+				continue
+			}
+			f.Size = size
+		} else if expires := Expiry(cfg, j.store, f); expires != nil && !now.Before(*expires) {
+			if j.remove(cfg, f, "expired") {
+				removed++
+			}
+			continue
+		}
+		kept = append(kept, f)
+		total += f.Size
+	}
+
+	maxSize := cfg.RetentionMaxSize()
+	if maxSize <= 0 || total <= maxSize {
+		return removed, nil
+	}
+
+	sort.Slice(kept, func(a, b int) bool {
+		return kept[a].ModifiedTime.Before(kept[b].ModifiedTime)
+	})
+	for _, f := range kept {
+		if total <= maxSize {
+			break
+		}
+		if j.remove(cfg, f, "total size limit") {
+			removed++
+			total -= f.Size
+		}
+	}
+
+	return removed, nil
+}
+
+// remove deletes one file or folder and records why
+func (j *Janitor) remove(cfg *config.Config, f models.FileInfo, reason string) bool {
+	if err := j.trash.Remove(filepath.Join(cfg.UploadDir, f.Name), Actor, ""); err != nil && !os.IsNotExist(err) {
+		slog.Error("retention failed to remove file", slog.String("file", f.Name), slog.String("error", err.Error()))
+		return false
+	}
+	if err := j.store.Remove(f.Name); err != nil {
+		slog.Error("retention failed to update expiry index", slog.String("error", err.Error()))
+	}
+	j.index.Remove(f.Name)
+	j.checksums.Remove(f.Name)
+
+	j.audit.Record(models.AuditEvent{
+		Action:   audit.ActionExpire,
+		Actor:    Actor,
+		Filename: f.Name,
+		Size:     f.Size,
+	})
+	j.events.Publish(models.Event{Type: events.TypeRemoved, Filename: f.Name})
+	slog.Info("file removed by retention policy", slog.String("file", f.Name), slog.String("reason", reason))
+	return true
+}
@@ -0,0 +1,411 @@
+package retention
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "90m", want: 90 * time.Minute},
+		{in: "36h", want: 36 * time.Hour},
+		{in: "7d", want: 7 * 24 * time.Hour},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "0d", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "0s", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "soon", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTTL(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidTTL) {
+				t.Errorf("ParseTTL(%q) = %v, %v; want ErrInvalidTTL", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTTL(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExpiry(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	chosen := modified.Add(2 * time.Hour)
+
+	tests := []struct {
+		name       string
+		maxAge     int
+		setExpiry  bool
+		modTime    time.Time
+		isDir      bool
+		wantExpiry time.Time
+	}{
+		{name: "kept indefinitely", modTime: modified},
+		{name: "chosen expiry", setExpiry: true, modTime: modified, wantExpiry: chosen},
+		{name: "maximum age", maxAge: 24, modTime: modified, wantExpiry: modified.Add(24 * time.Hour)},
+		{name: "chosen expiry before maximum age", maxAge: 24, setExpiry: true, modTime: modified, wantExpiry: chosen},
+		{name: "maximum age before chosen expiry", maxAge: 1, setExpiry: true, modTime: modified, wantExpiry: modified.Add(time.Hour)},
+		{name: "file replaced since", setExpiry: true, modTime: modified.Add(time.Minute)},
+		{name: "directory", maxAge: 1, isDir: true, modTime: modified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.RetentionMaxAgeHours = tt.maxAge
+			s := openTestStore(t, t.TempDir())
+			if tt.setExpiry {
+				if err := s.Set("a.txt", modified, chosen); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := Expiry(&cfg, s, models.FileInfo{Name: "a.txt", ModifiedTime: tt.modTime, IsDir: tt.isDir})
+			switch {
+			case tt.wantExpiry.IsZero() && got != nil:
+				t.Errorf("Expiry = %v, want none", *got)
+			case !tt.wantExpiry.IsZero() && (got == nil || !got.Equal(tt.wantExpiry)):
+				t.Errorf("Expiry = %v, want %v", got, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestStoreRename(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := modified.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		set     []string
+		wantOld bool
+		wantNew bool
+	}{
+		{name: "moves the expiry", set: []string{"old.txt"}, wantNew: true},
+		{name: "replaces the expiry of the target", set: []string{"old.txt", "new.txt"}, wantNew: true},
+		{name: "target does not inherit an expiry", set: []string{"new.txt"}},
+		{name: "nothing recorded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openTestStore(t, dir)
+			for _, name := range tt.set {
+				if err := s.Set(name, modified, expires); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Rename("old.txt", "new.txt"); err != nil {
+				t.Fatalf("Rename: %v", err)
+			}
+
+			// The index must survive a restart
+			for _, store := range []*Store{s, openTestStore(t, dir)} {
+				if _, ok := store.ExpiresAt("old.txt", modified); ok != tt.wantOld {
+					t.Errorf("old.txt has expiry = %v, want %v", ok, tt.wantOld)
+				}
+				if _, ok := store.ExpiresAt("new.txt", modified); ok != tt.wantNew {
+					t.Errorf("new.txt has expiry = %v, want %v", ok, tt.wantNew)
+				}
+			}
+		})
+	}
+}
+
+// sweepFile is a file in the upload directory of a sweep test. A folder
+// holds size bytes in a file within it.
+type sweepFile struct {
+	name    string
+	size    int
+	age     time.Duration
+	expires time.Duration
+	dir     bool
+}
+
+// testJanitor is a janitor over a fresh upload directory, with the stores
+// its deletes go through
+type testJanitor struct {
+	*Janitor
+	trash     *trash.Bin
+	index     *search.Index
+	checksums *checksum.Store
+	audit     *audit.Log
+	events    *events.Broker
+}
+
+func newTestJanitor(t *testing.T, cfg *config.Config, store *Store) *testJanitor {
+	t.Helper()
+	cfgStore := config.NewStore(cfg)
+	stateDir := func(name string) string {
+		dir, err := fileutil.StateDir(cfg.UploadDir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditLog, err := audit.Open(filepath.Join(stateDir("audit"), audit.FileName))
+	must(err)
+	t.Cleanup(func() { auditLog.Close() })
+	meta, err := metadata.Open(filepath.Join(stateDir("metadata"), metadata.FileName))
+	must(err)
+	bin, err := trash.Open(cfgStore, stateDir("trash"), meta)
+	must(err)
+	index, err := search.Open(cfgStore, filepath.Join(stateDir("search"), search.FileName))
+	must(err)
+	checksums, err := checksum.Open(filepath.Join(stateDir("checksums"), checksum.FileName))
+	must(err)
+	broker := events.NewBroker()
+
+	return &testJanitor{
+		Janitor:   NewJanitor(cfgStore, store, auditLog, bin, index, checksums, broker),
+		trash:     bin,
+		index:     index,
+		checksums: checksums,
+		audit:     auditLog,
+		events:    broker,
+	}
+}
+
+func TestSweep(t *testing.T) {
+	const mb = 1024 * 1024
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name       string
+		maxAge     int
+		maxSizeMB  int64
+		files      []sweepFile
+		wantKept   []string
+		wantRemove int
+	}{
+		{
+			name:     "nothing to do",
+			files:    []sweepFile{{name: "a", size: 10, age: 48 * time.Hour}},
+			wantKept: []string{"a"},
+		},
+		{
+			name: "chosen expiry",
+			files: []sweepFile{
+				{name: "expired", size: 10, age: 2 * time.Hour, expires: -time.Hour},
+				{name: "pending", size: 10, age: 2 * time.Hour, expires: time.Hour},
+			},
+			wantKept:   []string{"pending"},
+			wantRemove: 1,
+		},
+		{
+			name:   "maximum age",
+			maxAge: 24,
+			files: []sweepFile{
+				{name: "old", size: 10, age: 25 * time.Hour},
+				{name: "new", size: 10, age: time.Hour},
+			},
+			wantKept:   []string{"new"},
+			wantRemove: 1,
+		},
+		{
+			name:      "oldest evicted over the size limit",
+			maxSizeMB: 1,
+			files: []sweepFile{
+				{name: "oldest", size: mb / 2, age: 3 * time.Hour},
+				{name: "older", size: mb / 2, age: 2 * time.Hour},
+				{name: "newest", size: mb / 2, age: time.Hour},
+			},
+			wantKept:   []string{"newest", "older"},
+			wantRemove: 1,
+		},
+		{
+			name:      "expired files count before eviction",
+			maxSizeMB: 1,
+			files: []sweepFile{
+				{name: "oldest", size: mb / 2, age: 3 * time.Hour},
+				{name: "expired", size: mb / 2, age: 2 * time.Hour, expires: -time.Minute},
+				{name: "newest", size: mb / 2, age: time.Hour},
+			},
+			wantKept:   []string{"newest", "oldest"},
+			wantRemove: 1,
+		},
+		{
+			name:      "folders count toward the size limit",
+			maxSizeMB: 1,
+			files: []sweepFile{
+				{name: "site", size: mb / 2, age: 3 * time.Hour, dir: true},
+				{name: "older", size: mb / 2, age: 2 * time.Hour},
+				{name: "newest", size: mb / 2, age: time.Hour},
+			},
+			wantKept:   []string{"newest", "older"},
+			wantRemove: 1,
+		},
+		{
+			name:   "folders never expire",
+			maxAge: 1,
+			files: []sweepFile{
+				{name: "site", size: 10, age: 2 * time.Hour, dir: true},
+				{name: "old", size: 10, age: 2 * time.Hour},
+			},
+			wantKept:   []string{"site"},
+			wantRemove: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.UploadDir = t.TempDir()
+			cfg.RetentionMaxAgeHours = tt.maxAge
+			cfg.RetentionMaxSizeMB = tt.maxSizeMB
+			store := openTestStore(t, t.TempDir())
+
+			for _, f := range tt.files {
+				path := filepath.Join(cfg.UploadDir, f.name)
+				content := path
+				if f.dir {
+					if err := os.Mkdir(path, 0755); err != nil {
+						t.Fatal(err)
+					}
+					content = filepath.Join(path, "index.html")
+				}
+				if err := os.WriteFile(content, make([]byte, f.size), 0644); err != nil {
+					t.Fatal(err)
+				}
+				modTime := now.Add(-f.age)
+				if err := os.Chtimes(path, time.Time{}, modTime); err != nil {
+					t.Fatal(err)
+				}
+				if f.expires != 0 {
+					store.Set(f.name, modTime, now.Add(f.expires))
+				}
+			}
+
+			j := newTestJanitor(t, &cfg, store)
+			removed, err := j.Sweep(now)
+			if err != nil {
+				t.Fatalf("Sweep: %v", err)
+			}
+			if removed != tt.wantRemove {
+				t.Errorf("Sweep removed %d files, want %d", removed, tt.wantRemove)
+			}
+
+			files, err := fileutil.ListFiles(cfg.UploadDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, f := range files {
+				kept = append(kept, f.Name)
+			}
+			sort.Strings(kept)
+			sort.Strings(tt.wantKept)
+			if len(kept) != len(tt.wantKept) {
+				t.Fatalf("kept %v, want %v", kept, tt.wantKept)
+			}
+			for i := range kept {
+				if kept[i] != tt.wantKept[i] {
+					t.Fatalf("kept %v, want %v", kept, tt.wantKept)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepDeletes(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		trashDays int
+	}{
+		{name: "to the trash", trashDays: 30},
+		{name: "trash disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.UploadDir = t.TempDir()
+			cfg.TrashDays = tt.trashDays
+			store := openTestStore(t, t.TempDir())
+			j := newTestJanitor(t, &cfg, store)
+
+			path := filepath.Join(cfg.UploadDir, "notes.txt")
+			if err := os.WriteFile(path, []byte("quarterly report"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, _ := os.Stat(path)
+			store.Set("notes.txt", info.ModTime(), now.Add(-time.Minute))
+			j.index.Add(path)
+			j.checksums.Set(path, checksum.Sums{SHA256: "abc"})
+			sub, unsubscribe := j.events.Subscribe()
+			defer unsubscribe()
+
+			if removed, err := j.Sweep(now); err != nil || removed != 1 {
+				t.Fatalf("Sweep = %d, %v; want 1, nil", removed, err)
+			}
+
+			items := j.trash.List()
+			if want := tt.trashDays > 0; (len(items) == 1 && items[0].OriginalPath == "notes.txt" && items[0].DeletedBy == Actor) != want {
+				t.Errorf("trash = %+v, want notes.txt deleted by %s: %v", items, Actor, want)
+			}
+			if hits := j.index.Search("quarterly"); hits["notes.txt"] {
+				t.Error("notes.txt is still in the search index")
+			}
+			if _, ok := j.checksums.Get(info); ok {
+				t.Error("notes.txt still has checksums recorded")
+			}
+			select {
+			case e := <-sub:
+				if e.Type != events.TypeRemoved || e.Filename != "notes.txt" {
+					t.Errorf("event = %+v, want notes.txt removed", e)
+				}
+			default:
+				t.Error("no event announced the removal")
+			}
+			recorded, _, err := j.audit.Query(audit.Filter{Actions: []string{audit.ActionExpire}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recorded) != 1 || recorded[0].Filename != "notes.txt" {
+				t.Errorf("audit = %+v, want notes.txt expired", recorded)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// FileName is the expiry index's file inside the state directory
+const FileName = "expiry.json"
+
+// entry is the expiry an uploader chose for one file. ModTime ties it to
+// the uploaded content: once the file is replaced, by any protocol, its
+// modification time changes and the expiry no longer applies.
+type entry struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+	ModTime   time.Time `json:"modTime"`
+}
+
+// Store keeps the expiry times chosen for individual files, persisted as
+// a JSON object keyed by file name
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// Open loads the expiry index at path, starting empty if it does not exist
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expiry index: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse expiry index: %w", err)
+	}
+	return s, nil
+}
+
+// Set records that the file name, last modified at modTime, expires at expiresAt
+func (s *Store) Set(name string, modTime, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[name] = entry{ExpiresAt: expiresAt.UTC(), ModTime: modTime.UTC()}
+	return s.save()
+}
+
+// Remove forgets the expiry of name, if any
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[name]; !ok {
+		return nil
+	}
+	delete(s.entries, name)
+	return s.save()
+}
+
+// Rename moves the expiry of oldName, if any, to newName
+func (s *Store) Rename(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[oldName]
+	if !ok {
+		// The new name must not inherit the expiry of a file it replaced
+		if _, ok := s.entries[newName]; !ok {
+			return nil
+		}
+		delete(s.entries, newName)
+		return s.save()
+	}
+	delete(s.entries, oldName)
+	s.entries[newName] = e
+	return s.save()
+}
+
+// ExpiresAt returns the expiry chosen for name if it still applies to the
+// file last modified at modTime
+func (s *Store) ExpiresAt(name string, modTime time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok || !e.ModTime.Equal(modTime) {
+		return time.Time{}, false
+	}
+	return e.ExpiresAt, true
+}
+
+// prune drops entries for files that are gone or have been replaced.
+// current maps each existing file name to its modification time.
+func (s *Store) prune(current map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for name, e := range s.entries {
+		if modTime, ok := current[name]; !ok || !e.ModTime.Equal(modTime) {
+			delete(s.entries, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the index atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save expiry index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,587 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+const (
+	defaultMaxKeys = 1000
+	tmpDirName     = "s3-tmp"
+)
+
+// Handler serves a subset of the S3 REST API backed by the upload directory.
+// The configured bucket maps onto UploadDir and object keys map onto file
+// names, so only flat keys without slashes are accepted.
+type Handler struct {
+	config    *config.Store
+	audit     *audit.Log
+	metrics   *metrics.Metrics
+	quota     *quota.Guard
+	trash     *trash.Bin
+	versions  *versions.Store
+	checksums *checksum.Store
+	content   *dedup.Store
+	metadata  *metadata.Store
+	index     *search.Index
+}
+
+// NewHandler creates a new S3 API handler
+func NewHandler(cfg *config.Store, auditLog *audit.Log, m *metrics.Metrics, guard *quota.Guard, bin *trash.Bin, store *versions.Store, checksums *checksum.Store, content *dedup.Store, meta *metadata.Store, index *search.Index) *Handler {
+	return &Handler{
+		config:    cfg,
+		audit:     auditLog,
+		metrics:   m,
+		quota:     guard,
+		trash:     bin,
+		versions:  store,
+		checksums: checksums,
+		content:   content,
+		metadata:  meta,
+		index:     index,
+	}
+}
+
+// record adds an operation performed by an authenticated S3 client to the audit trail
+func (h *Handler) record(r *http.Request, e models.AuditEvent) {
+	e.Protocol = audit.ProtocolS3
+	e.Actor = h.config.Get().S3AccessKey
+	e.ClientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	h.audit.Record(e)
+}
+
+// recordMetadata notes who uploaded an object. A Content-Type sent by the
+// client is kept; otherwise the type is detected from the file.
+func (h *Handler) recordMetadata(r *http.Request, filename, dst, contentType string) {
+	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	md := metadata.New(dst, h.config.Get().S3AccessKey, clientIP, filename)
+	if contentType != "" && contentType != "application/octet-stream" {
+		md.MIMEType = contentType
+	}
+	h.metadata.RecordUpload(filename, md)
+}
+
+// ServeHTTP authenticates the request and dispatches it to the matching S3 operation
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := h.config.Get()
+
+	requestID := newRequestID()
+	w.Header().Set("X-Amz-Request-Id", requestID)
+	w.Header().Set("Server", "LocalShare")
+
+	if err := verifyRequest(r, cfg.S3AccessKey, cfg.S3SecretKey, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, errRequestExpired):
+			writeError(w, r, requestID, http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+		case errors.Is(err, errSignatureInvalid):
+			writeError(w, r, requestID, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+		default:
+			writeError(w, r, requestID, http.StatusForbidden, "AccessDenied", "Access Denied")
+		}
+		return
+	}
+
+	bucketName, key := h.splitPath(r)
+	query := r.URL.Query()
+
+	// Service-level requests
+	if bucketName == "" {
+		if r.Method == http.MethodGet {
+			h.listBuckets(w)
+			return
+		}
+		writeError(w, r, requestID, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		return
+	}
+
+	if bucketName != cfg.S3Bucket {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	// Bucket-level requests
+	if key == "" {
+		switch {
+		case r.Method == http.MethodGet:
+			h.listObjectsV2(w, r, requestID)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && query.Has("delete"):
+			h.deleteObjects(w, r, requestID)
+		default:
+			writeError(w, r, requestID, http.StatusNotImplemented, "NotImplemented", "This bucket operation is not supported by LocalShare.")
+		}
+		return
+	}
+
+	// Object-level requests
+	filename, err := fileutil.SanitizeFilename(key)
+	if err != nil || filename != key {
+		writeError(w, r, requestID, http.StatusBadRequest, "InvalidArgument", "LocalShare only supports flat object keys without slashes.")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		h.createMultipartUpload(w, r, requestID, filename)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		h.completeMultipartUpload(w, r, requestID, filename, query.Get("uploadId"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		h.uploadPart(w, r, requestID, filename, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		h.abortMultipartUpload(w, r, requestID, filename, query.Get("uploadId"))
+	case r.Method == http.MethodPut:
+		h.putObject(w, r, requestID, filename)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		h.getObject(w, r, requestID, filename)
+	case r.Method == http.MethodDelete:
+		h.deleteObject(w, r, requestID, filename)
+	default:
+		writeError(w, r, requestID, http.StatusNotImplemented, "NotImplemented", "This object operation is not supported by LocalShare.")
+	}
+}
+
+// splitPath extracts the bucket and key from a path-style or virtual-hosted-style request
+func (h *Handler) splitPath(r *http.Request) (bucketName, key string) {
+	cfg := h.config.Get()
+
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if strings.HasPrefix(host, cfg.S3Bucket+".") {
+		return cfg.S3Bucket, strings.TrimPrefix(r.URL.Path, "/")
+	}
+
+	bucketName, key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return bucketName, key
+}
+
+// listBuckets returns the single configured bucket
+func (h *Handler) listBuckets(w http.ResponseWriter) {
+	cfg := h.config.Get()
+
+	created := time.Now()
+	if info, err := os.Stat(cfg.UploadDir); err == nil {
+		created = info.ModTime()
+	}
+
+	writeXML(w, http.StatusOK, listBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: owner{ID: cfg.S3AccessKey, DisplayName: "localshare"},
+		Buckets: []bucket{{
+			Name:         cfg.S3Bucket,
+			CreationDate: created.UTC(),
+		}},
+	})
+}
+
+// listObjectsV2 lists the files in the upload directory
+func (h *Handler) listObjectsV2(w http.ResponseWriter, r *http.Request, requestID string) {
+	cfg := h.config.Get()
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startAfter := query.Get("start-after")
+
+	maxKeys := defaultMaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, requestID, http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer.")
+			return
+		}
+		maxKeys = min(n, defaultMaxKeys)
+	}
+
+	// Continuation tokens are the base64-encoded last key or common prefix
+	// returned. Keys under a returned prefix sort after it, so they are
+	// skipped when resuming from it.
+	after := startAfter
+	var resumePrefix string
+	if token := query.Get("continuation-token"); token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, r, requestID, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect.")
+			return
+		}
+		after = string(decoded)
+		resumePrefix = after
+	}
+
+	files, err := fileutil.ListFiles(cfg.UploadDir)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to list files.")
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	result := listObjectsV2Result{
+		Xmlns:             s3Namespace,
+		Name:              cfg.S3Bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		StartAfter:        startAfter,
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+
+	var lastKey string
+	seenPrefixes := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir || !strings.HasPrefix(file.Name, prefix) || file.Name <= after {
+			continue
+		}
+
+		var p string
+		if delimiter != "" {
+			if i := strings.Index(file.Name[len(prefix):], delimiter); i >= 0 {
+				p = file.Name[:len(prefix)+i+len(delimiter)]
+				if seenPrefixes[p] || p == resumePrefix {
+					continue
+				}
+			}
+		}
+
+		if result.KeyCount >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if p != "" {
+			seenPrefixes[p] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: p})
+			result.KeyCount++
+			lastKey = p
+			continue
+		}
+
+		result.Contents = append(result.Contents, object{
+			Key:          file.Name,
+			LastModified: file.ModifiedTime.UTC(),
+			ETag:         h.objectETag(filepath.Join(cfg.UploadDir, file.Name)),
+			Size:         file.Size,
+			StorageClass: "STANDARD",
+		})
+		result.KeyCount++
+		lastKey = file.Name
+	}
+
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+// getObject serves GetObject and HeadObject, including range requests
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, requestID, filename string) {
+	cfg := h.config.Get()
+
+	filePath := filepath.Join(cfg.UploadDir, filename)
+	f, err := os.Open(filePath)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	w.Header().Set("ETag", h.etag(info))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if r.Method == http.MethodHead {
+		http.ServeContent(w, r, filename, info.ModTime(), f)
+		return
+	}
+
+	// Clients fetch large objects in ranges; audit only the first one
+	if rng := r.Header.Get("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		h.record(r, models.AuditEvent{
+			Action:   audit.ActionDownload,
+			Filename: filename,
+			Size:     info.Size(),
+		})
+	}
+
+	defer h.metrics.StartTransfer(audit.ProtocolS3, metrics.DirectionDownload)()
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, filename, info.ModTime(), f)
+	h.metrics.AddBytes(audit.ProtocolS3, metrics.DirectionDownload, cw.n)
+}
+
+// putObject stores the request body as a file, replacing any existing file
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, requestID, filename string) {
+	cfg := h.config.Get()
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeError(w, r, requestID, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported by LocalShare.")
+		return
+	}
+
+	maxSize := cfg.MaxFileSize()
+	if r.ContentLength > maxSize {
+		writeError(w, r, requestID, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Your proposed upload exceeds the maximum of %d MB.", cfg.MaxFileSizeMB))
+		return
+	}
+
+	res, err := h.quota.Reserve(max(r.ContentLength, 0))
+	if err != nil {
+		writeStorageError(w, r, requestID, err)
+		return
+	}
+	defer res.Release()
+
+	tmpDir, err := fileutil.StateDir(cfg.UploadDir, tmpDirName)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to prepare upload.")
+		return
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "put-*")
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to create file.")
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	done := h.metrics.StartTransfer(audit.ProtocolS3, metrics.DirectionUpload)
+	sum := md5.New()
+	hasher := checksum.NewHasher(cfg.HashBLAKE3)
+	written, err := io.Copy(io.MultiWriter(res.Writer(tmp), sum, hasher), io.LimitReader(r.Body, maxSize+1))
+	tmp.Close()
+	done()
+	h.metrics.AddBytes(audit.ProtocolS3, metrics.DirectionUpload, written)
+	if err != nil {
+		if quota.IsLimit(err) {
+			writeStorageError(w, r, requestID, err)
+			return
+		}
+		if errors.Is(err, errPayloadMismatch) {
+			writeError(w, r, requestID, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+			return
+		}
+		if errors.Is(err, errSignatureInvalid) {
+			writeError(w, r, requestID, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+			return
+		}
+		writeError(w, r, requestID, http.StatusBadRequest, "IncompleteBody", "Failed to read the request body.")
+		return
+	}
+
+	if written > maxSize {
+		writeError(w, r, requestID, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Your proposed upload exceeds the maximum of %d MB.", cfg.MaxFileSizeMB))
+		return
+	}
+
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		if base64.StdEncoding.EncodeToString(sum.Sum(nil)) != contentMD5 {
+			writeError(w, r, requestID, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+			return
+		}
+	}
+
+	sums := hasher.Sums()
+	if err := h.content.Intern(tmp.Name(), sums.SHA256); err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to save file.")
+		return
+	}
+
+	dst := filepath.Join(cfg.UploadDir, filename)
+	if err := h.versions.Replace(tmp.Name(), dst); err != nil {
+		if errors.Is(err, versions.ErrIsDir) {
+			writeError(w, r, requestID, http.StatusConflict, "OperationAborted", "A folder with that name exists.")
+			return
+		}
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to save file.")
+		return
+	}
+	// Like S3, the ETag of an object put in one part is the MD5 of its content
+	etag := hex.EncodeToString(sum.Sum(nil))
+	sums.MD5 = etag
+	h.checksums.Set(dst, sums)
+	h.recordMetadata(r, filename, dst, r.Header.Get("Content-Type"))
+	h.index.Add(dst)
+
+	h.record(r, models.AuditEvent{
+		Action:   audit.ActionUpload,
+		Filename: filename,
+		Size:     written,
+		SHA256:   sums.SHA256,
+	})
+
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteObject removes a file. Like S3, deleting a missing key succeeds.
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, requestID, filename string) {
+	cfg := h.config.Get()
+
+	filePath := filepath.Join(cfg.UploadDir, filename)
+	if err := h.removeFile(r, filePath); err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to delete file.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteObjects removes several files in one request
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, requestID string) {
+	cfg := h.config.Get()
+
+	var req deleteRequest
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, r, requestID, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+		return
+	}
+
+	result := deleteResult{Xmlns: s3Namespace}
+	for _, obj := range req.Objects {
+		filePath, err := fileutil.GetFilePath(cfg.UploadDir, obj.Key)
+		if err != nil || filepath.Base(filePath) != obj.Key {
+			result.Errors = append(result.Errors, deleteError{Key: obj.Key, Code: "InvalidArgument", Message: "Invalid key"})
+			continue
+		}
+		if err := h.removeFile(r, filePath); err != nil {
+			result.Errors = append(result.Errors, deleteError{Key: obj.Key, Code: "InternalError", Message: "Failed to delete file"})
+			continue
+		}
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: obj.Key})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+// removeFile deletes a file and audits the deletion. A file that does not
+// exist is not an error, matching S3's idempotent deletes.
+func (h *Handler) removeFile(r *http.Request, filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if err := h.trash.Remove(filePath, h.config.Get().S3AccessKey, clientIP); err != nil && fileutil.FileExists(filePath) {
+		return err
+	}
+	h.index.Remove(info.Name())
+
+	h.record(r, models.AuditEvent{
+		Action:   audit.ActionDelete,
+		Filename: info.Name(),
+		Size:     info.Size(),
+	})
+	return nil
+}
+
+// objectETag returns the entity tag of the file at filePath, or "" if it cannot be read
+func (h *Handler) objectETag(filePath string) string {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ""
+	}
+	return h.etag(info)
+}
+
+// etag returns the entity tag of the file described by info: the MD5 of its
+// content where it was recorded as the file was put, or else a tag derived
+// from its size and modification time
+func (h *Handler) etag(info os.FileInfo) string {
+	if sums, ok := h.checksums.Get(info); ok && sums.MD5 != "" {
+		return `"` + sums.MD5 + `"`
+	}
+	return fileETag(info.Size(), info.ModTime())
+}
+
+// fileETag derives a stable entity tag from a file's size and modification time
+func fileETag(size int64, modTime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, size, modTime.UnixNano())
+}
+
+// newRequestID returns a random identifier for the x-amz-request-id header
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// countingWriter counts the body bytes written to a response
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// writeXML encodes v as the XML response body
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+// writeStorageError answers an upload that does not fit with 507, or 500
+// if storage use could not be measured
+func writeStorageError(w http.ResponseWriter, r *http.Request, requestID string, err error) {
+	switch {
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		writeError(w, r, requestID, http.StatusInsufficientStorage, "InsufficientStorage", "The storage quota of this server has been reached.")
+	case errors.Is(err, quota.ErrInsufficientSpace):
+		writeError(w, r, requestID, http.StatusInsufficientStorage, "InsufficientStorage", "There is not enough free disk space to store the object.")
+	default:
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to check storage usage.")
+	}
+}
+
+// writeError writes an S3 error response. HEAD responses carry no body.
+func writeError(w http.ResponseWriter, r *http.Request, requestID string, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+}
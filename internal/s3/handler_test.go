@@ -0,0 +1,210 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// testHandler serves the S3 API over a fresh upload directory
+type testHandler struct {
+	*Handler
+	uploadDir string
+}
+
+func newTestHandler(t *testing.T) *testHandler {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	cfg.MinFreeMB = 0
+	cfg.S3AccessKey = "AKIDEXAMPLE"
+	cfg.S3SecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	store := config.NewStore(&cfg)
+
+	stateFile := func(name, file string) string {
+		dir, err := fileutil.StateDir(cfg.UploadDir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(dir, file)
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditLog, err := audit.Open(stateFile("audit", audit.FileName))
+	must(err)
+	t.Cleanup(func() { auditLog.Close() })
+	meta, err := metadata.Open(stateFile("metadata", metadata.FileName))
+	must(err)
+	index, err := search.Open(store, stateFile("search", search.FileName))
+	must(err)
+	bin, err := trash.Open(store, filepath.Dir(stateFile("trash", "")), meta)
+	must(err)
+	versionStore, err := versions.Open(store, filepath.Dir(stateFile("versions", "")))
+	must(err)
+	checksums, err := checksum.Open(stateFile("checksums", checksum.FileName))
+	must(err)
+	content, err := dedup.Open(store, filepath.Dir(stateFile("objects", "")), checksums)
+	must(err)
+
+	h := NewHandler(store, auditLog, metrics.New(store), quota.NewGuard(store), bin, versionStore, checksums, content, meta, index)
+	return &testHandler{Handler: h, uploadDir: cfg.UploadDir}
+}
+
+// do sends a signed request with an unsigned payload to the handler
+func (th *testHandler) do(t *testing.T, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, "http://localhost:9000"+target, strings.NewReader(body))
+	cfg := th.config.Get()
+	signRequest(r, cfg.S3AccessKey, cfg.S3SecretKey, time.Now(), unsignedPayload)
+	w := httptest.NewRecorder()
+	th.ServeHTTP(w, r)
+	return w
+}
+
+func TestListObjectsV2Pagination(t *testing.T) {
+	th := newTestHandler(t)
+	for _, name := range []string{"a-1", "a-2", "a-3", "b", "c-1", "c-2"} {
+		if err := os.WriteFile(filepath.Join(th.uploadDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantPages [][]string // keys and common prefixes on each page
+	}{
+		{
+			name:      "one entry per page",
+			query:     "delimiter=-&max-keys=1",
+			wantPages: [][]string{{"a-"}, {"b"}, {"c-"}},
+		},
+		{
+			name:      "prefix ending a page",
+			query:     "delimiter=-&max-keys=2",
+			wantPages: [][]string{{"a-", "b"}, {"c-"}},
+		},
+		{
+			name:      "without a delimiter",
+			query:     "max-keys=4",
+			wantPages: [][]string{{"a-1", "a-2", "a-3", "b"}, {"c-1", "c-2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages [][]string
+			token := ""
+			for len(pages) <= len(tt.wantPages) {
+				target := "/localshare?list-type=2&" + tt.query
+				if token != "" {
+					target += "&continuation-token=" + url.QueryEscape(token)
+				}
+				w := th.do(t, http.MethodGet, target, "")
+				if w.Code != http.StatusOK {
+					t.Fatalf("list = %d %s", w.Code, w.Body)
+				}
+				var result listObjectsV2Result
+				if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+					t.Fatal(err)
+				}
+
+				var page []string
+				for _, p := range result.CommonPrefixes {
+					page = append(page, p.Prefix)
+				}
+				for _, o := range result.Contents {
+					page = append(page, o.Key)
+				}
+				pages = append(pages, page)
+				if !result.IsTruncated {
+					break
+				}
+				token = result.NextContinuationToken
+			}
+
+			if fmt.Sprint(pages) != fmt.Sprint(tt.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestMultipartETag(t *testing.T) {
+	th := newTestHandler(t)
+
+	w := th.do(t, http.MethodPost, "/localshare/big.bin?uploads", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &initiated); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []string{strings.Repeat("a", 1000), strings.Repeat("b", 10)}
+	var complete strings.Builder
+	complete.WriteString("<CompleteMultipartUpload>")
+	partSums := md5.New()
+	for i, part := range parts {
+		target := fmt.Sprintf("/localshare/big.bin?partNumber=%d&uploadId=%s", i+1, initiated.UploadID)
+		w := th.do(t, http.MethodPut, target, part)
+		if w.Code != http.StatusOK {
+			t.Fatalf("part %d = %d %s", i+1, w.Code, w.Body)
+		}
+		sum := md5.Sum([]byte(part))
+		partSums.Write(sum[:])
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, w.Header().Get("ETag"))
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+	want := `"` + hex.EncodeToString(partSums.Sum(nil)) + `-2"`
+
+	w = th.do(t, http.MethodPost, "/localshare/big.bin?uploadId="+initiated.UploadID, complete.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("complete = %d %s", w.Code, w.Body)
+	}
+	var result completeMultipartUploadResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ETag != want {
+		t.Errorf("completed ETag = %s, want %s", result.ETag, want)
+	}
+
+	// Later requests for the object report the same ETag
+	w = th.do(t, http.MethodHead, "/localshare/big.bin", "")
+	if got := w.Header().Get("ETag"); got != want {
+		t.Errorf("HeadObject ETag = %s, want %s", got, want)
+	}
+	w = th.do(t, http.MethodGet, "/localshare/big.bin", "")
+	if body, _ := io.ReadAll(w.Body); string(body) != parts[0]+parts[1] {
+		t.Errorf("GetObject returned %d bytes, want %d", len(body), len(parts[0]+parts[1]))
+	}
+}
@@ -0,0 +1,304 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+const (
+	multipartDirName = "s3-multipart"
+	uploadKeyFile    = "key"
+	maxPartNumber    = 10000
+)
+
+// multipartDir returns the staging directory of an in-progress multipart
+// upload after checking that it exists and belongs to the given key
+func (h *Handler) multipartDir(filename, uploadID string) (string, error) {
+	cfg := h.config.Get()
+
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", os.ErrNotExist
+	}
+
+	root, err := fileutil.StateDir(cfg.UploadDir, multipartDirName)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(root, uploadID)
+	key, err := os.ReadFile(filepath.Join(dir, uploadKeyFile))
+	if err != nil {
+		return "", os.ErrNotExist
+	}
+	if string(key) != filename {
+		return "", os.ErrNotExist
+	}
+	return dir, nil
+}
+
+// partPath returns the staging file of a single part
+func partPath(dir string, partNumber int) string {
+	return filepath.Join(dir, fmt.Sprintf("part-%05d", partNumber))
+}
+
+// createMultipartUpload starts a new multipart upload and returns its ID
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, requestID, filename string) {
+	cfg := h.config.Get()
+
+	root, err := fileutil.StateDir(cfg.UploadDir, multipartDirName)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to prepare upload.")
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+
+	dir := filepath.Join(root, uploadID)
+	if err := fileutil.EnsureDir(dir); err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to prepare upload.")
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, uploadKeyFile), []byte(filename), 0644); err != nil {
+		os.RemoveAll(dir)
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to prepare upload.")
+		return
+	}
+
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   cfg.S3Bucket,
+		Key:      filename,
+		UploadID: uploadID,
+	})
+}
+
+// uploadPart stores one part of a multipart upload
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request, requestID, filename, uploadID, partNumberParam string) {
+	cfg := h.config.Get()
+
+	partNumber, err := strconv.Atoi(partNumberParam)
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		writeError(w, r, requestID, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000.")
+		return
+	}
+
+	dir, err := h.multipartDir(filename, uploadID)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist.")
+		return
+	}
+
+	maxSize := cfg.MaxFileSize()
+	if r.ContentLength > maxSize {
+		writeError(w, r, requestID, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Your proposed upload exceeds the maximum of %d MB.", cfg.MaxFileSizeMB))
+		return
+	}
+
+	res, err := h.quota.Reserve(max(r.ContentLength, 0))
+	if err != nil {
+		writeStorageError(w, r, requestID, err)
+		return
+	}
+	defer res.Release()
+
+	dst := partPath(dir, partNumber)
+	out, err := os.Create(dst)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to create part.")
+		return
+	}
+
+	done := h.metrics.StartTransfer(audit.ProtocolS3, metrics.DirectionUpload)
+	sum := md5.New()
+	written, err := io.Copy(io.MultiWriter(res.Writer(out), sum), io.LimitReader(r.Body, maxSize+1))
+	out.Close()
+	done()
+	h.metrics.AddBytes(audit.ProtocolS3, metrics.DirectionUpload, written)
+	if err != nil {
+		os.Remove(dst)
+		if quota.IsLimit(err) {
+			writeStorageError(w, r, requestID, err)
+			return
+		}
+		if errors.Is(err, errPayloadMismatch) {
+			writeError(w, r, requestID, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+			return
+		}
+		if errors.Is(err, errSignatureInvalid) {
+			writeError(w, r, requestID, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+			return
+		}
+		writeError(w, r, requestID, http.StatusBadRequest, "IncompleteBody", "Failed to read the request body.")
+		return
+	}
+
+	if written > maxSize {
+		os.Remove(dst)
+		writeError(w, r, requestID, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Your proposed upload exceeds the maximum of %d MB.", cfg.MaxFileSizeMB))
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// completeMultipartUpload concatenates the listed parts into the final file
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, requestID, filename, uploadID string) {
+	cfg := h.config.Get()
+
+	dir, err := h.multipartDir(filename, uploadID)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist.")
+		return
+	}
+
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, requestID, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+		return
+	}
+
+	// Parts must be listed in ascending order and all must exist
+	var total int64
+	for i, part := range req.Parts {
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, requestID, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+			return
+		}
+		info, err := os.Stat(partPath(dir, part.PartNumber))
+		if err != nil {
+			writeError(w, r, requestID, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d could not be found.", part.PartNumber))
+			return
+		}
+		total += info.Size()
+	}
+
+	if total > cfg.MaxFileSize() {
+		writeError(w, r, requestID, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Your proposed upload exceeds the maximum of %d MB.", cfg.MaxFileSizeMB))
+		return
+	}
+
+	// Assembling briefly needs room for a second copy of every part
+	res, err := h.quota.Reserve(total)
+	if err != nil {
+		writeStorageError(w, r, requestID, err)
+		return
+	}
+	defer res.Release()
+
+	assembled := filepath.Join(dir, "assembled")
+	out, err := os.Create(assembled)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to assemble upload.")
+		return
+	}
+
+	hasher := checksum.NewHasher(cfg.HashBLAKE3)
+	partSums := md5.New()
+	for _, part := range req.Parts {
+		partSum, err := appendPart(io.MultiWriter(out, hasher), partPath(dir, part.PartNumber), part.ETag)
+		if err != nil {
+			out.Close()
+			os.Remove(assembled)
+			writeError(w, r, requestID, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d does not match its ETag.", part.PartNumber))
+			return
+		}
+		partSums.Write(partSum)
+	}
+	out.Close()
+
+	// Like S3, the ETag of a multipart object is the MD5 of its parts' MD5s
+	// followed by the number of parts
+	sums := hasher.Sums()
+	sums.MD5 = fmt.Sprintf("%x-%d", partSums.Sum(nil), len(req.Parts))
+	if err := h.content.Intern(assembled, sums.SHA256); err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to save file.")
+		return
+	}
+
+	dst := filepath.Join(cfg.UploadDir, filename)
+	if err := h.versions.Replace(assembled, dst); err != nil {
+		if errors.Is(err, versions.ErrIsDir) {
+			writeError(w, r, requestID, http.StatusConflict, "OperationAborted", "A folder with that name exists.")
+			return
+		}
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to save file.")
+		return
+	}
+	os.RemoveAll(dir)
+	h.checksums.Set(dst, sums)
+	h.recordMetadata(r, filename, dst, "")
+	h.index.Add(dst)
+
+	h.record(r, models.AuditEvent{
+		Action:   audit.ActionUpload,
+		Filename: filename,
+		Size:     total,
+		SHA256:   sums.SHA256,
+	})
+
+	result := completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + cfg.S3Bucket + "/" + filename,
+		Bucket:   cfg.S3Bucket,
+		Key:      filename,
+		ETag:     `"` + sums.MD5 + `"`,
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// appendPart copies a staged part onto out, verifying it against the ETag
+// the client supplied, and returns the part's MD5
+func appendPart(out io.Writer, path, etag string) ([]byte, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	sum := md5.New()
+	if _, err := io.Copy(io.MultiWriter(out, sum), in); err != nil {
+		return nil, err
+	}
+
+	digest := sum.Sum(nil)
+	if want := strings.Trim(etag, `"`); want != "" && want != hex.EncodeToString(digest) {
+		return nil, errors.New("part ETag mismatch")
+	}
+	return digest, nil
+}
+
+// abortMultipartUpload discards an in-progress multipart upload
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, requestID, filename, uploadID string) {
+	dir, err := h.multipartDir(filename, uploadID)
+	if err != nil {
+		writeError(w, r, requestID, http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist.")
+		return
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		writeError(w, r, requestID, http.StatusInternalServerError, "InternalError", "Failed to abort upload.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,395 @@
+package s3
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	maxClockSkew    = 15 * time.Minute
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	streamingPrefix = "STREAMING-"
+	// Streaming payloads whose chunks, and any trailer, are signed
+	streamingSigned        = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsigned      = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	emptySHA256            = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	errAccessDenied     = errors.New("access denied")
+	errSignatureInvalid = errors.New("signature does not match")
+	errRequestExpired   = errors.New("request time too skewed")
+	errPayloadMismatch  = errors.New("payload hash mismatch")
+)
+
+// credential is the parsed Credential component of a SigV4 Authorization header
+type credential struct {
+	accessKey string
+	date      string
+	region    string
+	service   string
+}
+
+// scope returns the credential scope used in the string to sign
+func (c credential) scope() string {
+	return c.date + "/" + c.region + "/" + c.service + "/aws4_request"
+}
+
+// authHeader is a parsed SigV4 Authorization header
+type authHeader struct {
+	cred          credential
+	signedHeaders []string
+	signature     string
+}
+
+// parseAuthHeader parses an "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=..." header
+func parseAuthHeader(value string) (*authHeader, error) {
+	if !strings.HasPrefix(value, sigV4Algorithm+" ") {
+		return nil, errAccessDenied
+	}
+
+	auth := &authHeader{}
+	for _, field := range strings.Split(strings.TrimPrefix(value, sigV4Algorithm+" "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, errAccessDenied
+		}
+		switch k {
+		case "Credential":
+			parts := strings.Split(v, "/")
+			if len(parts) != 5 || parts[4] != "aws4_request" {
+				return nil, errAccessDenied
+			}
+			auth.cred = credential{accessKey: parts[0], date: parts[1], region: parts[2], service: parts[3]}
+		case "SignedHeaders":
+			auth.signedHeaders = strings.Split(v, ";")
+		case "Signature":
+			auth.signature = v
+		}
+	}
+
+	if auth.cred.accessKey == "" || len(auth.signedHeaders) == 0 || auth.signature == "" {
+		return nil, errAccessDenied
+	}
+	return auth, nil
+}
+
+// verifyRequest checks the SigV4 signature of a request against the configured
+// key pair. On success it replaces the request body with one that decodes
+// aws-chunked uploads and verifies signed payload hashes as it is read.
+func verifyRequest(r *http.Request, accessKey, secretKey string, now time.Time) error {
+	auth, err := parseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.cred.accessKey), []byte(accessKey)) != 1 {
+		return errAccessDenied
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return errAccessDenied
+	}
+	if d := now.Sub(signedAt); d > maxClockSkew || d < -maxClockSkew {
+		return errRequestExpired
+	}
+	if !strings.HasPrefix(amzDate, auth.cred.date) {
+		return errAccessDenied
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+	}
+
+	canonical := canonicalRequest(r, auth.signedHeaders, payloadHash)
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		auth.cred.scope(),
+		hexSHA256([]byte(canonical)),
+	}, "\n")
+
+	key := signingKey(secretKey, auth.cred)
+	expected := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(auth.signature)) != 1 {
+		return errSignatureInvalid
+	}
+
+	switch {
+	case payloadHash == unsignedPayload:
+	case strings.HasPrefix(payloadHash, streamingPrefix):
+		var signer *chunkSigner
+		switch payloadHash {
+		case streamingSigned, streamingSignedTrailer:
+			// Chunk signatures chain from the request's own, the seed signature
+			signer = &chunkSigner{key: key, amzDate: amzDate, scope: auth.cred.scope(), prev: auth.signature}
+		case streamingUnsigned:
+		default:
+			return errAccessDenied
+		}
+		r.Body = io.NopCloser(newChunkedReader(r.Body, signer))
+		if n, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+			r.ContentLength = n
+		} else {
+			r.ContentLength = -1
+		}
+	default:
+		r.Body = io.NopCloser(&hashingReader{r: r.Body, h: sha256.New(), want: payloadHash})
+	}
+
+	return nil
+}
+
+// canonicalRequest builds the SigV4 canonical request string
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var value string
+		if name == "host" {
+			value = r.Host
+		} else {
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(strings.Join(strings.Fields(value), " "))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery encodes the query parameters sorted by key and value
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, as
+// required by SigV4. Slashes are kept as-is unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signingKey derives the SigV4 signing key for the credential scope
+func signingKey(secretKey string, cred credential) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), []byte(cred.date))
+	key = hmacSHA256(key, []byte(cred.region))
+	key = hmacSHA256(key, []byte(cred.service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashingReader verifies the SHA-256 of everything read against the signed
+// x-amz-content-sha256 value once the underlying reader is exhausted
+type hashingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want string
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(hr.h.Sum(nil)) != hr.want {
+		return n, errPayloadMismatch
+	}
+	return n, err
+}
+
+// chunkSigner verifies the signatures of an aws-chunked body. Each chunk's
+// signature covers its data and the signature before it, starting with the
+// seed signature of the request itself, so chunks cannot be altered,
+// dropped or reordered without the secret key.
+type chunkSigner struct {
+	key     []byte
+	amzDate string
+	scope   string
+	prev    string
+}
+
+// verify checks the signature of the next chunk or trailer, whose string to
+// sign ends with hashes
+func (cs *chunkSigner) verify(algorithm, signature string, hashes ...string) error {
+	stringToSign := strings.Join(append([]string{algorithm, cs.amzDate, cs.scope, cs.prev}, hashes...), "\n")
+	expected := hex.EncodeToString(hmacSHA256(cs.key, []byte(stringToSign)))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return errSignatureInvalid
+	}
+	cs.prev = signature
+	return nil
+}
+
+// chunkedReader decodes an aws-chunked request body. Each chunk is framed as
+// "<hex-size>[;chunk-signature=<sig>]\r\n<data>\r\n" and the body ends with a
+// zero-sized chunk optionally followed by trailing checksum headers. With a
+// signer, every chunk and any trailer must carry a valid signature, checked
+// as soon as it has been read.
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+
+	signer    *chunkSigner
+	signature string    // claimed for the chunk being read
+	hash      hash.Hash // of the chunk being read
+}
+
+func newChunkedReader(r io.Reader, signer *chunkSigner) *chunkedReader {
+	return &chunkedReader{r: bufio.NewReader(r), signer: signer, hash: sha256.New()}
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.done {
+		return 0, io.EOF
+	}
+
+	if cr.remaining == 0 {
+		line, err := cr.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		sizeField, extensions, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeField, 16, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("invalid aws-chunked frame %q", line)
+		}
+		cr.signature = ""
+		for _, ext := range strings.Split(extensions, ";") {
+			if k, v, ok := strings.Cut(ext, "="); ok && k == "chunk-signature" {
+				cr.signature = v
+			}
+		}
+		if cr.signer != nil && cr.signature == "" {
+			return 0, errSignatureInvalid
+		}
+		cr.hash.Reset()
+
+		if size == 0 {
+			cr.done = true
+			if cr.signer != nil {
+				if err := cr.signer.verify("AWS4-HMAC-SHA256-PAYLOAD", cr.signature, emptySHA256, emptySHA256); err != nil {
+					return 0, err
+				}
+			}
+			if err := cr.readTrailer(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		cr.remaining = size
+	}
+
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	cr.hash.Write(p[:n])
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+
+	if cr.remaining == 0 {
+		// Consume the CRLF that terminates the chunk data
+		if _, err := cr.r.Discard(2); err != nil {
+			return n, io.ErrUnexpectedEOF
+		}
+		if cr.signer != nil {
+			sum := hex.EncodeToString(cr.hash.Sum(nil))
+			if err := cr.signer.verify("AWS4-HMAC-SHA256-PAYLOAD", cr.signature, emptySHA256, sum); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// readTrailer reads the trailing headers up to the terminating blank line.
+// With a signer, they must end with a valid x-amz-trailer-signature.
+func (cr *chunkedReader) readTrailer() error {
+	var headers strings.Builder
+	signature := ""
+	for {
+		line, err := cr.r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(name, "x-amz-trailer-signature") {
+			signature = strings.TrimSpace(value)
+		} else {
+			headers.WriteString(strings.ToLower(name) + ":" + strings.TrimSpace(value) + "\n")
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if cr.signer == nil || (headers.Len() == 0 && signature == "") {
+		return nil
+	}
+	if signature == "" {
+		return errSignatureInvalid
+	}
+	return cr.signer.verify("AWS4-HMAC-SHA256-TRAILER", signature, hexSHA256([]byte(headers.String())))
+}
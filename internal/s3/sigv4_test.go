@@ -0,0 +1,401 @@
+package s3
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	cred := credential{date: "20120215", region: "us-east-1", service: "iam"}
+	got := hex.EncodeToString(signingKey(testSecretKey, cred))
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got != want {
+		t.Errorf("signingKey = %s, want %s", got, want)
+	}
+}
+
+func TestCanonicalRequestVanilla(t *testing.T) {
+	// "get-vanilla" from the AWS Signature Version 4 test suite
+	r := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+	r.Header.Set("X-Amz-Date", "20150830T123600Z")
+
+	canonical := canonicalRequest(r, []string{"host", "x-amz-date"}, emptySHA256)
+	wantCanonical := "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" + emptySHA256
+	if canonical != wantCanonical {
+		t.Fatalf("canonicalRequest = %q, want %q", canonical, wantCanonical)
+	}
+
+	cred := credential{accessKey: testAccessKey, date: "20150830", region: "us-east-1", service: "service"}
+	stringToSign := strings.Join([]string{sigV4Algorithm, "20150830T123600Z", cred.scope(), hexSHA256([]byte(canonical))}, "\n")
+	got := hex.EncodeToString(hmacSHA256(signingKey(testSecretKey, cred), []byte(stringToSign)))
+	want := "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestURIEncode(t *testing.T) {
+	tests := []struct {
+		in          string
+		encodeSlash bool
+		want        string
+	}{
+		{"/bucket/key.txt", false, "/bucket/key.txt"},
+		{"/bucket/a b+c", false, "/bucket/a%20b%2Bc"},
+		{"a/b", true, "a%2Fb"},
+		{"~-_.", true, "~-_."},
+		{"é", true, "%C3%A9"},
+	}
+	for _, tt := range tests {
+		if got := uriEncode(tt.in, tt.encodeSlash); got != tt.want {
+			t.Errorf("uriEncode(%q, %v) = %q, want %q", tt.in, tt.encodeSlash, got, tt.want)
+		}
+	}
+}
+
+func TestParseAuthHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", "AWS4-HMAC-SHA256 Credential=AKID/20150830/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-date, Signature=abc", false},
+		{"other algorithm", "AWS4-HMAC-SHA1 Credential=AKID/20150830/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", true},
+		{"short credential", "AWS4-HMAC-SHA256 Credential=AKID/20150830/us-east-1/s3, SignedHeaders=host, Signature=abc", true},
+		{"wrong terminator", "AWS4-HMAC-SHA256 Credential=AKID/20150830/us-east-1/s3/aws5_request, SignedHeaders=host, Signature=abc", true},
+		{"missing signature", "AWS4-HMAC-SHA256 Credential=AKID/20150830/us-east-1/s3/aws4_request, SignedHeaders=host", true},
+		{"malformed field", "AWS4-HMAC-SHA256 Credential", true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAuthHeader(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAuthHeader error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signRequest signs r as an S3 client would, with the payload hash given
+func signRequest(r *http.Request, accessKey, secretKey string, at time.Time, payloadHash string) {
+	amzDate := at.UTC().Format(amzDateFormat)
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	cred := credential{accessKey: accessKey, date: amzDate[:8], region: "us-east-1", service: "s3"}
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonical := canonicalRequest(r, signed, payloadHash)
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, cred.scope(), hexSHA256([]byte(canonical))}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(secretKey, cred), []byte(stringToSign)))
+
+	r.Header.Set("Authorization", sigV4Algorithm+" Credential="+accessKey+"/"+cred.scope()+", SignedHeaders="+strings.Join(signed, ";")+", Signature="+signature)
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	body := "hello world"
+
+	tests := []struct {
+		name      string
+		accessKey string
+		secretKey string
+		signedAt  time.Time
+		payload   string
+		tamper    func(r *http.Request)
+		wantErr   error
+	}{
+		{name: "valid", payload: hexSHA256([]byte(body))},
+		{name: "unsigned payload", payload: unsignedPayload},
+		{name: "wrong access key", accessKey: "someone", payload: unsignedPayload, wantErr: errAccessDenied},
+		{name: "wrong secret key", secretKey: "not-the-secret", payload: unsignedPayload, wantErr: errSignatureInvalid},
+		{name: "too old", signedAt: now.Add(-maxClockSkew - time.Minute), payload: unsignedPayload, wantErr: errRequestExpired},
+		{name: "too far ahead", signedAt: now.Add(maxClockSkew + time.Minute), payload: unsignedPayload, wantErr: errRequestExpired},
+		{
+			name:    "tampered path",
+			payload: unsignedPayload,
+			tamper:  func(r *http.Request) { r.URL.Path = "/localshare/other.txt" },
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "tampered query",
+			payload: unsignedPayload,
+			tamper:  func(r *http.Request) { r.URL.RawQuery = "uploads=" },
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "tampered date",
+			payload: unsignedPayload,
+			tamper:  func(r *http.Request) { r.Header.Set("X-Amz-Date", now.Add(time.Second).Format(amzDateFormat)) },
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "credential date differs from signing date",
+			payload: unsignedPayload,
+			tamper: func(r *http.Request) {
+				r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), "/20240601/", "/20240602/", 1))
+			},
+			wantErr: errAccessDenied,
+		},
+		{
+			name:    "missing authorization",
+			payload: unsignedPayload,
+			tamper:  func(r *http.Request) { r.Header.Del("Authorization") },
+			wantErr: errAccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessKey, secretKey, signedAt := tt.accessKey, tt.secretKey, tt.signedAt
+			if accessKey == "" {
+				accessKey = testAccessKey
+			}
+			if secretKey == "" {
+				secretKey = testSecretKey
+			}
+			if signedAt.IsZero() {
+				signedAt = now
+			}
+
+			r := httptest.NewRequest(http.MethodPut, "http://localhost:9000/localshare/hello.txt", strings.NewReader(body))
+			signRequest(r, accessKey, secretKey, signedAt, tt.payload)
+			if tt.tamper != nil {
+				tt.tamper(r)
+			}
+
+			err := verifyRequest(r, testAccessKey, testSecretKey, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyRequest error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			data, err := io.ReadAll(r.Body)
+			if err != nil || string(data) != body {
+				t.Errorf("body = %q, %v; want %q", data, err, body)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestPayloadMismatch(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := httptest.NewRequest(http.MethodPut, "http://localhost:9000/localshare/hello.txt", strings.NewReader("tampered body"))
+	signRequest(r, testAccessKey, testSecretKey, now, hexSHA256([]byte("hello world")))
+
+	if err := verifyRequest(r, testAccessKey, testSecretKey, now); err != nil {
+		t.Fatalf("verifyRequest: %v", err)
+	}
+	if _, err := io.ReadAll(r.Body); !errors.Is(err, errPayloadMismatch) {
+		t.Errorf("reading body: error = %v, want %v", err, errPayloadMismatch)
+	}
+}
+
+func TestChunkedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "unchecked signatures",
+			body: "5;chunk-signature=aaaa\r\nhello\r\n6;chunk-signature=bbbb\r\n world\r\n0;chunk-signature=cccc\r\n\r\n",
+			want: "hello world",
+		},
+		{
+			name: "trailing checksum",
+			body: "3\r\nabc\r\n0\r\nx-amz-checksum-crc32:NSRBwg==\r\n\r\n",
+			want: "abc",
+		},
+		{name: "invalid size", body: "zz\r\nabc\r\n", wantErr: true},
+		{name: "cut short", body: "a\r\nabc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(newChunkedReader(strings.NewReader(tt.body), nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("decoded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// signedChunk is a chunk of an aws-chunked body and the signature it claims,
+// or the chained signature if sig is empty
+type signedChunk struct {
+	data string
+	sig  string
+}
+
+// chunkedBody frames chunks as an aws-chunked body, signing each in turn
+// from seed, and appends trailer if given
+func chunkedBody(cs chunkSigner, chunks []signedChunk, trailer string) string {
+	var b strings.Builder
+	for _, c := range append(chunks, signedChunk{}) {
+		sig := c.sig
+		if sig == "" {
+			stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", cs.amzDate, cs.scope, cs.prev, emptySHA256, hexSHA256([]byte(c.data))}, "\n")
+			sig = hex.EncodeToString(hmacSHA256(cs.key, []byte(stringToSign)))
+		}
+		cs.prev = sig
+		fmt.Fprintf(&b, "%x;chunk-signature=%s\r\n%s", len(c.data), sig, c.data)
+		if c.data != "" {
+			b.WriteString("\r\n")
+		}
+	}
+	if trailer != "" {
+		stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-TRAILER", cs.amzDate, cs.scope, cs.prev, hexSHA256([]byte(trailer + "\n"))}, "\n")
+		sig := hex.EncodeToString(hmacSHA256(cs.key, []byte(stringToSign)))
+		b.WriteString(trailer + "\r\nx-amz-trailer-signature:" + sig + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func TestChunkSignatures(t *testing.T) {
+	// Example from the AWS documentation of streaming SigV4 uploads
+	cred := credential{date: "20130524", region: "us-east-1", service: "s3"}
+	signer := chunkSigner{
+		key:     signingKey("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", cred),
+		amzDate: "20130524T000000Z",
+		scope:   cred.scope(),
+		prev:    "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9",
+	}
+	first := strings.Repeat("a", 65536)
+	second := strings.Repeat("a", 1024)
+	documented := []signedChunk{
+		{first, "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+		{second, "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+	}
+	final := "0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n"
+	withFinal := func(body string) string {
+		return body[:strings.LastIndex(body, "0;chunk-signature=")] + final
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "documented example", body: withFinal(chunkedBody(signer, documented, ""))},
+		{
+			name:    "tampered chunk",
+			body:    withFinal(chunkedBody(signer, []signedChunk{documented[0], {"b" + second[1:], documented[1].sig}}, "")),
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "reordered chunks",
+			body:    withFinal(chunkedBody(signer, []signedChunk{documented[1], documented[0]}, "")),
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "dropped chunk",
+			body:    withFinal(chunkedBody(signer, documented[:1], "")),
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "missing signature",
+			body:    "400\r\n" + second + "\r\n0\r\n\r\n",
+			wantErr: errSignatureInvalid,
+		},
+		{name: "signed trailer", body: chunkedBody(signer, []signedChunk{{data: "abc"}}, "x-amz-checksum-crc32:NSRBwg==")},
+		{
+			name:    "tampered trailer",
+			body:    strings.Replace(chunkedBody(signer, []signedChunk{{data: "abc"}}, "x-amz-checksum-crc32:NSRBwg=="), "NSRBwg==", "AAAAAA==", 1),
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "unsigned trailer",
+			body:    strings.TrimSuffix(chunkedBody(signer, []signedChunk{{data: "abc"}}, ""), "\r\n") + "x-amz-checksum-crc32:NSRBwg==\r\n\r\n",
+			wantErr: errSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := signer
+			_, err := io.ReadAll(newChunkedReader(strings.NewReader(tt.body), &cs))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestStreaming(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	chunks := []signedChunk{{data: "hello"}, {data: " world"}}
+
+	tests := []struct {
+		name    string
+		payload string
+		tamper  func(body string) string
+		want    string
+		wantErr error
+	}{
+		{name: "signed chunks", payload: streamingSigned, want: "hello world"},
+		{
+			name:    "tampered chunk",
+			payload: streamingSigned,
+			tamper:  func(body string) string { return strings.Replace(body, "world", "w0rld", 1) },
+			wantErr: errSignatureInvalid,
+		},
+		{
+			name:    "unsigned chunks",
+			payload: streamingUnsigned,
+			tamper:  func(string) string { return "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n" },
+			want:    "hello world",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "http://localhost:9000/localshare/hello.txt", nil)
+			signRequest(r, testAccessKey, testSecretKey, now, tt.payload)
+			auth, err := parseAuthHeader(r.Header.Get("Authorization"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			amzDate := now.Format(amzDateFormat)
+			body := chunkedBody(chunkSigner{
+				key:     signingKey(testSecretKey, auth.cred),
+				amzDate: amzDate,
+				scope:   auth.cred.scope(),
+				prev:    auth.signature,
+			}, chunks, "")
+			if tt.tamper != nil {
+				body = tt.tamper(body)
+			}
+			r.Body = io.NopCloser(strings.NewReader(body))
+
+			if err := verifyRequest(r, testAccessKey, testSecretKey, now); err != nil {
+				t.Fatalf("verifyRequest: %v", err)
+			}
+			got, err := io.ReadAll(r.Body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reading body: error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// FileName is the full-text index's file inside the state directory
+const FileName = "index.json"
+
+// maxIndexedBytes is how much of each file is indexed
+const maxIndexedBytes = 1 << 20
+
+// Terms shorter or longer than these are not indexed
+const (
+	minTermLength = 2
+	maxTermLength = 64
+)
+
+// Indexable reports whether the content of the named file is indexed
+func Indexable(name string) bool {
+	return fileutil.IsText(name)
+}
+
+// document is the indexed content of one file. ModTime and Size identify
+// the content the terms were read from.
+type document struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+	Terms   []string  `json:"terms"`
+}
+
+// Index is a full-text index of the text files in the upload directory,
+// persisted as the terms of each file. Every protocol updates it with Add
+// and Remove as files are written and deleted, and Sync catches up with
+// changes made directly on disk. Files are read without holding the lock,
+// so searches never wait for indexing.
+type Index struct {
+	config *config.Store
+	path   string
+
+	mu       sync.Mutex
+	docs     map[string]document
+	postings map[string]map[string]bool
+}
+
+// Open loads the full-text index at path, starting empty if it does not exist
+func Open(cfg *config.Store, path string) (*Index, error) {
+	x := &Index{
+		config:   cfg,
+		path:     path,
+		docs:     make(map[string]document),
+		postings: make(map[string]map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search index: %w", err)
+	}
+	if err := json.Unmarshal(data, &x.docs); err != nil {
+		return nil, fmt.Errorf("failed to parse search index: %w", err)
+	}
+	for name, doc := range x.docs {
+		x.post(name, doc.Terms)
+	}
+	return x, nil
+}
+
+// Add indexes the file at filePath, which was just written. Files that are
+// not indexable are dropped from the index instead.
+func (x *Index) Add(filePath string) error {
+	if !x.config.Get().SearchIndex {
+		return nil
+	}
+
+	name := filepath.Base(filePath)
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() || !Indexable(name) {
+		return x.Remove(name)
+	}
+
+	terms, err := readTerms(filePath)
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(name)
+	x.docs[name] = document{ModTime: info.ModTime().UTC(), Size: info.Size(), Terms: terms}
+	x.post(name, terms)
+	return x.save()
+}
+
+// Remove drops the named file from the index
+func (x *Index) Remove(name string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if _, ok := x.docs[name]; !ok {
+		return nil
+	}
+	x.remove(name)
+	return x.save()
+}
+
+// Sync reconciles the index with dir, indexing text files that are new or
+// changed and dropping files that are gone. Changes Add and Remove make
+// while Sync runs take precedence over what it found.
+func (x *Index) Sync(dir string) error {
+	// Snapshot the index before listing, so files added after the listing
+	// are not mistaken for removed ones
+	x.mu.Lock()
+	known := make(map[string]document, len(x.docs))
+	for name, doc := range x.docs {
+		known[name] = doc
+	}
+	x.mu.Unlock()
+
+	files, err := fileutil.ListFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	type update struct {
+		name string
+		doc  document
+	}
+	var updates []update
+	current := make(map[string]bool, len(files))
+	for _, f := range files {
+		if f.IsDir || !Indexable(f.Name) {
+			continue
+		}
+		current[f.Name] = true
+
+		if doc, ok := known[f.Name]; ok && doc.Size == f.Size && doc.ModTime.Equal(f.ModifiedTime) {
+			continue
+		}
+		terms, err := readTerms(filepath.Join(dir, f.Name))
+		if err != nil {
+			continue
+		}
+		updates = append(updates, update{f.Name, document{ModTime: f.ModifiedTime.UTC(), Size: f.Size, Terms: terms}})
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	changed := false
+	for _, u := range updates {
+		if !x.unchanged(u.name, known) {
+			continue
+		}
+		x.remove(u.name)
+		x.docs[u.name] = u.doc
+		x.post(u.name, u.doc.Terms)
+		changed = true
+	}
+	for name := range known {
+		if !current[name] && x.unchanged(name, known) {
+			x.remove(name)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return x.save()
+}
+
+// unchanged reports whether the entry for name is still the one in
+// snapshot. The caller must hold x.mu.
+func (x *Index) unchanged(name string, snapshot map[string]document) bool {
+	doc, ok := x.docs[name]
+	prev, wasKnown := snapshot[name]
+	if ok != wasKnown {
+		return false
+	}
+	return !ok || (doc.Size == prev.Size && doc.ModTime.Equal(prev.ModTime))
+}
+
+// Search returns the names of indexed files containing every word of text
+func (x *Index) Search(text string) map[string]bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	matches := make(map[string]bool)
+	terms := tokenize(text)
+	if len(terms) == 0 {
+		return matches
+	}
+	for name := range x.postings[terms[0]] {
+		matches[name] = true
+	}
+	for _, term := range terms[1:] {
+		for name := range matches {
+			if !x.postings[term][name] {
+				delete(matches, name)
+			}
+		}
+	}
+	return matches
+}
+
+// post adds a file's terms to the postings. The caller must hold x.mu.
+func (x *Index) post(name string, terms []string) {
+	for _, term := range terms {
+		if x.postings[term] == nil {
+			x.postings[term] = make(map[string]bool)
+		}
+		x.postings[term][name] = true
+	}
+}
+
+// remove drops a file from the index. The caller must hold x.mu.
+func (x *Index) remove(name string) {
+	for _, term := range x.docs[name].Terms {
+		delete(x.postings[term], name)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	delete(x.docs, name)
+}
+
+// save writes the index atomically. Every change rewrites the whole index,
+// which grows with the text indexed, so Sync saves once per pass. The
+// caller must hold x.mu.
+func (x *Index) save() error {
+	data, err := json.Marshal(x.docs)
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(x.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save search index: %w", err)
+	}
+	return nil
+}
+
+// readTerms returns the distinct terms in the start of a text file. Files
+// that look binary have no terms.
+func readTerms(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxIndexedBytes))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8192)], 0) >= 0 {
+		return nil, nil
+	}
+	return tokenize(string(data)), nil
+}
+
+// tokenize splits text into distinct lowercase words of letters and digits
+func tokenize(text string) []string {
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := len([]rune(word)); n >= minTermLength && n <= maxTermLength {
+			seen[word] = true
+		}
+	}
+
+	terms := make([]string, 0, len(seen))
+	for term := range seen {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
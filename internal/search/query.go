@@ -0,0 +1,159 @@
+package search
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+)
+
+// Query describes the files to find. Zero fields match every file.
+type Query struct {
+	// Name matches file names fuzzily: its characters must appear in order
+	Name string
+	// Glob matches file names against a shell pattern such as *.pdf
+	Glob string
+	// Tags must all be present on a file, ignoring case
+	Tags []string
+	// Uploader and Type match the recorded uploader and the start of the
+	// MIME type, ignoring case
+	Uploader string
+	Type     string
+
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	MinSize        int64
+	// MaxSize is the largest size in bytes to match, or negative for no limit
+	MaxSize int64
+
+	// Text is a full-text query; files must contain all of its words
+	Text string
+}
+
+// Filter returns the files matching q. textMatches holds the names of files
+// matching q.Text and is ignored if q.Text is empty. Results are ordered by
+// how well their names match q.Name, or newest first without one.
+func Filter(files []models.FileInfo, q Query, textMatches map[string]bool) []models.FileInfo {
+	type result struct {
+		file  models.FileInfo
+		score int
+	}
+
+	var results []result
+	for _, f := range files {
+		if f.IsDir {
+			continue
+		}
+		score, ok := q.match(f)
+		if !ok || (q.Text != "" && !textMatches[f.Name]) {
+			continue
+		}
+		results = append(results, result{f, score})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].file.ModifiedTime.After(results[j].file.ModifiedTime)
+	})
+
+	matched := make([]models.FileInfo, len(results))
+	for i, r := range results {
+		matched[i] = r.file
+	}
+	return matched
+}
+
+// match reports whether f matches every criterion except the text query,
+// along with how well its name matches
+func (q Query) match(f models.FileInfo) (int, bool) {
+	score := 0
+	if q.Name != "" {
+		var ok bool
+		if score, ok = fuzzyScore(q.Name, f.Name); !ok {
+			return 0, false
+		}
+	}
+	if q.Glob != "" {
+		if ok, _ := path.Match(strings.ToLower(q.Glob), strings.ToLower(f.Name)); !ok {
+			return 0, false
+		}
+	}
+
+	if !q.ModifiedAfter.IsZero() && f.ModifiedTime.Before(q.ModifiedAfter) {
+		return 0, false
+	}
+	if !q.ModifiedBefore.IsZero() && f.ModifiedTime.After(q.ModifiedBefore) {
+		return 0, false
+	}
+	if f.Size < q.MinSize || (q.MaxSize >= 0 && f.Size > q.MaxSize) {
+		return 0, false
+	}
+
+	if len(q.Tags) == 0 && q.Uploader == "" && q.Type == "" {
+		return score, true
+	}
+	md := f.Metadata
+	if md == nil {
+		return 0, false
+	}
+	for _, tag := range q.Tags {
+		if !hasTag(md.Tags, tag) {
+			return 0, false
+		}
+	}
+	if q.Uploader != "" && !strings.EqualFold(md.Uploader, q.Uploader) {
+		return 0, false
+	}
+	if q.Type != "" && !strings.HasPrefix(strings.ToLower(md.MIMEType), strings.ToLower(q.Type)) {
+		return 0, false
+	}
+	return score, true
+}
+
+// hasTag reports whether tags contains tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyScore reports whether the characters of pattern appear in name in
+// order, ignoring case. Matches that are consecutive, start words or form a
+// substring of name score higher.
+func fuzzyScore(pattern, name string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	n := []rune(strings.ToLower(name))
+
+	score := 0
+	pi := 0
+	last := -2
+	for ni := 0; ni < len(n) && pi < len(p); ni++ {
+		if n[ni] != p[pi] {
+			continue
+		}
+		score++
+		if ni == last+1 {
+			score += 5
+		}
+		if ni == 0 || !unicode.IsLetter(n[ni-1]) && !unicode.IsDigit(n[ni-1]) {
+			score += 3
+		}
+		last = ni
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	if strings.Contains(string(n), string(p)) {
+		score += 20
+	}
+	return score, true
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles administrative requests
+type AdminHandler struct {
+	config  *config.Store
+	reload  func() error
+	content *dedup.Store
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(cfg *config.Store, reload func() error, content *dedup.Store) *AdminHandler {
+	return &AdminHandler{
+		config:  cfg,
+		reload:  reload,
+		content: content,
+	}
+}
+
+// ReloadConfig re-reads the config file and applies it without a restart
+func (h *AdminHandler) ReloadConfig(c *gin.Context) {
+	if err := h.reload(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Failed to reload configuration: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Configuration reloaded successfully",
+	})
+}
+
+// GetStats reports how many files are shared, their total size and the
+// disk space deduplication saves
+func (h *AdminHandler) GetStats(c *gin.Context) {
+	files, err := fileutil.ListFiles(h.config.Get().UploadDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to list files",
+		})
+		return
+	}
+
+	var stats models.AdminStats
+	for _, f := range files {
+		if f.IsDir {
+			continue
+		}
+		stats.Files++
+		stats.TotalBytes += f.Size
+	}
+
+	stats.Dedup, err = h.content.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to read content store",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetSettings returns the settings that can be changed at runtime
+func (h *AdminHandler) GetSettings(c *gin.Context) {
+	cfg := h.config.Get()
+	c.JSON(http.StatusOK, models.AdminSettingsResponse{
+		Settings:  settingsFromConfig(cfg),
+		Persisted: cfg.ConfigFile != "",
+	})
+}
+
+// UpdateSettings applies a partial settings update, saves it to the config
+// file when there is one, and makes it effective immediately
+func (h *AdminHandler) UpdateSettings(c *gin.Context) {
+	var req models.AdminSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	// With a config file, settings given as flags or environment variables
+	// would silently win over the saved value on the next reload
+	if cfg := h.config.Get(); cfg.ConfigFile != "" {
+		for _, key := range settingsKeys(req) {
+			if source, ok := cfg.Overrides[key]; ok {
+				c.JSON(http.StatusConflict, models.ErrorResponse{
+					Error: "Cannot change " + key + ": it is set by " + source + ", which takes precedence over the config file",
+				})
+				return
+			}
+		}
+	}
+
+	next, err := h.config.Update(func(next *config.Config) error {
+		values := make(map[string]any)
+		if req.PIN != nil {
+			next.PIN = strings.TrimSpace(*req.PIN)
+			values["pin"] = next.PIN
+		}
+		if req.AdminAuth != nil {
+			next.AdminAuth = *req.AdminAuth
+			values["admin_auth"] = next.AdminAuth
+		}
+		if req.MaxFileSizeMB != nil {
+			next.MaxFileSizeMB = *req.MaxFileSizeMB
+			values["max_file_size_mb"] = next.MaxFileSizeMB
+		}
+
+		// Validate before touching the file so bad values are never persisted
+		if err := next.Validate(); err != nil {
+			return err
+		}
+		if next.ConfigFile == "" || len(values) == 0 {
+			return nil
+		}
+		return config.UpdateFile(next.ConfigFile, values)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	resp := models.AdminSettingsResponse{
+		Settings:  settingsFromConfig(next),
+		Persisted: next.ConfigFile != "",
+		Message:   "Settings updated successfully",
+	}
+	if !resp.Persisted {
+		resp.Message = "Settings updated until the next restart (no config file; start with --config to save changes)"
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// settingsKeys returns the config file keys of the settings req changes
+func settingsKeys(req models.AdminSettingsRequest) []string {
+	var keys []string
+	if req.PIN != nil {
+		keys = append(keys, "pin")
+	}
+	if req.AdminAuth != nil {
+		keys = append(keys, "admin_auth")
+	}
+	if req.MaxFileSizeMB != nil {
+		keys = append(keys, "max_file_size_mb")
+	}
+	return keys
+}
+
+// settingsFromConfig extracts the runtime-editable settings from cfg
+func settingsFromConfig(cfg *config.Config) models.AdminSettings {
+	return models.AdminSettings{
+		PINSet:        cfg.IsPINProtected(),
+		AdminAuth:     cfg.AdminAuth,
+		MaxFileSizeMB: cfg.MaxFileSizeMB,
+	}
+}
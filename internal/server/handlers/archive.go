@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/OderoCeasar/localshare/internal/archive"
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// ListArchive lists the entries of a zip, tar or tar.gz archive without
+// extracting it
+func (h *FileHandler) ListArchive(c *gin.Context) {
+	cfg := h.config.Get()
+	filePath, ok := archivePath(c, cfg)
+	if !ok {
+		return
+	}
+
+	resp := models.ArchiveListResponse{
+		Format:  archive.Detect(filePath),
+		Entries: []models.ArchiveEntry{},
+	}
+	err := archive.Walk(filePath, resp.Format, archiveLimits(cfg), func(e archive.Entry, _ io.Reader) error {
+		if e.Unsafe || e.Type == archive.TypeHardlink || e.Type == archive.TypeOther {
+			resp.Skipped++
+			return nil
+		}
+		resp.Entries = append(resp.Entries, models.ArchiveEntry{
+			Name:         e.Name,
+			Size:         e.Size,
+			ModifiedTime: e.ModTime,
+			IsDir:        e.Type == archive.TypeDir,
+			Symlink:      e.Type == archive.TypeSymlink,
+		})
+		resp.TotalSize += e.Size
+		return nil
+	})
+	if err != nil {
+		archiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DownloadArchiveEntry streams one file out of a zip, tar or tar.gz archive
+func (h *FileHandler) DownloadArchiveEntry(c *gin.Context) {
+	cfg := h.config.Get()
+	filePath, ok := archivePath(c, cfg)
+	if !ok {
+		return
+	}
+
+	name, err := archive.CleanName(strings.TrimPrefix(c.Param("entry"), "/"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid entry name",
+		})
+		return
+	}
+
+	err = archive.Open(filePath, archive.Detect(filePath), name, archiveLimits(cfg), func(e archive.Entry, r io.Reader) error {
+		h.audit.Record(models.AuditEvent{
+			Action:   audit.ActionDownload,
+			Protocol: audit.ProtocolHTTP,
+			Actor:    sessionActor(c, h.config),
+			ClientIP: c.ClientIP(),
+			Filename: path.Base(filePath),
+			Target:   "entry " + e.Name,
+			Size:     e.Size,
+		})
+
+		contentType := mime.TypeByExtension(path.Ext(e.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(e.Name)}))
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Length", strconv.FormatInt(e.Size, 10))
+		c.Status(http.StatusOK)
+
+		// Once streaming has started, a failure can only cut the response
+		// short of its Content-Length
+		io.Copy(c.Writer, r)
+		return nil
+	})
+	if err != nil {
+		archiveError(c, err)
+	}
+}
+
+// archivePath returns the path of the archive named in the request, or
+// responds with an error if it is missing or not a supported archive
+func archivePath(c *gin.Context, cfg *config.Config) (string, bool) {
+	filePath, err := fileutil.GetFilePath(cfg.UploadDir, c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return "", false
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "File not found",
+		})
+		return "", false
+	}
+
+	if archive.Detect(filePath) == "" {
+		c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+			Error: "Not an archive: " + archive.ErrUnsupported.Error(),
+		})
+		return "", false
+	}
+	return filePath, true
+}
+
+// archiveLimits returns the configured limits on reading archives
+func archiveLimits(cfg *config.Config) archive.Limits {
+	return archive.Limits{
+		MaxEntries: cfg.ArchiveMaxEntries,
+		MaxSize:    cfg.ArchiveMaxSize(),
+	}
+}
+
+// archiveError responds to a failure to read an archive
+func archiveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Entry not found",
+		})
+	case errors.Is(err, archive.ErrTooManyEntries), errors.Is(err, archive.ErrTooLarge):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: "Archive refused: " + err.Error(),
+		})
+	case errors.Is(err, archive.ErrFormat):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: "Failed to read archive: " + err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to read archive",
+		})
+	}
+}
+
+// errTargetExists is returned when the folder an archive would be unpacked
+// into is already taken
+var errTargetExists = errors.New("target already exists")
+
+// ExtractArchive unpacks a stored zip, tar or tar.gz archive into a new
+// folder next to it, keeping the archive
+func (h *FileHandler) ExtractArchive(c *gin.Context) {
+	var req models.ExtractRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid request format",
+			})
+			return
+		}
+	}
+
+	cfg := h.config.Get()
+	filePath, ok := archivePath(c, cfg)
+	if !ok {
+		return
+	}
+
+	res, err := h.quota.Reserve(0)
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+	defer res.Release()
+
+	name := path.Base(filePath)
+	result, err := h.extract(cfg, filePath, archive.Detect(name), extractTarget(req.Target, name), res)
+	if err != nil {
+		extractError(c, err)
+		return
+	}
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionExtract,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: name,
+		Target:   result.Target,
+		Size:     result.Bytes,
+	})
+	h.events.Publish(models.Event{Type: events.TypeAdded, Filename: result.Target})
+
+	c.JSON(http.StatusOK, models.ExtractResponse{
+		Message:   "Archive extracted successfully",
+		Extracted: result,
+	})
+}
+
+// extractTarget returns the folder an archive is unpacked into: target if
+// given, or else the archive's name without its extension
+func extractTarget(target, archiveName string) string {
+	if target == "" {
+		return archive.TrimExt(archiveName)
+	}
+	return target
+}
+
+// extract unpacks the archive at src into a new folder of the upload
+// directory named target. The archive is unpacked into a staging directory
+// first, so the folder only appears once every entry was accepted.
+func (h *FileHandler) extract(cfg *config.Config, src, format, target string, res *quota.Reservation) (models.ExtractResult, error) {
+	// The target is a single folder name; paths are refused rather than
+	// cut down to their last element
+	safeTarget, err := fileutil.SanitizeFilename(target)
+	if err != nil {
+		return models.ExtractResult{}, err
+	}
+	if safeTarget != target {
+		return models.ExtractResult{}, fileutil.ErrInvalidPath
+	}
+	dst := filepath.Join(cfg.UploadDir, safeTarget)
+	if _, err := os.Lstat(dst); err == nil {
+		return models.ExtractResult{}, errTargetExists
+	}
+
+	tmpDir, err := fileutil.StateDir(cfg.UploadDir, "extract-tmp")
+	if err != nil {
+		return models.ExtractResult{}, err
+	}
+	staging, err := os.MkdirTemp(tmpDir, "extract-*")
+	if err != nil {
+		return models.ExtractResult{}, err
+	}
+	defer os.RemoveAll(staging)
+
+	sum, err := archive.Extract(src, format, staging, archive.ExtractOptions{
+		Limits:      archiveLimits(cfg),
+		MaxFileSize: cfg.MaxFileSize(),
+		Wrap:        res.Writer,
+	})
+	if err != nil {
+		return models.ExtractResult{}, err
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		return models.ExtractResult{}, err
+	}
+
+	// Renaming onto an existing empty directory would succeed, so check
+	// once more for a folder created meanwhile
+	if _, err := os.Lstat(dst); err == nil {
+		return models.ExtractResult{}, errTargetExists
+	}
+	if err := os.Rename(staging, dst); err != nil {
+		return models.ExtractResult{}, err
+	}
+
+	return models.ExtractResult{
+		Target: safeTarget,
+		Files:  sum.Files,
+		Dirs:   sum.Dirs,
+		Bytes:  sum.Bytes,
+	}, nil
+}
+
+// extractError responds to a failure to unpack an archive
+func extractError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, fileutil.ErrInvalidPath):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid target folder name",
+		})
+	case errors.Is(err, errTargetExists):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Extraction refused: " + err.Error(),
+		})
+	case quota.IsLimit(err):
+		respondStorageError(c, err)
+	case errors.Is(err, archive.ErrUnsafeName), errors.Is(err, archive.ErrLink),
+		errors.Is(err, archive.ErrSpecialFile), errors.Is(err, archive.ErrFileTooLarge),
+		errors.Is(err, archive.ErrTooManyEntries), errors.Is(err, archive.ErrTooLarge):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: "Extraction refused: " + err.Error(),
+		})
+	case errors.Is(err, archive.ErrFormat):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: "Failed to read archive: " + err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to extract archive",
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/models"
+)
+
+// zipOf returns a zip archive holding the named contents
+func zipOf(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// siteEntries is the content of the archive extracted by the folder tests
+var siteEntries = map[string]string{
+	"index.html":   "<h1>hi</h1>",
+	"css/site.css": "body{}",
+}
+
+// newSiteServer returns a test server with site.zip extracted into site/
+func newSiteServer(t *testing.T) *testServer {
+	t.Helper()
+	ts := newTestServer(t)
+	w := ts.upload(t, "site.zip", zipOf(t, siteEntries), map[string]string{"extract": "true"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("extracting upload = %d %s", w.Code, w.Body)
+	}
+	return ts
+}
+
+func TestListFolder(t *testing.T) {
+	ts := newSiteServer(t)
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantFiles map[string]bool // names, and whether each is a folder
+	}{
+		{path: "", wantCode: http.StatusOK, wantFiles: map[string]bool{"site": true}},
+		{path: "site", wantCode: http.StatusOK, wantFiles: map[string]bool{"index.html": false, "css": true}},
+		{path: "site/css/", wantCode: http.StatusOK, wantFiles: map[string]bool{"site.css": false}},
+		{path: "site/index.html", wantCode: http.StatusNotFound},
+		{path: "missing", wantCode: http.StatusNotFound},
+		{path: "site/../..", wantCode: http.StatusBadRequest},
+		{path: ".localshare", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := ts.do(http.MethodGet, "/api/files?path="+tt.path, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp models.FilesListResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Files) != len(tt.wantFiles) {
+				t.Fatalf("files = %+v, want %v", resp.Files, tt.wantFiles)
+			}
+			for _, f := range resp.Files {
+				isDir, ok := tt.wantFiles[f.Name]
+				if !ok || isDir != f.IsDir {
+					t.Errorf("listed %s (folder %v), want %v", f.Name, f.IsDir, tt.wantFiles)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadFromFolder(t *testing.T) {
+	ts := newSiteServer(t)
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{path: "site/css/site.css", wantCode: http.StatusOK, wantBody: "body{}"},
+		{path: "site/index.html", wantCode: http.StatusOK, wantBody: "<h1>hi</h1>"},
+		{path: "site", wantCode: http.StatusNotFound},
+		{path: "site/css", wantCode: http.StatusNotFound},
+		{path: "site/missing.txt", wantCode: http.StatusNotFound},
+		{path: "site/.localshare/x", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := ts.do(http.MethodGet, "/api/files/download/"+tt.path, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// Text previews resolve the same paths
+	if w := ts.do(http.MethodGet, "/api/files/text/site/css/site.css", nil, ""); w.Code != http.StatusOK {
+		t.Errorf("text preview of site/css/site.css = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUploadOverFolder(t *testing.T) {
+	ts := newSiteServer(t)
+
+	w := ts.upload(t, "site", []byte("not a folder"), nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("upload over a folder = %d %s, want 409", w.Code, w.Body)
+	}
+	if info, err := os.Stat(filepath.Join(ts.uploadDir, "site", "css", "site.css")); err != nil || info.Size() != 6 {
+		t.Errorf("folder content after refused upload: %v, %v", info, err)
+	}
+}
+
+func TestDeleteFolder(t *testing.T) {
+	tests := []struct {
+		name      string
+		trashDays int
+	}{
+		{name: "to the trash", trashDays: 30},
+		{name: "trash disabled", trashDays: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newSiteServer(t)
+			ts.config.Update(func(next *config.Config) error {
+				next.TrashDays = tt.trashDays
+				return nil
+			})
+
+			w := ts.do(http.MethodDelete, "/api/files/site", nil, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("delete = %d %s", w.Code, w.Body)
+			}
+			if _, err := os.Stat(filepath.Join(ts.uploadDir, "site")); !os.IsNotExist(err) {
+				t.Errorf("site still exists: %v", err)
+			}
+
+			items := ts.trash.List()
+			if tt.trashDays == 0 {
+				if len(items) != 0 {
+					t.Errorf("trash holds %+v with the trash disabled", items)
+				}
+				return
+			}
+			if len(items) != 1 || items[0].OriginalPath != "site" || items[0].Size != 17 {
+				t.Fatalf("trash = %+v, want site holding 17 bytes", items)
+			}
+
+			// The folder can be restored whole, deleted again and purged
+			if w := ts.do(http.MethodPost, "/api/admin/trash/"+items[0].ID+"/restore", nil, ""); w.Code != http.StatusOK {
+				t.Fatalf("restore = %d %s", w.Code, w.Body)
+			}
+			if w := ts.do(http.MethodGet, "/api/files/download/site/css/site.css", nil, ""); w.Code != http.StatusOK {
+				t.Errorf("download after restore = %d %s", w.Code, w.Body)
+			}
+			if w := ts.do(http.MethodDelete, "/api/files/site", nil, ""); w.Code != http.StatusOK {
+				t.Fatalf("second delete = %d %s", w.Code, w.Body)
+			}
+			id := ts.trash.List()[0].ID
+			if w := ts.do(http.MethodDelete, "/api/admin/trash/"+id, nil, ""); w.Code != http.StatusOK {
+				t.Fatalf("purge = %d %s", w.Code, w.Body)
+			}
+			if n := len(ts.trash.List()); n != 0 {
+				t.Errorf("trash holds %d items after purging", n)
+			}
+			if _, err := os.Stat(filepath.Join(ts.uploadDir, ".localshare", "trash", id)); !os.IsNotExist(err) {
+				t.Errorf("purged folder still exists: %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	ts := newTestServer(t)
+	files := map[string][]byte{
+		"docs.zip":   zipOf(t, map[string]string{"a.txt": "a", "b.txt": "b", "../evil.txt": "x"}),
+		"broken.zip": []byte("PK not really a zip"),
+		"notes.txt":  []byte("not an archive"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(ts.uploadDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		target        string
+		maxEntries    int
+		wantCode      int
+		wantErrPrefix string
+	}{
+		{name: "missing archive", target: "gone.zip", wantCode: http.StatusNotFound, wantErrPrefix: "File not found"},
+		{name: "not an archive", target: "notes.txt", wantCode: http.StatusUnsupportedMediaType, wantErrPrefix: "Not an archive"},
+		{name: "corrupt archive", target: "broken.zip", wantCode: http.StatusUnprocessableEntity, wantErrPrefix: "Failed to read archive"},
+		{name: "too many entries", target: "docs.zip", maxEntries: 2, wantCode: http.StatusUnprocessableEntity, wantErrPrefix: "Archive refused"},
+		{name: "missing entry", target: "docs.zip/c.txt", wantCode: http.StatusNotFound, wantErrPrefix: "Entry not found"},
+		{name: "unsafe entry", target: "docs.zip/..%2Fevil.txt", wantCode: http.StatusBadRequest, wantErrPrefix: "Invalid entry name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.config.Update(func(next *config.Config) error {
+				next.ArchiveMaxEntries = config.Default().ArchiveMaxEntries
+				if tt.maxEntries != 0 {
+					next.ArchiveMaxEntries = tt.maxEntries
+				}
+				return nil
+			})
+
+			w := ts.do(http.MethodGet, "/api/files/archive/"+tt.target, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("archive = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if got := decodeError(t, w); !strings.HasPrefix(got, tt.wantErrPrefix) {
+				t.Errorf("error = %q, want it to start with %q", got, tt.wantErrPrefix)
+			}
+		})
+	}
+
+	// Unsafe entries are left out of the listing rather than failing it
+	w := ts.do(http.MethodGet, "/api/files/archive/docs.zip", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d %s", w.Code, w.Body)
+	}
+	var resp models.ArchiveListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 2 || resp.Skipped != 1 {
+		t.Errorf("listing = %d entries, %d skipped, want 2 and 1", len(resp.Entries), resp.Skipped)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	ts := newSiteServer(t)
+	files := map[string][]byte{
+		"site.zip": zipOf(t, siteEntries),
+		"evil.zip": zipOf(t, map[string]string{"ok.txt": "fine", "../../escape.txt": "x"}),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(ts.uploadDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		archive       string
+		body          string
+		wantCode      int
+		wantErrPrefix string
+		wantMissing   string // a folder that must not have been created
+	}{
+		{name: "target exists", archive: "site.zip", wantCode: http.StatusConflict, wantErrPrefix: "Extraction refused: target already exists"},
+		{name: "target is a path", archive: "site.zip", body: `{"target":"a/b"}`, wantCode: http.StatusBadRequest, wantErrPrefix: "Invalid target folder name"},
+		{name: "unsafe entry", archive: "evil.zip", wantCode: http.StatusUnprocessableEntity, wantErrPrefix: "Extraction refused: unsafe entry name", wantMissing: "evil"},
+		{name: "missing archive", archive: "gone.zip", wantCode: http.StatusNotFound, wantErrPrefix: "File not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(http.MethodPost, "/api/admin/extract/"+tt.archive, strings.NewReader(tt.body), "application/json")
+			if w.Code != tt.wantCode {
+				t.Fatalf("extract = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if got := decodeError(t, w); !strings.HasPrefix(got, tt.wantErrPrefix) {
+				t.Errorf("error = %q, want it to start with %q", got, tt.wantErrPrefix)
+			}
+			if tt.wantMissing != "" {
+				if _, err := os.Stat(filepath.Join(ts.uploadDir, tt.wantMissing)); !os.IsNotExist(err) {
+					t.Errorf("%s exists after a refused extraction: %v", tt.wantMissing, err)
+				}
+			}
+		})
+	}
+
+	// The existing folder is left as it was
+	if data, err := os.ReadFile(filepath.Join(ts.uploadDir, "site", "index.html")); err != nil || string(data) != siteEntries["index.html"] {
+		t.Errorf("site/index.html = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(ts.uploadDir), "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("unsafe entry was written outside the upload directory: %v", err)
+	}
+}
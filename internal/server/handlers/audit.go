@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 500
+	maxAuditLimit     = 10000
+)
+
+// AuditHandler serves the audit trail
+type AuditHandler struct {
+	audit *audit.Log
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditLog *audit.Log) *AuditHandler {
+	return &AuditHandler{
+		audit: auditLog,
+	}
+}
+
+// ListEvents returns audit events filtered by the from, to, action and
+// limit query parameters, as JSON or as CSV when format=csv
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid audit query: " + err.Error(),
+		})
+		return
+	}
+
+	events, truncated, err := h.audit.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to read audit log",
+		})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		filename := fmt.Sprintf("localshare-audit-%s.csv", time.Now().Format("20060102-150405"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+		audit.WriteCSV(c.Writer, events)
+		return
+	}
+
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, models.AuditResponse{
+		Events:    events,
+		Truncated: truncated,
+	})
+}
+
+// parseAuditFilter builds a filter from the request's query parameters.
+// Times may be RFC 3339 timestamps or plain dates; a plain "to" date
+// includes that whole day.
+func parseAuditFilter(c *gin.Context) (audit.Filter, error) {
+	filter := audit.Filter{Limit: defaultAuditLimit}
+
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseAuditTime(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from time %q", from)
+		}
+		filter.Since = t
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseAuditTime(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to time %q", to)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.Until = t
+	}
+
+	if actions := c.Query("action"); actions != "" {
+		for _, action := range strings.Split(actions, ",") {
+			action = strings.TrimSpace(action)
+			if !audit.ValidAction(action) {
+				return filter, fmt.Errorf("invalid action %q", action)
+			}
+			filter.Actions = append(filter.Actions, action)
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// parseAuditTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date in UTC
+func parseAuditTime(s string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	return t, false, err
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/OderoCeasar/localshare/internal/audit"
 	"github.com/OderoCeasar/localshare/internal/config"
 	"github.com/OderoCeasar/localshare/internal/models"
 )
@@ -17,16 +18,45 @@ const (
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	config *config.Config
+	config *config.Store
+	audit  *audit.Log
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
+func NewAuthHandler(cfg *config.Store, auditLog *audit.Log) *AuthHandler {
 	return &AuthHandler{
 		config: cfg,
+		audit:  auditLog,
 	}
 }
 
+// sessionActor identifies who a request acts as for the audit trail: the
+// admin username, "pin" for PIN-verified sessions, or "" for anonymous ones
+func sessionActor(c *gin.Context, cfg *config.Store) string {
+	session := sessions.Default(c)
+	if session.Get(sessionKeyAdmin) == cfg.AdminToken() {
+		return cfg.Get().AdminUser
+	}
+	if session.Get(sessionKeyPIN) == cfg.PINToken() {
+		return "pin"
+	}
+	return ""
+}
+
+// recordLogin adds a login attempt to the audit trail
+func (h *AuthHandler) recordLogin(c *gin.Context, actor string, success bool) {
+	action := audit.ActionLogin
+	if !success {
+		action = audit.ActionLoginFailed
+	}
+	h.audit.Record(models.AuditEvent{
+		Action:   action,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    actor,
+		ClientIP: c.ClientIP(),
+	})
+}
+
 // VerifyPIN handles PIN verification requests
 func (h *AuthHandler) VerifyPIN(c *gin.Context) {
 	var req models.PINRequest
@@ -38,9 +68,12 @@ func (h *AuthHandler) VerifyPIN(c *gin.Context) {
 	}
 
 	// Use constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(req.PIN), []byte(h.config.PIN)) == 1 {
+	cfg := h.config.Get()
+	if subtle.ConstantTimeCompare([]byte(req.PIN), []byte(cfg.PIN)) == 1 {
+		h.recordLogin(c, "pin", true)
+
 		session := sessions.Default(c)
-		session.Set(sessionKeyPIN, true)
+		session.Set(sessionKeyPIN, h.config.PINToken())
 		if err := session.Save(); err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error: "Failed to save session",
@@ -53,6 +86,7 @@ func (h *AuthHandler) VerifyPIN(c *gin.Context) {
 			Message: "PIN verified successfully",
 		})
 	} else {
+		h.recordLogin(c, "pin", false)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error: "Invalid PIN",
 		})
@@ -70,12 +104,15 @@ func (h *AuthHandler) AdminLogin(c *gin.Context) {
 	}
 
 	// Use constant-time comparison for both username and password
-	userMatch := subtle.ConstantTimeCompare([]byte(req.Username), []byte(h.config.AdminUser)) == 1
-	passMatch := subtle.ConstantTimeCompare([]byte(req.Password), []byte(h.config.AdminPass)) == 1
+	cfg := h.config.Get()
+	userMatch := subtle.ConstantTimeCompare([]byte(req.Username), []byte(cfg.AdminUser)) == 1
+	passMatch := subtle.ConstantTimeCompare([]byte(req.Password), []byte(cfg.AdminPass)) == 1
 
 	if userMatch && passMatch {
+		h.recordLogin(c, req.Username, true)
+
 		session := sessions.Default(c)
-		session.Set(sessionKeyAdmin, true)
+		session.Set(sessionKeyAdmin, h.config.AdminToken())
 		if err := session.Save(); err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error: "Failed to save session",
@@ -88,6 +125,7 @@ func (h *AuthHandler) AdminLogin(c *gin.Context) {
 			Message: "Admin login successfully",
 		})
 	} else {
+		h.recordLogin(c, req.Username, false)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error: "Invalid credentials",
 		})
@@ -6,25 +6,42 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/OderoCeasar/localshare/internal/config"
 	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
 )
 
 // ConfigHandler handles configuration-related requests
 type ConfigHandler struct {
-	config *config.Config
+	config *config.Store
+	quota  *quota.Guard
 }
 
 // NewConfigHandler creates a new config handler
-func NewConfigHandler(cfg *config.Config) *ConfigHandler {
+func NewConfigHandler(cfg *config.Store, guard *quota.Guard) *ConfigHandler {
 	return &ConfigHandler{
 		config: cfg,
+		quota:  guard,
 	}
 }
 
 // GetConfig returns the server configuration
 func (h *ConfigHandler) GetConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, models.ConfigResponse{
-		PINProtected:  h.config.IsPINProtected(),
-		AdminRequired: h.config.IsAdminAuthEnabled(),
-		MaxFileSize:   h.config.MaxFileSize(),
-	})
+	cfg := h.config.Get()
+	response := models.ConfigResponse{
+		PINProtected:  cfg.IsPINProtected(),
+		AdminRequired: cfg.IsAdminAuthEnabled(),
+		MaxFileSize:   cfg.MaxFileSize(),
+	}
+
+	// Storage use is only for visitors who may see the files
+	if !cfg.IsPINProtected() || sessionActor(c, h.config) != "" {
+		if usage, err := h.quota.Usage(); err == nil {
+			response.Storage = &models.StorageUsage{
+				UsedBytes:  usage.Used,
+				QuotaBytes: usage.Quota,
+				FreeBytes:  usage.Free,
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
\ No newline at end of file
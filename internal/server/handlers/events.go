@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// keepaliveInterval is how often an idle event stream is written to, so
+// proxies and browsers don't time it out
+const keepaliveInterval = 30 * time.Second
+
+// progressInterval is the least time between progress events of an upload
+const progressInterval = 250 * time.Millisecond
+
+// upgrader accepts WebSocket connections from pages served by this server
+// only, as browsers send cookies along with cross-site WebSocket requests
+var upgrader = websocket.Upgrader{}
+
+// EventsHandler streams file changes to clients
+type EventsHandler struct {
+	events *events.Broker
+}
+
+// NewEventsHandler creates a new events handler
+func NewEventsHandler(broker *events.Broker) *EventsHandler {
+	return &EventsHandler{events: broker}
+}
+
+// Stream sends file changes and upload progress as they happen, over
+// server-sent events or, when the client asks to upgrade, a WebSocket
+func (h *EventsHandler) Stream(c *gin.Context) {
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.streamWebSocket(c)
+		return
+	}
+	h.streamSSE(c)
+}
+
+// streamSSE sends each event as a server-sent event named after its type
+func (h *EventsHandler) streamSSE(c *gin.Context) {
+	ch, cancel := h.events.Subscribe()
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Stop nginx and similar proxies from holding events back
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// streamWebSocket sends each event as a JSON text message
+func (h *EventsHandler) streamWebSocket(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	ch, cancel := h.events.Subscribe()
+	defer cancel()
+
+	// Messages from the client are not used, but reading is needed to
+	// notice when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e := <-ch:
+			conn.SetWriteDeadline(time.Now().Add(keepaliveInterval))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepaliveInterval)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// progressWriter publishes how much of an upload has arrived as it is
+// written, at most every progressInterval
+type progressWriter struct {
+	events   *events.Broker
+	uploadID string
+	filename string
+	expected int64
+	received int64
+	sent     time.Time
+}
+
+// newProgressWriter tracks the upload of filename in the current request.
+// The request's size stands in for the file's, which is not known until
+// the upload ends.
+func (h *FileHandler) newProgressWriter(c *gin.Context, filename string) *progressWriter {
+	return &progressWriter{
+		events:   h.events,
+		uploadID: c.Writer.Header().Get("X-Request-ID"),
+		filename: filename,
+		expected: max(c.Request.ContentLength, 0),
+		sent:     time.Now(),
+	}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.received += int64(len(b))
+	if now := time.Now(); now.Sub(p.sent) >= progressInterval {
+		p.sent = now
+		p.events.Publish(models.Event{
+			Type:     events.TypeProgress,
+			Filename: p.filename,
+			UploadID: p.uploadID,
+			Received: p.received,
+			Expected: p.expected,
+			Time:     now,
+		})
+	}
+	return len(b), nil
+}
@@ -1,33 +1,87 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/OderoCeasar/localshare/internal/archive"
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
 	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/metadata"
 	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/thumbnail"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
 	"github.com/OderoCeasar/localshare/pkg/fileutil"
 	"github.com/gin-gonic/gin"
 )
 
+// Headers carrying a file's checksums in hex: sent by clients to have an
+// upload verified, and returned on downloads
+const (
+	headerChecksumSHA256 = "X-Checksum-Sha256"
+	headerChecksumBLAKE3 = "X-Checksum-Blake3"
+)
+
 // FileHandler handles file-related requests
 type FileHandler struct {
-	config *config.Config
+	config     *config.Store
+	audit      *audit.Log
+	quota      *quota.Guard
+	expiry     *retention.Store
+	trash      *trash.Bin
+	versions   *versions.Store
+	checksums  *checksum.Store
+	content    *dedup.Store
+	metadata   *metadata.Store
+	index      *search.Index
+	thumbnails *thumbnail.Cache
+	events     *events.Broker
 }
 
 // NewFileHandler creates a new file handler
-func NewFileHandler(cfg *config.Config) *FileHandler {
+func NewFileHandler(cfg *config.Store, auditLog *audit.Log, guard *quota.Guard, expiry *retention.Store, bin *trash.Bin, store *versions.Store, checksums *checksum.Store, content *dedup.Store, meta *metadata.Store, index *search.Index, thumbnails *thumbnail.Cache, broker *events.Broker) *FileHandler {
 	return &FileHandler{
-		config: cfg,
+		config:     cfg,
+		audit:      auditLog,
+		quota:      guard,
+		expiry:     expiry,
+		trash:      bin,
+		versions:   store,
+		checksums:  checksums,
+		content:    content,
+		metadata:   meta,
+		index:      index,
+		thumbnails: thumbnails,
+		events:     broker,
 	}
 }
 
-// ListFiles returns a list of all uploaded files
+// ListFiles returns a list of all uploaded files, or of the files inside
+// the folder named by the path query parameter
 func (h *FileHandler) ListFiles(c *gin.Context) {
-	files, err := fileutil.ListFiles(h.config.UploadDir)
+	if folder := c.Query("path"); folder != "" {
+		h.listFolder(c, folder)
+		return
+	}
+
+	files, err := h.listFiles(h.config.Get())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to list files",
@@ -40,12 +94,70 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 	})
 }
 
-// DownloadFile sends a file to the client
+// listFiles returns the shared files along with their expiry, metadata and
+// recorded checksums
+func (h *FileHandler) listFiles(cfg *config.Config) ([]models.FileInfo, error) {
+	files, err := fileutil.ListFiles(cfg.UploadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		files[i].ExpiresAt = retention.Expiry(cfg, h.expiry, files[i])
+		if md, ok := h.metadata.Get(files[i].Name); ok {
+			files[i].Metadata = &md
+		}
+	}
+	h.addChecksums(cfg.UploadDir, files)
+	return files, nil
+}
+
+// listFolder lists the files inside a folder, such as an extracted archive.
+// Expiry and metadata are recorded for top-level files only.
+func (h *FileHandler) listFolder(c *gin.Context, folder string) {
+	folder = strings.Trim(folder, "/")
+	dirPath, err := fileutil.GetFilePath(h.config.Get().UploadDir, folder)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid path",
+		})
+		return
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Folder not found",
+		})
+		return
+	}
+
+	files, err := fileutil.ListFiles(dirPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to list files",
+		})
+		return
+	}
+	h.addChecksums(dirPath, files)
+
+	c.JSON(http.StatusOK, models.FilesListResponse{
+		Path:  folder,
+		Files: files,
+	})
+}
+
+// DownloadFile sends a file to the client as an attachment
 func (h *FileHandler) DownloadFile(c *gin.Context) {
-	filename := c.Param("filename")
+	h.sendFile(c, false)
+}
+
+// sendFile sends a file either as an attachment or, for previews, inline.
+// Only types on the preview allowlist are ever sent inline: HTML or SVG
+// rendered from this origin could act with the admin's session.
+func (h *FileHandler) sendFile(c *gin.Context, preview bool) {
+	filename := filePathParam(c)
 
 	// Get safe file path
-	filePath, err := fileutil.GetFilePath(h.config.UploadDir, filename)
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, filename)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error: "Invalid filename",
@@ -54,15 +166,117 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 	}
 
 	// Check if file exists
-	if !fileutil.FileExists(filePath) {
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "File not found",
 		})
 		return
 	}
 
-	// Send file
-	c.File(filePath)
+	contentType := ""
+	if preview {
+		var ok bool
+		if contentType, ok = previewType(info.Name()); !ok {
+			c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+				Error: "No preview for this file type; download it instead",
+			})
+			return
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to read file",
+		})
+		return
+	}
+	defer f.Close()
+
+	// Resumed and seeking downloads arrive as many range requests; only
+	// audit the one that starts at the beginning of the file
+	if rng := c.GetHeader("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		h.audit.Record(models.AuditEvent{
+			Action:   audit.ActionDownload,
+			Protocol: audit.ProtocolHTTP,
+			Actor:    sessionActor(c, h.config),
+			ClientIP: c.ClientIP(),
+			Filename: filename,
+			Size:     info.Size(),
+		})
+	}
+
+	// Checksums double as a strong entity tag, so clients can verify the
+	// download and resume it safely with If-Range. A file that arrived
+	// without them is hashed before its first download, so every download
+	// of the same content carries the same tag. Files inside folders have
+	// no recorded checksums and get a weak tag from their size and
+	// modification time instead.
+	if filepath.Dir(filePath) == filepath.Clean(h.config.Get().UploadDir) {
+		sums, err := h.checksums.Compute(filePath, h.config.Get().HashBLAKE3)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to read file",
+			})
+			return
+		}
+		setChecksumHeaders(c, sums)
+	} else {
+		c.Header("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	if preview {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": info.Name()}))
+		c.Header("Content-Security-Policy", previewPolicy(contentType))
+	} else {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	}
+
+	// Send file. ServeContent, unlike c.File, does not redirect requests
+	// for files named index.html.
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
+
+// filePathParam returns the file named by a route ending in *filename,
+// which may be a path to a file inside a folder
+func filePathParam(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("filename"), "/")
+}
+
+// setChecksumHeaders describes the content of a download with ETag, Digest
+// (RFC 3230), Repr-Digest (RFC 9530) and explicit checksum headers
+func setChecksumHeaders(c *gin.Context, sums checksum.Sums) {
+	raw, _ := hex.DecodeString(sums.SHA256)
+	digest := base64.StdEncoding.EncodeToString(raw)
+
+	c.Header("ETag", `"`+sums.SHA256+`"`)
+	c.Header("Digest", "sha-256="+digest)
+	c.Header("Repr-Digest", "sha-256=:"+digest+":")
+	c.Header(headerChecksumSHA256, sums.SHA256)
+	if sums.BLAKE3 != "" {
+		c.Header(headerChecksumBLAKE3, sums.BLAKE3)
+	}
+}
+
+// addChecksums fills in the recorded checksums of listed files. Files
+// without recorded checksums are not hashed here, as that could take long.
+func (h *FileHandler) addChecksums(uploadDir string, files []models.FileInfo) {
+	for i, f := range files {
+		if f.IsDir {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(uploadDir, f.Name))
+		if err != nil {
+			continue
+		}
+		if sums, ok := h.checksums.Get(info); ok {
+			files[i].SHA256 = sums.SHA256
+			files[i].BLAKE3 = sums.BLAKE3
+		}
+	}
 }
 
 // UploadFile handles file upload requests
@@ -74,8 +288,29 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
+	// The request size is close enough to the file size to reject
+	// uploads that cannot fit before any data is read
+	res, err := h.quota.Reserve(max(c.Request.ContentLength, 0))
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+	defer res.Release()
+
+	cfg := h.config.Get()
 	var savedName string
-	maxSize := h.config.MaxFileSize()
+	var expiresAt *time.Time
+	var sums checksum.Sums
+	maxSize := cfg.MaxFileSize()
+
+	// The TTL may be passed in the query or as a form field before the file,
+	// and so may a description and comma-separated tags, and whether to
+	// unpack an archive into a target folder instead of storing it
+	ttlValue := c.Query("ttl")
+	var edits models.MetadataUpdateRequest
+	extractValue := c.Query("extract")
+	target := c.Query("target")
+	var extracted *models.ExtractResult
 
 	for {
 		part, err := mr.NextPart()
@@ -87,6 +322,31 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 			return
 		}
 
+		switch part.FormName() {
+		case "ttl":
+			value, _ := io.ReadAll(io.LimitReader(part, 64))
+			ttlValue = strings.TrimSpace(string(value))
+			continue
+		case "description":
+			value, _ := io.ReadAll(io.LimitReader(part, 4*metadata.MaxDescriptionLength+1))
+			description := string(value)
+			edits.Description = &description
+			continue
+		case "tags":
+			value, _ := io.ReadAll(io.LimitReader(part, 4*metadata.MaxTags*metadata.MaxTagLength))
+			tags := strings.Split(string(value), ",")
+			edits.Tags = &tags
+			continue
+		case "extract":
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			extractValue = strings.TrimSpace(string(value))
+			continue
+		case "target":
+			value, _ := io.ReadAll(io.LimitReader(part, 1024))
+			target = strings.TrimSpace(string(value))
+			continue
+		}
+
 		if part.FormName() != "file" {
 			continue
 		}
@@ -103,28 +363,145 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 			return
 		}
 
-		// Build destination path
-		dst := filepath.Join(h.config.UploadDir, safeFilename)
-		out, err := os.Create(dst)
+		ttl, err := parseTTL(cfg, ttlValue)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid TTL: " + err.Error()})
+			return
+		}
+
+		extract, format, err := parseExtract(extractValue, safeFilename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid extract: " + err.Error()})
+			return
+		}
+		if extract && ttl > 0 {
+			// Expiry applies to single files, and extracted folders
+			// would be kept indefinitely
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid TTL: extracted archives cannot expire"})
+			return
+		}
+
+		var described models.FileMetadata
+		if err := metadata.Apply(&described, edits); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid metadata: " + err.Error()})
+			return
+		}
+
+		// Stage the upload outside the shared files so a partial or
+		// rejected upload never replaces an existing file
+		tmpDir, err := fileutil.StateDir(cfg.UploadDir, "http-tmp")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create file"})
+			return
+		}
+		out, err := os.CreateTemp(tmpDir, "upload-*")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create file"})
 			return
 		}
+		defer os.Remove(out.Name())
 
-		// Copy with limit (maxSize + 1 to detect overflow)
-		written, err := io.Copy(out, io.LimitReader(part, maxSize+1))
+		// Copy with limit (maxSize + 1 to detect overflow), hashing as the data streams
+		expectedSHA256 := c.GetHeader(headerChecksumSHA256)
+		expectedBLAKE3 := c.GetHeader(headerChecksumBLAKE3)
+		hasher := checksum.NewHasher(cfg.HashBLAKE3 || expectedBLAKE3 != "")
+		progress := h.newProgressWriter(c, safeFilename)
+		written, err := io.Copy(io.MultiWriter(res.Writer(out), hasher, progress), io.LimitReader(part, maxSize+1))
 		out.Close()
 		if err != nil {
-			fileutil.DeleteFile(dst)
+			if quota.IsLimit(err) {
+				respondStorageError(c, err)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save file"})
 			return
 		}
 
 		if written > maxSize {
-			fileutil.DeleteFile(dst)
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: fmt.Sprintf("File size exceeds maximum of %d MB", h.config.MaxFileSizeMB)})
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: fmt.Sprintf("File size exceeds maximum of %d MB", cfg.MaxFileSizeMB)})
+			return
+		}
+
+		// Reject content that doesn't match what the client says it sent
+		sums = hasher.Sums()
+		if err := sums.Verify(expectedSHA256, expectedBLAKE3); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Upload rejected: " + err.Error()})
+			return
+		}
+
+		if extract {
+			result, err := h.extract(cfg, out.Name(), format, extractTarget(target, safeFilename), res)
+			if err != nil {
+				extractError(c, err)
+				return
+			}
+			h.audit.Record(models.AuditEvent{
+				Action:   audit.ActionExtract,
+				Protocol: audit.ProtocolHTTP,
+				Actor:    sessionActor(c, h.config),
+				ClientIP: c.ClientIP(),
+				Filename: safeFilename,
+				Target:   result.Target,
+				Size:     result.Bytes,
+			})
+			h.events.Publish(models.Event{Type: events.TypeAdded, Filename: result.Target})
+			extracted = &result
+			savedName = result.Target
+			break
+		}
+
+		if err := h.content.Intern(out.Name(), sums.SHA256); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save file"})
+			return
+		}
+
+		dst := filepath.Join(cfg.UploadDir, safeFilename)
+		changed := events.TypeAdded
+		if fileutil.FileExists(dst) {
+			changed = events.TypeModified
+		}
+		if err := h.versions.Replace(out.Name(), dst); err != nil {
+			if errors.Is(err, versions.ErrIsDir) {
+				c.JSON(http.StatusConflict, models.ErrorResponse{Error: "A folder with that name already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save file"})
 			return
 		}
+		// A checksum that fails to save is simply recomputed on download
+		h.checksums.Set(dst, sums)
+		h.index.Add(dst)
+
+		if ttl > 0 {
+			expires := time.Now().Add(ttl)
+			info, err := os.Stat(dst)
+			if err == nil {
+				err = h.expiry.Set(safeFilename, info.ModTime(), expires)
+			}
+			if err != nil {
+				// An upload meant to expire must not be kept indefinitely
+				fileutil.DeleteFile(dst)
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save file"})
+				return
+			}
+			expiresAt = &expires
+		}
+
+		// Metadata that fails to save leaves the upload itself intact
+		md := metadata.New(dst, sessionActor(c, h.config), c.ClientIP(), part.FileName())
+		md.Description, md.Tags = described.Description, described.Tags
+		h.metadata.RecordUpload(safeFilename, md)
+
+		h.audit.Record(models.AuditEvent{
+			Action:   audit.ActionUpload,
+			Protocol: audit.ProtocolHTTP,
+			Actor:    sessionActor(c, h.config),
+			ClientIP: c.ClientIP(),
+			Filename: safeFilename,
+			Size:     written,
+			SHA256:   sums.SHA256,
+		})
+		h.events.Publish(models.Event{Type: changed, Filename: safeFilename, Size: written})
 
 		savedName = safeFilename
 		break
@@ -135,18 +512,76 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
+	message := "File uploaded successfully"
+	if extracted != nil {
+		message = "Archive uploaded and extracted successfully"
+	}
 	c.JSON(http.StatusOK, models.UploadResponse{
-		Message:  "File uploaded successfully",
-		Filename: savedName,
+		Message:   message,
+		Filename:  savedName,
+		ExpiresAt: expiresAt,
+		SHA256:    sums.SHA256,
+		BLAKE3:    sums.BLAKE3,
+		Extracted: extracted,
 	})
 }
 
-// DeleteFile removes a file from the server
+// parseExtract reads whether an upload should be unpacked, returning the
+// archive format of the named file if so
+func parseExtract(value, filename string) (bool, string, error) {
+	if value == "" {
+		return false, "", nil
+	}
+	extract, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, "", errors.New("must be true or false")
+	}
+	if !extract {
+		return false, "", nil
+	}
+	format := archive.Detect(filename)
+	if format == "" {
+		return false, "", archive.ErrUnsupported
+	}
+	return true, format, nil
+}
+
+// parseTTL validates the expiry an uploader asked for against the
+// configured maximum. An empty value means the file does not expire.
+func parseTTL(cfg *config.Config, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := retention.ParseTTL(value)
+	if err != nil {
+		return 0, err
+	}
+	if maxTTL := cfg.MaxTTL(); maxTTL > 0 && ttl > maxTTL {
+		return 0, fmt.Errorf("exceeds the maximum of %d hours", cfg.MaxTTLHours)
+	}
+	return ttl, nil
+}
+
+// respondStorageError answers an upload that does not fit with 507, or 500
+// if storage use could not be measured
+func respondStorageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, models.ErrorResponse{Error: "Storage quota exceeded"})
+	case errors.Is(err, quota.ErrInsufficientSpace):
+		c.JSON(http.StatusInsufficientStorage, models.ErrorResponse{Error: "Not enough free disk space"})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check storage usage"})
+	}
+}
+
+// DeleteFile moves a file to the trash, or removes it if the trash is disabled
 func (h *FileHandler) DeleteFile(c *gin.Context) {
 	filename := c.Param("filename")
 
 	// Get safe file path
-	filePath, err := fileutil.GetFilePath(h.config.UploadDir, filename)
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, filename)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error: "Invalid filename",
@@ -154,8 +589,18 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 
+	// Note the size before the file is gone
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+		if info.IsDir() {
+			size, _ = fileutil.TotalSize(filePath)
+		}
+	}
+
 	// Delete file
-	if err := fileutil.DeleteFile(filePath); err != nil {
+	actor := sessionActor(c, h.config)
+	if err := h.trash.Remove(filePath, actor, c.ClientIP()); err != nil {
 		if fileutil.FileExists(filePath) {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error: "Failed to delete file",
@@ -167,6 +612,17 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		}
 		return
 	}
+	h.index.Remove(filepath.Base(filePath))
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionDelete,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    actor,
+		ClientIP: c.ClientIP(),
+		Filename: filepath.Base(filePath),
+		Size:     size,
+	})
+	h.events.Publish(models.Event{Type: events.TypeRemoved, Filename: filepath.Base(filePath)})
 
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Success: true,
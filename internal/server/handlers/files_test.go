@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadETag(t *testing.T) {
+	ts := newSiteServer(t)
+
+	// A file that arrived without going through an upload
+	content := []byte("copied in by hand")
+	if err := os.WriteFile(filepath.Join(ts.uploadDir, "notes.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+
+	tests := []struct {
+		path     string
+		wantETag string // "" for a weak tag
+	}{
+		{path: "notes.txt", wantETag: `"` + hex.EncodeToString(sum[:]) + `"`},
+		{path: "site/index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var etags []string
+			for range 2 {
+				w := ts.do(http.MethodGet, "/api/files/download/"+tt.path, nil, "")
+				if w.Code != http.StatusOK {
+					t.Fatalf("download = %d %s", w.Code, w.Body)
+				}
+				etags = append(etags, w.Header().Get("ETag"))
+			}
+
+			if etags[0] != etags[1] {
+				t.Errorf("ETag changed between downloads: %q then %q", etags[0], etags[1])
+			}
+			if tt.wantETag != "" && etags[0] != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", etags[0], tt.wantETag)
+			}
+			if tt.wantETag == "" && !strings.HasPrefix(etags[0], `W/"`) {
+				t.Errorf("ETag = %q, want a weak tag", etags[0])
+			}
+
+			// The tag validates cached copies
+			req := httptest.NewRequest(http.MethodGet, "/api/files/download/"+tt.path, nil)
+			req.Header.Set("If-None-Match", etags[0])
+			w := httptest.NewRecorder()
+			ts.router.ServeHTTP(w, req)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("conditional download = %d, want 304", w.Code)
+			}
+		})
+	}
+}
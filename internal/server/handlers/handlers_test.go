@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/thumbnail"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// testServer serves the file and trash handlers over a fresh upload
+// directory, without the PIN and admin middleware
+type testServer struct {
+	router    *gin.Engine
+	config    *config.Store
+	uploadDir string
+	trash     *trash.Bin
+	versions  *versions.Store
+	audit     *audit.Log
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	cfg.MinFreeMB = 0
+	store := config.NewStore(&cfg)
+
+	stateFile := func(name, file string) string {
+		dir, err := fileutil.StateDir(cfg.UploadDir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(dir, file)
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditLog, err := audit.Open(stateFile("audit", audit.FileName))
+	must(err)
+	t.Cleanup(func() { auditLog.Close() })
+	expiry, err := retention.Open(stateFile("retention", retention.FileName))
+	must(err)
+	meta, err := metadata.Open(stateFile("metadata", metadata.FileName))
+	must(err)
+	index, err := search.Open(store, stateFile("search", search.FileName))
+	must(err)
+	bin, err := trash.Open(store, filepath.Dir(stateFile("trash", "")), meta)
+	must(err)
+	versionStore, err := versions.Open(store, filepath.Dir(stateFile("versions", "")))
+	must(err)
+	checksums, err := checksum.Open(stateFile("checksums", checksum.FileName))
+	must(err)
+	content, err := dedup.Open(store, filepath.Dir(stateFile("objects", "")), checksums)
+	must(err)
+	thumbnails := thumbnail.NewCache(filepath.Dir(stateFile("thumbnails", "")))
+
+	files := NewFileHandler(store, auditLog, quota.NewGuard(store), expiry, bin, versionStore, checksums, content, meta, index, thumbnails, events.NewBroker())
+	trashHandler := NewTrashHandler(store, bin, auditLog, index)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("localshare_session", cookie.NewStore([]byte("test-session-secret"))))
+	api := r.Group("/api")
+	api.GET("/files", files.ListFiles)
+	api.GET("/files/search", files.SearchFiles)
+	api.GET("/files/download/*filename", files.DownloadFile)
+	api.GET("/files/preview/*filename", files.PreviewFile)
+	api.GET("/files/text/*filename", files.GetTextPreview)
+	api.GET("/files/thumbnail/*filename", files.GetThumbnail)
+	api.GET("/files/archive/:filename", files.ListArchive)
+	api.GET("/files/archive/:filename/*entry", files.DownloadArchiveEntry)
+	api.POST("/files/upload", files.UploadFile)
+	api.DELETE("/files/:filename", files.DeleteFile)
+	api.POST("/files/versions/:filename/:id/restore", files.RestoreVersion)
+	api.POST("/admin/extract/:filename", files.ExtractArchive)
+	api.GET("/admin/trash", trashHandler.ListTrash)
+	api.POST("/admin/trash/:id/restore", trashHandler.RestoreItem)
+	api.DELETE("/admin/trash/:id", trashHandler.PurgeItem)
+
+	return &testServer{
+		router:    r,
+		config:    store,
+		uploadDir: cfg.UploadDir,
+		trash:     bin,
+		versions:  versionStore,
+		audit:     auditLog,
+	}
+}
+
+// do sends a request to the test server
+func (ts *testServer) do(method, target string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// upload posts content as a file named name, with any extra form fields
+// sent before it
+func (ts *testServer) upload(t *testing.T, name string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+	return ts.do(http.MethodPost, "/api/files/upload", &body, mw.FormDataContentType())
+}
+
+// decodeError returns the message of an error response
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error response %q: %v", w.Body.String(), err)
+	}
+	return resp.Error
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/webui"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// HealthHandler handles liveness and readiness probes
+type HealthHandler struct {
+	config *config.Store
+	web    *webui.Handler
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(cfg *config.Store, web *webui.Handler) *HealthHandler {
+	return &HealthHandler{
+		config: cfg,
+		web:    web,
+	}
+}
+
+// Live reports that the process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{
+		Status: "alive",
+	})
+}
+
+// Ready checks everything needed to serve files and returns a breakdown,
+// with 503 if any check fails
+func (h *HealthHandler) Ready(c *gin.Context) {
+	cfg := h.config.Get()
+
+	checks := map[string]models.HealthCheck{
+		"upload_dir": checkUploadDir(cfg.UploadDir),
+		"disk_space": checkDiskSpace(cfg.UploadDir, cfg.HealthMinFreeMB),
+		"frontend":   h.checkFrontend(),
+	}
+
+	status, response := http.StatusOK, "ready"
+	for _, check := range checks {
+		if check.Status != healthOK {
+			status, response = http.StatusServiceUnavailable, "not_ready"
+			break
+		}
+	}
+
+	c.JSON(status, models.HealthResponse{
+		Status: response,
+		Checks: checks,
+	})
+}
+
+// checkUploadDir verifies the upload directory exists and accepts writes
+func checkUploadDir(uploadDir string) models.HealthCheck {
+	info, err := os.Stat(uploadDir)
+	if err != nil {
+		return models.HealthCheck{Status: healthFail, Message: "Upload directory is missing"}
+	}
+	if !info.IsDir() {
+		return models.HealthCheck{Status: healthFail, Message: "Upload directory is not a directory"}
+	}
+
+	// Probe inside the state directory so the file never shows up in listings
+	dir, err := fileutil.StateDir(uploadDir, "health")
+	if err != nil {
+		return models.HealthCheck{Status: healthFail, Message: "Upload directory is not writable"}
+	}
+	probe, err := os.CreateTemp(dir, "probe-*")
+	if err != nil {
+		return models.HealthCheck{Status: healthFail, Message: "Upload directory is not writable"}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return models.HealthCheck{Status: healthOK}
+}
+
+// checkDiskSpace compares free space on the upload filesystem against the threshold
+func checkDiskSpace(uploadDir string, minFreeMB int64) models.HealthCheck {
+	usage, err := fileutil.GetDiskUsage(uploadDir)
+	if err != nil {
+		return models.HealthCheck{Status: healthFail, Message: "Failed to read free disk space"}
+	}
+
+	freeMB := usage.Free / (1024 * 1024)
+	message := fmt.Sprintf("%d MB free, minimum %d MB", freeMB, minFreeMB)
+	if freeMB < uint64(minFreeMB) {
+		return models.HealthCheck{Status: healthFail, Message: message}
+	}
+	return models.HealthCheck{Status: healthOK, Message: message}
+}
+
+// checkFrontend verifies the web UI's entry point is present
+func (h *HealthHandler) checkFrontend() models.HealthCheck {
+	if !h.web.Available() {
+		return models.HealthCheck{Status: healthFail, Message: "Frontend is not built"}
+	}
+	return models.HealthCheck{Status: healthOK}
+}
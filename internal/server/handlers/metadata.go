@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetadata returns what is recorded about a file
+func (h *FileHandler) GetMetadata(c *gin.Context) {
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+	if !fileutil.FileExists(filePath) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "File not found",
+		})
+		return
+	}
+
+	md, _ := h.metadata.Get(filepath.Base(filePath))
+	c.JSON(http.StatusOK, md)
+}
+
+// UpdateMetadata changes the description and tags of a file
+func (h *FileHandler) UpdateMetadata(c *gin.Context) {
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	var req models.MetadataUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	if !fileutil.FileExists(filePath) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "File not found",
+		})
+		return
+	}
+
+	filename := filepath.Base(filePath)
+	md, err := h.metadata.Update(filename, req)
+	if err != nil {
+		if errors.Is(err, metadata.ErrDescriptionTooLong) || errors.Is(err, metadata.ErrInvalidTags) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid metadata: " + err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to save metadata",
+			})
+		}
+		return
+	}
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionEdit,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: filename,
+	})
+
+	c.JSON(http.StatusOK, md)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/preview"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// previewImageTypes are the image types browsers display without running
+// anything. SVG is left out as it can carry scripts.
+var previewImageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".bmp":  "image/bmp",
+}
+
+const (
+	// previewTextType is how text files are previewed, whatever their kind,
+	// so HTML is shown as source rather than rendered
+	previewTextType = "text/plain; charset=utf-8"
+
+	// previewPDFType is the type of previewed PDF documents
+	previewPDFType = "application/pdf"
+
+	// previewCSP stops a previewed document from running scripts, loading
+	// anything but images from this origin, or acting as this origin
+	previewCSP = "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox"
+
+	// previewPDFCSP is previewCSP without the sandbox, which browsers
+	// refuse to show PDFs in. Their PDF viewers do not give documents
+	// access to the page's origin.
+	previewPDFCSP = "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; object-src 'self'"
+)
+
+// PreviewFile sends a file for display in the browser. Only images, PDFs
+// and text, which is always sent as plain text, can be previewed.
+func (h *FileHandler) PreviewFile(c *gin.Context) {
+	h.sendFile(c, true)
+}
+
+// previewType returns the content type a file is previewed as, or false if
+// it cannot be previewed
+func previewType(name string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if contentType, ok := previewImageTypes[ext]; ok {
+		return contentType, true
+	}
+	if ext == ".pdf" {
+		return previewPDFType, true
+	}
+	if fileutil.IsText(name) {
+		return previewTextType, true
+	}
+	return "", false
+}
+
+// previewPolicy returns the Content-Security-Policy for a preview
+func previewPolicy(contentType string) string {
+	if contentType == previewPDFType {
+		return previewPDFCSP
+	}
+	return previewCSP
+}
+
+// GetTextPreview sends the start of a text file with its encoding, line
+// count and language, and Markdown rendered as sanitized HTML
+func (h *FileHandler) GetTextPreview(c *gin.Context) {
+	filename := filePathParam(c)
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	limit := preview.DefaultLimit
+	if value := c.Query("kb"); value != "" {
+		kb, err := strconv.Atoi(value)
+		if err != nil || kb < 1 || kb<<10 > preview.MaxLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: fmt.Sprintf("Invalid kb: must be between 1 and %d", preview.MaxLimit>>10),
+			})
+			return
+		}
+		limit = kb << 10
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "File not found",
+		})
+		return
+	}
+
+	p, err := preview.Text(filePath, limit)
+	switch {
+	case errors.Is(err, preview.ErrBinary):
+		c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+			Error: "No text preview: " + err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to read file",
+		})
+		return
+	}
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionDownload,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: filename,
+		Target:   "text preview",
+		Size:     info.Size(),
+	})
+
+	c.JSON(http.StatusOK, p)
+}
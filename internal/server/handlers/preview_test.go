@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviewFile(t *testing.T) {
+	ts := newTestServer(t)
+	files := map[string]string{
+		"page.html":         "<script>alert(1)</script>",
+		"drawing.svg":       "<svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>",
+		"tool.exe":          "MZ",
+		"site/css/site.css": "body{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(ts.uploadDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		wantCode        int
+		wantContentType string
+		wantError       string
+	}{
+		{name: "html as plain text", path: "page.html", wantCode: http.StatusOK, wantContentType: previewTextType},
+		{name: "file in a folder", path: "site/css/site.css", wantCode: http.StatusOK, wantContentType: previewTextType},
+		{name: "svg", path: "drawing.svg", wantCode: http.StatusUnsupportedMediaType, wantError: "No preview for this file type; download it instead"},
+		{name: "executable", path: "tool.exe", wantCode: http.StatusUnsupportedMediaType, wantError: "No preview for this file type; download it instead"},
+		{name: "missing file", path: "gone.txt", wantCode: http.StatusNotFound, wantError: "File not found"},
+		{name: "folder", path: "site", wantCode: http.StatusNotFound, wantError: "File not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(http.MethodGet, "/api/files/preview/"+tt.path, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("preview = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				if got := decodeError(t, w); got != tt.wantError {
+					t.Errorf("error = %q, want %q", got, tt.wantError)
+				}
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != previewCSP {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, previewCSP)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+		})
+	}
+}
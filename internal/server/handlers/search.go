@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+// Number of search results returned by default and at most
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// SearchFiles finds files by name, metadata, modification time, size and
+// text content
+func (h *FileHandler) SearchFiles(c *gin.Context) {
+	q, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid search: " + err.Error(),
+		})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid search: limit must be between 1 and " + strconv.Itoa(maxSearchLimit),
+			})
+			return
+		}
+	}
+
+	cfg := h.config.Get()
+	var textMatches map[string]bool
+	if q.Text != "" {
+		if !cfg.SearchIndex {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Full-text search is disabled",
+			})
+			return
+		}
+		textMatches = h.index.Search(q.Text)
+	}
+
+	files, err := h.listFiles(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to list files",
+		})
+		return
+	}
+
+	matched := search.Filter(files, q, textMatches)
+	total := len(matched)
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	c.JSON(http.StatusOK, models.SearchResponse{
+		Files: matched,
+		Total: total,
+	})
+}
+
+// parseSearchQuery reads a search from the query string
+func parseSearchQuery(c *gin.Context) (search.Query, error) {
+	q := search.Query{
+		Name:     c.Query("name"),
+		Glob:     c.Query("glob"),
+		Tags:     c.QueryArray("tag"),
+		Uploader: c.Query("uploader"),
+		Type:     c.Query("type"),
+		Text:     c.Query("q"),
+		MaxSize:  -1,
+	}
+
+	if q.Glob != "" {
+		if _, err := path.Match(q.Glob, ""); err != nil {
+			return q, errors.New("malformed glob pattern")
+		}
+	}
+
+	var err error
+	if q.ModifiedAfter, err = parseSearchTime(c.Query("from"), false); err != nil {
+		return q, errors.New("from must be a date (2006-01-02) or RFC 3339 time")
+	}
+	if q.ModifiedBefore, err = parseSearchTime(c.Query("to"), true); err != nil {
+		return q, errors.New("to must be a date (2006-01-02) or RFC 3339 time")
+	}
+
+	if value := c.Query("minSize"); value != "" {
+		if q.MinSize, err = strconv.ParseInt(value, 10, 64); err != nil || q.MinSize < 0 {
+			return q, errors.New("minSize must be a number of bytes")
+		}
+	}
+	if value := c.Query("maxSize"); value != "" {
+		if q.MaxSize, err = strconv.ParseInt(value, 10, 64); err != nil || q.MaxSize < 0 {
+			return q, errors.New("maxSize must be a number of bytes")
+		}
+	}
+	return q, nil
+}
+
+// parseSearchTime parses an RFC 3339 time or a date. A date used as the end
+// of a range covers that whole day.
+func parseSearchTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+)
+
+func TestSearchErrors(t *testing.T) {
+	ts := newTestServer(t)
+	if w := ts.upload(t, "notes.txt", []byte("hello"), nil); w.Code != http.StatusOK {
+		t.Fatalf("upload = %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		searchIndex   bool
+		wantErrPrefix string
+	}{
+		{name: "malformed glob", query: "glob=[a", searchIndex: true, wantErrPrefix: "Invalid search: malformed glob"},
+		{name: "bad from date", query: "from=yesterday", searchIndex: true, wantErrPrefix: "Invalid search: from must be"},
+		{name: "bad to date", query: "to=2024-13-01", searchIndex: true, wantErrPrefix: "Invalid search: to must be"},
+		{name: "negative minSize", query: "minSize=-1", searchIndex: true, wantErrPrefix: "Invalid search: minSize must be"},
+		{name: "non-numeric maxSize", query: "maxSize=big", searchIndex: true, wantErrPrefix: "Invalid search: maxSize must be"},
+		{name: "zero limit", query: "limit=0", searchIndex: true, wantErrPrefix: "Invalid search: limit must be"},
+		{name: "limit too large", query: "limit=100000", searchIndex: true, wantErrPrefix: "Invalid search: limit must be"},
+		{name: "text with the index disabled", query: "q=hello", searchIndex: false, wantErrPrefix: "Full-text search is disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.config.Update(func(next *config.Config) error {
+				next.SearchIndex = tt.searchIndex
+				return nil
+			})
+
+			w := ts.do(http.MethodGet, "/api/files/search?"+tt.query, nil, "")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("search = %d %s, want 400", w.Code, w.Body)
+			}
+			if got := decodeError(t, w); !strings.HasPrefix(got, tt.wantErrPrefix) {
+				t.Errorf("error = %q, want it to start with %q", got, tt.wantErrPrefix)
+			}
+		})
+	}
+}
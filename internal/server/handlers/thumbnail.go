@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/thumbnail"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// GetThumbnail sends a small version of an image, generated on first request
+func (h *FileHandler) GetThumbnail(c *gin.Context) {
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, filePathParam(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	size := thumbnail.DefaultSize
+	if value := c.Query("size"); value != "" {
+		size, err = strconv.Atoi(value)
+		if err != nil || !thumbnail.ValidSize(size) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: fmt.Sprintf("Invalid size: use one of %v", thumbnail.Sizes),
+			})
+			return
+		}
+	}
+
+	thumbPath, err := h.thumbnails.Get(filePath, size)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "File not found",
+		})
+		return
+	case errors.Is(err, thumbnail.ErrUnsupported), errors.Is(err, thumbnail.ErrTooLarge):
+		c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+			Error: "No thumbnail: " + err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate thumbnail",
+		})
+		return
+	}
+
+	// Thumbnails change along with their file, which Last-Modified reflects
+	c.Header("Cache-Control", "private, no-cache")
+	c.File(thumbPath)
+}
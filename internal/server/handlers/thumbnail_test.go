@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestThumbnailErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"photo.png": img.Bytes(),
+		"notes.txt": []byte("not an image"),
+		"fake.png":  []byte("not a png either"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(ts.uploadDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		target        string
+		wantCode      int
+		wantErrPrefix string
+	}{
+		{name: "image", target: "photo.png?size=64", wantCode: http.StatusOK},
+		{name: "size not offered", target: "photo.png?size=100", wantCode: http.StatusBadRequest, wantErrPrefix: "Invalid size"},
+		{name: "size not a number", target: "photo.png?size=big", wantCode: http.StatusBadRequest, wantErrPrefix: "Invalid size"},
+		{name: "missing file", target: "gone.png", wantCode: http.StatusNotFound, wantErrPrefix: "File not found"},
+		{name: "not an image", target: "notes.txt", wantCode: http.StatusUnsupportedMediaType, wantErrPrefix: "No thumbnail"},
+		{name: "undecodable image", target: "fake.png", wantCode: http.StatusUnsupportedMediaType, wantErrPrefix: "No thumbnail"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(http.MethodGet, "/api/files/thumbnail/"+tt.target, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("thumbnail = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK {
+				if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "image/") {
+					t.Errorf("Content-Type = %q, want an image", got)
+				}
+				return
+			}
+			if got := decodeError(t, w); !strings.HasPrefix(got, tt.wantErrPrefix) {
+				t.Errorf("error = %q, want it to start with %q", got, tt.wantErrPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/gin-gonic/gin"
+)
+
+// TrashHandler handles listing, restoring and purging deleted files
+type TrashHandler struct {
+	config *config.Store
+	trash  *trash.Bin
+	audit  *audit.Log
+	index  *search.Index
+}
+
+// NewTrashHandler creates a new trash handler
+func NewTrashHandler(cfg *config.Store, bin *trash.Bin, auditLog *audit.Log, index *search.Index) *TrashHandler {
+	return &TrashHandler{
+		config: cfg,
+		trash:  bin,
+		audit:  auditLog,
+		index:  index,
+	}
+}
+
+// ListTrash returns the deleted files that can still be restored
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	c.JSON(http.StatusOK, models.TrashListResponse{
+		Items: h.trash.List(),
+	})
+}
+
+// RestoreItem moves a deleted file back under its original name
+func (h *TrashHandler) RestoreItem(c *gin.Context) {
+	item, err := h.trash.Restore(c.Param("id"), h.config.Get().UploadDir)
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Trash item not found",
+		})
+		return
+	case errors.Is(err, trash.ErrExists):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "A file named " + item.OriginalPath + " already exists",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to restore file",
+		})
+		return
+	}
+
+	h.index.Add(filepath.Join(h.config.Get().UploadDir, item.OriginalPath))
+	h.record(c, audit.ActionRestore, item)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "File restored successfully",
+	})
+}
+
+// PurgeItem permanently deletes one file from the trash
+func (h *TrashHandler) PurgeItem(c *gin.Context) {
+	item, err := h.trash.Purge(c.Param("id"))
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Trash item not found",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to purge file",
+		})
+		return
+	}
+
+	h.record(c, audit.ActionPurge, item)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "File purged successfully",
+	})
+}
+
+// EmptyTrash permanently deletes every file in the trash
+func (h *TrashHandler) EmptyTrash(c *gin.Context) {
+	purged, err := h.trash.PurgeBefore(time.Time{})
+	for _, item := range purged {
+		h.record(c, audit.ActionPurge, item)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to empty trash",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Trash emptied successfully",
+	})
+}
+
+// record adds a trash operation to the audit trail
+func (h *TrashHandler) record(c *gin.Context, action string, item models.TrashItem) {
+	h.audit.Record(models.AuditEvent{
+		Action:   action,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: item.OriginalPath,
+		Size:     item.Size,
+	})
+}
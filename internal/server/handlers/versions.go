@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/gin-gonic/gin"
+)
+
+// ListVersions returns the kept previous versions of a file, newest first
+func (h *FileHandler) ListVersions(c *gin.Context) {
+	filename, err := fileutil.SanitizeFilename(c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.VersionListResponse{
+		Filename: filename,
+		Versions: h.versions.List(filename),
+	})
+}
+
+// DownloadVersion sends a previous version of a file under the file's name
+func (h *FileHandler) DownloadVersion(c *gin.Context) {
+	filename, err := fileutil.SanitizeFilename(c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	path, version, err := h.versions.Path(filename, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Version not found",
+		})
+		return
+	}
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionDownload,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: filename,
+		Target:   "version " + version.ID,
+		Size:     version.Size,
+	})
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.FileAttachment(path, filename)
+}
+
+// RestoreVersion makes a previous version the current content of a file.
+// The content it replaces is kept as a version in turn.
+func (h *FileHandler) RestoreVersion(c *gin.Context) {
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid filename",
+		})
+		return
+	}
+
+	version, err := h.versions.Restore(filePath, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, versions.ErrNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Version not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to restore version",
+			})
+		}
+		return
+	}
+	h.index.Add(filePath)
+
+	h.audit.Record(models.AuditEvent{
+		Action:   audit.ActionRestore,
+		Protocol: audit.ProtocolHTTP,
+		Actor:    sessionActor(c, h.config),
+		ClientIP: c.ClientIP(),
+		Filename: filepath.Base(filePath),
+		Target:   "version " + version.ID,
+		Size:     version.Size,
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Version restored successfully",
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreVersionErrors(t *testing.T) {
+	ts := newTestServer(t)
+	for _, content := range []string{"v1", "v2"} {
+		if w := ts.upload(t, "notes.txt", []byte(content), nil); w.Code != http.StatusOK {
+			t.Fatalf("upload = %d %s", w.Code, w.Body)
+		}
+	}
+	kept := ts.versions.List("notes.txt")
+	if len(kept) != 1 {
+		t.Fatalf("versions = %+v, want one", kept)
+	}
+
+	tests := []struct {
+		name      string
+		target    string
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:      "unknown version",
+			target:    "/api/files/versions/notes.txt/0123456789abcdef/restore",
+			wantCode:  http.StatusNotFound,
+			wantError: "Version not found",
+		},
+		{
+			name:      "version of another file",
+			target:    "/api/files/versions/other.txt/" + kept[0].ID + "/restore",
+			wantCode:  http.StatusNotFound,
+			wantError: "Version not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(http.MethodPost, tt.target, nil, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("restore = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			if got := decodeError(t, w); got != tt.wantError {
+				t.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+
+	// Failed restores leave the file and its versions alone
+	if data, err := os.ReadFile(filepath.Join(ts.uploadDir, "notes.txt")); err != nil || string(data) != "v2" {
+		t.Errorf("notes.txt = %q, %v, want v2", data, err)
+	}
+	if got := ts.versions.List("notes.txt"); len(got) != 1 || got[0].ID != kept[0].ID {
+		t.Errorf("versions = %+v, want %+v", got, kept)
+	}
+}
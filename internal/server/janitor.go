@@ -0,0 +1,77 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/retention"
+)
+
+// janitorInterval is how often the retention policy is enforced
+const janitorInterval = time.Minute
+
+// runJanitor removes expired files, and the oldest files while the share
+// exceeds its size limit, drops versions beyond the configured limits,
+// purges old files from the trash, forgets checksums and metadata of removed
+// files, removes stored content no file references, drops outdated
+// thumbnails and keeps the search index current for as long as the server
+// runs
+func (s *Server) runJanitor() {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+
+		if removed, err := s.janitor.Sweep(now); err != nil {
+			s.logger.Error("retention sweep failed", slog.String("error", err.Error()))
+		} else if removed > 0 {
+			s.logger.Info("retention sweep finished", slog.Int("removed", removed))
+		}
+
+		if err := s.versions.Prune(); err != nil {
+			s.logger.Error("version pruning failed", slog.String("error", err.Error()))
+		}
+
+		purged, err := s.trash.PurgeExpired(now)
+		for _, item := range purged {
+			s.audit.Record(models.AuditEvent{
+				Action:   audit.ActionPurge,
+				Actor:    retention.Actor,
+				Filename: item.OriginalPath,
+				Size:     item.Size,
+			})
+		}
+		if err != nil {
+			s.logger.Error("trash purge failed", slog.String("error", err.Error()))
+		} else if len(purged) > 0 {
+			s.logger.Info("trash purged", slog.Int("purged", len(purged)))
+		}
+
+		uploadDir := s.config.Get().UploadDir
+		if err := s.checksums.Prune(uploadDir); err != nil {
+			s.logger.Error("checksum pruning failed", slog.String("error", err.Error()))
+		}
+		if err := s.metadata.Prune(uploadDir); err != nil {
+			s.logger.Error("metadata pruning failed", slog.String("error", err.Error()))
+		}
+		if err := s.thumbnails.Prune(uploadDir); err != nil {
+			s.logger.Error("thumbnail pruning failed", slog.String("error", err.Error()))
+		}
+		if s.config.Get().SearchIndex {
+			if err := s.index.Sync(uploadDir); err != nil {
+				s.logger.Error("search index update failed", slog.String("error", err.Error()))
+			}
+		}
+
+		if removed, err := s.content.Collect(); err != nil {
+			s.logger.Error("content collection failed", slog.String("error", err.Error()))
+		} else if removed > 0 {
+			s.logger.Info("unreferenced content removed", slog.Int("removed", removed))
+		}
+
+		<-ticker.C
+	}
+}
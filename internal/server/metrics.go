@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	routeUpload   = "/api/files/upload"
+	routeDownload = "/api/files/download/:filename"
+)
+
+// metricsMiddleware records request counts, latency, transfer sizes and
+// failed logins for the HTTP API
+func (s *Server) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// Label by route template so file names don't create new series
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		var body *countingReader
+		switch route {
+		case routeUpload:
+			defer s.metrics.StartTransfer(audit.ProtocolHTTP, metrics.DirectionUpload)()
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		case routeDownload:
+			defer s.metrics.StartTransfer(audit.ProtocolHTTP, metrics.DirectionDownload)()
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		s.metrics.ObserveRequest(c.Request.Method, route, status, time.Since(start).Seconds())
+
+		switch {
+		case body != nil:
+			s.metrics.AddBytes(audit.ProtocolHTTP, metrics.DirectionUpload, body.n)
+		case route == routeDownload:
+			s.metrics.AddBytes(audit.ProtocolHTTP, metrics.DirectionDownload, int64(max(c.Writer.Size(), 0)))
+		}
+
+		if status == http.StatusUnauthorized && (route == "/api/verify-pin" || route == "/api/admin/login") {
+			s.metrics.AuthFailed(audit.ProtocolHTTP)
+		}
+	}
+}
+
+// metricsAuthMiddleware requires the configured bearer token, if any, on /metrics
+func (s *Server) metricsAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := s.config.Get().MetricsToken
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Metrics token required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// instrumentS3 wraps the S3 API with the same request metrics as the HTTP
+// API. S3 answers every authentication failure with 403.
+func (s *Server) instrumentS3(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		s.metrics.ObserveRequest(r.Method, "s3", rec.status, time.Since(start).Seconds())
+		if rec.status == http.StatusForbidden {
+			s.metrics.AuthFailed(audit.ProtocolS3)
+		}
+	})
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// statusRecorder captures the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -1,9 +1,14 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/OderoCeasar/localshare/internal/accesslog"
 	"github.com/OderoCeasar/localshare/internal/models"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
@@ -15,23 +20,21 @@ const (
 	sessionName     = "localshare_session"
 	sessionKeyPIN   = "pin_verified"
 	sessionKeyAdmin = "admin_authenticated"
-	sessionSecret   = "secret_key"
+
+	headerRequestID = "X-Request-ID"
+	ctxKeyRequestID = "requestID"
 )
 
 // setupMiddleware configures all middleware for the router
 func (s *Server) setupMiddleware() {
 	// CORS middleware
-	s.router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	s.router.Use(cors.New(corsConfig()))
 
-	// Session middleware
-	store := cookie.NewStore([]byte(sessionSecret))
+	// Session middleware. Cookies are signed with a key generated on every
+	// start, so they cannot be forged and do not outlive the process.
+	sessionSecret := make([]byte, 32)
+	rand.Read(sessionSecret)
+	store := cookie.NewStore(sessionSecret)
 	store.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 days
@@ -40,23 +43,32 @@ func (s *Server) setupMiddleware() {
 	})
 	s.router.Use(sessions.Sessions(sessionName, store))
 
-	// Custom logger middleware
+	// Request ID and structured logging middleware
+	s.router.Use(s.requestIDMiddleware())
 	s.router.Use(s.loggerMiddleware())
+	s.router.Use(s.metricsMiddleware())
+	if s.accessLog != nil {
+		s.router.Use(s.accessLogMiddleware())
+	}
+}
+
+// corsConfig lets browser clients on other origins use the API, send
+// checksums with uploads and read the checksums of downloads
+func corsConfig() cors.Config {
+	return cors.Config{
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Checksum-Sha256", "X-Checksum-Blake3"},
+		ExposeHeaders:    []string{"Content-Length", headerRequestID, "ETag", "Digest", "Repr-Digest", "X-Checksum-Sha256", "X-Checksum-Blake3"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}
 }
 
 // pinMiddleware checks if PIN is verified when PIN protection is enabled
 func (s *Server) pinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// If PIN protection is disabled, skip verification
-		if !s.config.IsPINProtected() {
-			c.Next()
-			return
-		}
-
-		session := sessions.Default(c)
-		pinVerified := session.Get(sessionKeyPIN)
-
-		if pinVerified != true {
+		if !s.pinVerified(c) {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "PIN verification required",
 			})
@@ -68,11 +80,19 @@ func (s *Server) pinMiddleware() gin.HandlerFunc {
 	}
 }
 
-// adminMiddleware checks if admin is authenticated when admin auth is enabled
+// adminMiddleware checks if admin is authenticated when admin auth is
+// enabled. Without admin auth, the PIN is the only credential there is, so
+// admin endpoints require it instead of being open to anyone on the network.
 func (s *Server) adminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// If admin auth is disabled, skip verification
-		if !s.config.IsAdminAuthEnabled() {
+		if !s.config.Get().IsAdminAuthEnabled() {
+			if !s.pinVerified(c) {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+					Error: "PIN verification required",
+				})
+				c.Abort()
+				return
+			}
 			c.Next()
 			return
 		}
@@ -80,7 +100,7 @@ func (s *Server) adminMiddleware() gin.HandlerFunc {
 		session := sessions.Default(c)
 		adminAuth := session.Get(sessionKeyAdmin)
 
-		if adminAuth != true {
+		if adminAuth != s.config.AdminToken() {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "Admin authentication required",
 			})
@@ -92,54 +112,144 @@ func (s *Server) adminMiddleware() gin.HandlerFunc {
 	}
 }
 
-// loggerMiddleware provides custom logging for requests
+// adminRoutesMiddleware refuses the admin endpoints while neither a PIN nor
+// admin auth is configured. Without a credential they would be open to
+// anyone on the network, who could change settings or empty the trash.
+func (s *Server) adminRoutesMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := s.config.Get()
+		if !cfg.IsAdminAuthEnabled() && !cfg.IsPINProtected() {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "Admin endpoints are disabled until a PIN or admin password is set",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// pinVerified reports whether the request may pass the PIN check: PIN
+// protection is off, or the session holds the current PIN token. Sessions
+// verified before the PIN last changed hold a stale token.
+func (s *Server) pinVerified(c *gin.Context) bool {
+	if !s.config.Get().IsPINProtected() {
+		return true
+	}
+	return sessions.Default(c).Get(sessionKeyPIN) == s.config.PINToken()
+}
+
+// requestIDMiddleware tags each request with an ID, reusing a well-formed
+// X-Request-ID from the client so logs can be correlated across proxies
+func (s *Server) requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(headerRequestID)
+		if !isValidRequestID(requestID) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+
+		c.Set(ctxKeyRequestID, requestID)
+		c.Header(headerRequestID, requestID)
+		c.Next()
+	}
+}
+
+// loggerMiddleware writes one structured log record per request
 func (s *Server) loggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Start timer
 		start := time.Now()
 		path := c.Request.URL.Path
-		raw := c.Request.URL.RawQuery
 
 		// Process request
 		c.Next()
 
-		// Calculate latency
-		latency := time.Since(start)
-
-		// Get status code
-		statusCode := c.Writer.Status()
+		status := c.Writer.Status()
+
+		// Routine static, health and scrape traffic is only interesting when debugging
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case c.Request.Method == http.MethodGet && (strings.HasPrefix(path, "/assets/") || strings.HasPrefix(path, "/health") || path == "/metrics"):
+			level = slog.LevelDebug
+		}
 
-		// Build log message
-		if raw != "" {
-			path = path + "?" + raw
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Int64("bytes_in", max(c.Request.ContentLength, 0)),
+			slog.Int("bytes_out", max(c.Writer.Size(), 0)),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("request_id", c.GetString(ctxKeyRequestID)),
+		}
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			attrs = append(attrs, slog.String("query", raw))
+		}
+		if user := s.sessionUser(c); user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
 		}
 
-		// Only log non-successful requests and uploads/downloads for monitoring
-		if statusCode >= 400 || c.Request.Method == "POST" || c.Request.Method == "DELETE" {
-			clientIP := c.ClientIP()
-			method := c.Request.Method
-
-			// Color code based on status
-			var statusColor string
-			switch {
-			case statusCode >= 500:
-				statusColor = "\033[31m" // Red
-			case statusCode >= 400:
-				statusColor = "\033[33m" // Yellow
-			case statusCode >= 300:
-				statusColor = "\033[36m" // Cyan
-			default:
-				statusColor = "\033[32m" // Green
-			}
-			resetColor := "\033[0m"
-
-			gin.DefaultWriter.Write([]byte(
-				statusColor + "[LocalShare] " + resetColor +
-					method + " " + path +
-					" | " + statusColor + string(rune(statusCode)) + resetColor +
-					" | " + latency.String() +
-					" | " + clientIP + "\n",
-			))
+		s.logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// accessLogMiddleware queues an access log entry for every request
+func (s *Server) accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		s.accessLog.Log(accesslog.Entry{
+			Time:      start,
+			ClientIP:  c.ClientIP(),
+			User:      s.sessionUser(c),
+			Method:    c.Request.Method,
+			URI:       c.Request.URL.RequestURI(),
+			Proto:     c.Request.Proto,
+			Status:    c.Writer.Status(),
+			Bytes:     int64(max(c.Writer.Size(), 0)),
+			Referer:   c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+			Latency:   time.Since(start),
+			RequestID: c.GetString(ctxKeyRequestID),
+		})
+	}
+}
+
+// sessionUser identifies who made the request: the admin username for an
+// authenticated admin, "pin" for a PIN-verified visitor, or "" otherwise
+func (s *Server) sessionUser(c *gin.Context) string {
+	session := sessions.Default(c)
+	if session.Get(sessionKeyAdmin) == s.config.AdminToken() {
+		return s.config.Get().AdminUser
+	}
+	if session.Get(sessionKeyPIN) == s.config.PINToken() {
+		return "pin"
+	}
+	return ""
+}
+
+// isValidRequestID accepts short IDs made of URL-safe characters, so
+// client-supplied values cannot inject anything into the logs
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
 		}
 	}
+	return true
 }
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthTestRouter serves /pin and /admin behind the PIN and admin
+// middleware, and /session, which stores the PIN or admin token named by
+// the "as" query parameter so a test can hold any kind of session
+func newAuthTestRouter(s *Server) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions(sessionName, cookie.NewStore([]byte("test-session-secret"))))
+
+	r.GET("/session", func(c *gin.Context) {
+		session := sessions.Default(c)
+		switch c.Query("as") {
+		case "pin":
+			session.Set(sessionKeyPIN, s.config.PINToken())
+		case "admin":
+			session.Set(sessionKeyAdmin, s.config.AdminToken())
+		case "forged":
+			session.Set(sessionKeyPIN, "true")
+			session.Set(sessionKeyAdmin, "true")
+		}
+		session.Save()
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/pin", s.pinMiddleware(), ok)
+	r.GET("/admin", s.adminMiddleware(), ok)
+	r.GET("/admin-routes", s.adminRoutesMiddleware(), s.adminMiddleware(), ok)
+	return r
+}
+
+// sessionCookie returns the cookie of a session of the given kind
+func sessionCookie(t *testing.T, r *gin.Engine, as string) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/session?as="+as, nil))
+	return w.Result().Cookies()
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		pin       string
+		adminAuth bool
+		session   string
+		// rotate changes the configuration after the session was created
+		rotate    func(c *config.Config)
+		wantPIN   int
+		wantAdmin int
+	}{
+		{name: "open, no session", wantPIN: http.StatusOK, wantAdmin: http.StatusOK},
+		{name: "pin, no session", pin: "1234", wantPIN: http.StatusUnauthorized, wantAdmin: http.StatusUnauthorized},
+		{name: "pin, pin session", pin: "1234", session: "pin", wantPIN: http.StatusOK, wantAdmin: http.StatusOK},
+		{name: "pin, forged session", pin: "1234", session: "forged", wantPIN: http.StatusUnauthorized, wantAdmin: http.StatusUnauthorized},
+		{
+			name:    "pin, session from before the pin changed",
+			pin:     "1234",
+			session: "pin",
+			rotate:  func(c *config.Config) { c.PIN = "5678" },
+			wantPIN: http.StatusUnauthorized, wantAdmin: http.StatusUnauthorized,
+		},
+		{name: "admin auth, no session", adminAuth: true, wantPIN: http.StatusOK, wantAdmin: http.StatusUnauthorized},
+		{name: "admin auth, admin session", adminAuth: true, session: "admin", wantPIN: http.StatusOK, wantAdmin: http.StatusOK},
+		{name: "admin auth, forged session", adminAuth: true, session: "forged", wantPIN: http.StatusOK, wantAdmin: http.StatusUnauthorized},
+		{name: "pin and admin auth, pin session", pin: "1234", adminAuth: true, session: "pin", wantPIN: http.StatusOK, wantAdmin: http.StatusUnauthorized},
+		{name: "pin and admin auth, admin session", pin: "1234", adminAuth: true, session: "admin", wantPIN: http.StatusUnauthorized, wantAdmin: http.StatusOK},
+		{
+			name:      "admin auth, session from before the password changed",
+			adminAuth: true,
+			session:   "admin",
+			rotate:    func(c *config.Config) { c.AdminPass = "another1" },
+			wantPIN:   http.StatusOK, wantAdmin: http.StatusUnauthorized,
+		},
+		{
+			name:      "admin auth, admin session survives a pin change",
+			pin:       "1234",
+			adminAuth: true,
+			session:   "admin",
+			rotate:    func(c *config.Config) { c.PIN = "5678" },
+			wantPIN:   http.StatusUnauthorized, wantAdmin: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.PIN = tt.pin
+			cfg.AdminAuth = tt.adminAuth
+			cfg.AdminPass = "secret123"
+			s := &Server{config: config.NewStore(&cfg)}
+			r := newAuthTestRouter(s)
+
+			var cookies []*http.Cookie
+			if tt.session != "" {
+				cookies = sessionCookie(t, r, tt.session)
+			}
+			if tt.rotate != nil {
+				if _, err := s.config.Update(func(next *config.Config) error {
+					tt.rotate(next)
+					return nil
+				}); err != nil {
+					t.Fatalf("Update: %v", err)
+				}
+			}
+
+			// The admin endpoints need the admin check to pass, and are
+			// refused outright while no credential is configured
+			wantRoutes := tt.wantAdmin
+			if tt.pin == "" && !tt.adminAuth {
+				wantRoutes = http.StatusForbidden
+			}
+
+			for path, want := range map[string]int{"/pin": tt.wantPIN, "/admin": tt.wantAdmin, "/admin-routes": wantRoutes} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				for _, cookie := range cookies {
+					req.AddCookie(cookie)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("GET %s = %d, want %d", path, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-123_DEF.4", true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{string(make([]byte, 65)), false},
+	}
+	for _, tt := range tests {
+		if got := isValidRequestID(tt.id); got != tt.want {
+			t.Errorf("isValidRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(cors.New(corsConfig()))
+	r.Any("/api/files/upload", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Uploads from another origin may carry checksums to verify
+	req := httptest.NewRequest(http.MethodOptions, "/api/files/upload", nil)
+	req.Header.Set("Origin", "http://other.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "x-checksum-sha256,x-checksum-blake3")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers"))
+	for _, h := range []string{"x-checksum-sha256", "x-checksum-blake3"} {
+		if !strings.Contains(allowed, h) {
+			t.Errorf("preflight allows %q, want %s", allowed, h)
+		}
+	}
+
+	// and read the checksums of what they download
+	req = httptest.NewRequest(http.MethodGet, "/api/files/upload", nil)
+	req.Header.Set("Origin", "http://other.example")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	exposed := strings.ToLower(w.Header().Get("Access-Control-Expose-Headers"))
+	for _, h := range []string{"etag", "digest", "x-checksum-sha256"} {
+		if !strings.Contains(exposed, h) {
+			t.Errorf("exposed headers %q, want %s", exposed, h)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/logging"
+)
+
+// Reload re-reads the configuration and swaps it in. The new configuration
+// is validated first; on any error the running configuration is kept.
+func (s *Server) Reload() error {
+	if s.loader == nil {
+		return errors.New("configuration reload is not available")
+	}
+
+	next, err := s.config.Update(func(next *config.Config) error {
+		loaded, err := s.loader()
+		if err != nil {
+			return err
+		}
+		if err := next.CheckReload(loaded); err != nil {
+			return err
+		}
+		*next = *loaded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if level, err := logging.ParseLevel(next.LogLevel); err == nil {
+		s.logLevel.Set(level)
+	}
+
+	s.logger.Info("configuration reloaded", slog.String("file", next.ConfigFile))
+	return nil
+}
+
+// watchReloadSignal reloads the configuration whenever the process receives
+// SIGHUP. On Windows the signal is never delivered.
+func (s *Server) watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		if err := s.Reload(); err != nil {
+			s.logger.Error("configuration reload failed", slog.String("error", err.Error()))
+		}
+	}
+}
@@ -14,17 +14,21 @@ func (s *Server) setupRoutes() {
 	s.setupMiddleware()
 
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(s.config)
-	fileHandler := handlers.NewFileHandler(s.config)
-	configHandler := handlers.NewConfigHandler(s.config)
+	authHandler := handlers.NewAuthHandler(s.config, s.audit)
+	fileHandler := handlers.NewFileHandler(s.config, s.audit, s.quota, s.expiry, s.trash, s.versions, s.checksums, s.content, s.metadata, s.index, s.thumbnails, s.events)
+	configHandler := handlers.NewConfigHandler(s.config, s.quota)
+	adminHandler := handlers.NewAdminHandler(s.config, s.Reload, s.content)
+	auditHandler := handlers.NewAuditHandler(s.audit)
+	trashHandler := handlers.NewTrashHandler(s.config, s.trash, s.audit, s.index)
+	healthHandler := handlers.NewHealthHandler(s.config, s.web)
+	eventsHandler := handlers.NewEventsHandler(s.events)
 
-	// Serve static frontend (from dist directory in production)
-	// In development, Vite dev server runs separately on port 3000
-	s.router.Static("/assets", "./dist/assets")
+	// Serve the frontend, embedded in the binary or from --web-dir
+	// In development, Vite dev server runs separately on port 5173
 	s.router.NoRoute(func(c *gin.Context) {
-		// Serve index.html for all non-API routes (SPA support)
+		// The frontend falls back to index.html for client-side routes
 		if !strings.HasPrefix(c.Request.URL.Path, "/api") {
-			c.File("./dist/index.html")
+			s.web.ServeHTTP(c.Writer, c.Request)
 		} else {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
 		}
@@ -39,24 +43,61 @@ func (s *Server) setupRoutes() {
 		api.POST("/admin/login", authHandler.AdminLogin)
 		api.POST("/admin/logout", authHandler.AdminLogout)
 
+		// Admin endpoints (require admin auth if enabled, otherwise the PIN;
+		// refused while neither is set)
+		admin := api.Group("/admin")
+		admin.Use(s.adminRoutesMiddleware(), s.adminMiddleware())
+		{
+			admin.POST("/reload", adminHandler.ReloadConfig)
+			admin.GET("/settings", adminHandler.GetSettings)
+			admin.PUT("/settings", adminHandler.UpdateSettings)
+			admin.GET("/stats", adminHandler.GetStats)
+			admin.GET("/audit", auditHandler.ListEvents)
+			admin.GET("/trash", trashHandler.ListTrash)
+			admin.POST("/trash/:id/restore", trashHandler.RestoreItem)
+			admin.DELETE("/trash/:id", trashHandler.PurgeItem)
+			admin.DELETE("/trash", trashHandler.EmptyTrash)
+			admin.POST("/extract/:filename", fileHandler.ExtractArchive)
+		}
+
 		// Protected file endpoints (require PIN if enabled)
 		files := api.Group("/files")
 		files.Use(s.pinMiddleware())
 		{
 			files.GET("", fileHandler.ListFiles)
-			files.GET("/download/:filename", fileHandler.DownloadFile)
+			files.GET("/search", fileHandler.SearchFiles)
+			files.GET("/download/*filename", fileHandler.DownloadFile)
+			files.GET("/preview/*filename", fileHandler.PreviewFile)
+			files.GET("/text/*filename", fileHandler.GetTextPreview)
+			files.GET("/thumbnail/*filename", fileHandler.GetThumbnail)
+			files.GET("/archive/:filename", fileHandler.ListArchive)
+			files.GET("/archive/:filename/*entry", fileHandler.DownloadArchiveEntry)
+			files.GET("/versions/:filename", fileHandler.ListVersions)
+			files.GET("/versions/:filename/:id", fileHandler.DownloadVersion)
+			files.GET("/metadata/:filename", fileHandler.GetMetadata)
 			
 			// These also require admin auth if enabled
 			files.POST("/upload", s.adminMiddleware(), fileHandler.UploadFile)
 			files.DELETE("/:filename", s.adminMiddleware(), fileHandler.DeleteFile)
+			files.POST("/versions/:filename/:id/restore", s.adminMiddleware(), fileHandler.RestoreVersion)
+			files.PATCH("/metadata/:filename", s.adminMiddleware(), fileHandler.UpdateMetadata)
 		}
+
+		// Live file changes and upload progress (require PIN if enabled)
+		api.GET("/events", s.pinMiddleware(), eventsHandler.Stream)
 	}
 
-	// Health check endpoint
+	// Prometheus metrics, optionally behind a bearer token
+	s.router.GET("/metrics", s.metricsAuthMiddleware(), gin.WrapH(s.metrics.Handler()))
+
+	// Health check endpoints: /health for compatibility, /health/live for
+	// liveness probes and /health/ready for readiness probes
 	s.router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"status": "healthy",
 			"service": "localshare",
 		})
 	})
+	s.router.GET("/health/live", healthHandler.Live)
+	s.router.GET("/health/ready", healthHandler.Ready)
 }
\ No newline at end of file
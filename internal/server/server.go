@@ -2,26 +2,223 @@ package server
 
 import (
 	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/OderoCeasar/localshare/internal/accesslog"
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
 	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/events"
+	"github.com/OderoCeasar/localshare/internal/logging"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/s3"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/sftpserver"
+	"github.com/OderoCeasar/localshare/internal/thumbnail"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/internal/webui"
 	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/OderoCeasar/localshare/web"
 	"github.com/gin-gonic/gin"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	config *config.Config
+	config *config.Store
 	router *gin.Engine
+	logger *slog.Logger
+
+	// logLevel is shared with the logger so reloads can change it
+	logLevel *slog.LevelVar
+
+	// accessLog records every request when enabled; nil otherwise
+	accessLog *accesslog.Logger
+
+	// audit records file operations and logins across all protocols
+	audit *audit.Log
+
+	// metrics is exported to Prometheus on /metrics
+	metrics *metrics.Metrics
+
+	// quota enforces the storage quota and free-space reserve on uploads
+	quota *quota.Guard
+
+	// expiry holds the expiry times uploaders chose, enforced by janitor
+	expiry  *retention.Store
+	janitor *retention.Janitor
+
+	// trash keeps deleted files until they are restored or purged
+	trash *trash.Bin
+
+	// versions keeps the previous contents of overwritten files
+	versions *versions.Store
+
+	// checksums records the content hashes of shared files
+	checksums *checksum.Store
+
+	// content stores identical uploads once
+	content *dedup.Store
+
+	// metadata records who uploaded each file and describes it
+	metadata *metadata.Store
+
+	// index is the full-text index of text files
+	index *search.Index
+
+	// thumbnails caches small versions of images
+	thumbnails *thumbnail.Cache
+
+	// events broadcasts file changes and upload progress to clients
+	events *events.Broker
+
+	// web serves the frontend, embedded or from --web-dir
+	web *webui.Handler
+
+	// loader re-reads the configuration on reload; nil disables reloading
+	loader config.Loader
 }
 
 // New creates a new server instance
-func New(cfg *config.Config) (*Server, error) {
+func New(cfg *config.Config, loader config.Loader) (*Server, error) {
 	// Ensure upload directory exists
 	if err := fileutil.EnsureDir(cfg.UploadDir); err != nil {
 		return nil, fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
+	// Setup structured logging; other packages log through slog's default
+	logLevel := new(slog.LevelVar)
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logLevel.Set(level)
+	logger := logging.New(os.Stdout, cfg.LogFormat, logLevel)
+	slog.SetDefault(logger)
+
+	// Open the access log before any request can be served
+	var accessLog *accesslog.Logger
+	if cfg.IsAccessLogEnabled() {
+		accessLog, err = accesslog.New(accesslog.Options{
+			Path:           cfg.AccessLog,
+			Format:         cfg.AccessLogFormat,
+			MaxSizeMB:      cfg.AccessLogMaxSizeMB,
+			RotateInterval: time.Duration(cfg.AccessLogRotateHours) * time.Hour,
+			MaxBackups:     cfg.AccessLogMaxBackups,
+			Compress:       cfg.AccessLogCompress,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Open the audit trail kept alongside the files it describes
+	auditDir, err := fileutil.StateDir(cfg.UploadDir, "audit")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	auditLog, err := audit.Open(filepath.Join(auditDir, audit.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the expiry times chosen for uploaded files
+	retentionDir, err := fileutil.StateDir(cfg.UploadDir, "retention")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retention directory: %w", err)
+	}
+	expiry, err := retention.Open(filepath.Join(retentionDir, retention.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Record who uploaded each file, its type, description and tags
+	metadataDir, err := fileutil.StateDir(cfg.UploadDir, "metadata")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	meta, err := metadata.Open(filepath.Join(metadataDir, metadata.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	store := config.NewStore(cfg)
+
+	// Index text files for full-text search
+	searchDir, err := fileutil.StateDir(cfg.UploadDir, "search")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search directory: %w", err)
+	}
+	index, err := search.Open(store, filepath.Join(searchDir, search.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache image thumbnails
+	thumbnailsDir, err := fileutil.StateDir(cfg.UploadDir, "thumbnails")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create thumbnails directory: %w", err)
+	}
+
+	// Keep deleted files in the trash so they can be restored
+	trashDir, err := fileutil.StateDir(cfg.UploadDir, "trash")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	bin, err := trash.Open(store, trashDir, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep previous versions of overwritten files
+	versionsDir, err := fileutil.StateDir(cfg.UploadDir, "versions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create versions directory: %w", err)
+	}
+	versionStore, err := versions.Open(store, versionsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record file checksums so downloads don't rehash unchanged files
+	checksumsDir, err := fileutil.StateDir(cfg.UploadDir, "checksums")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checksums directory: %w", err)
+	}
+	checksums, err := checksum.Open(filepath.Join(checksumsDir, checksum.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Store identical uploads once, shared by copy-on-write clones
+	objectsDir, err := fileutil.StateDir(cfg.UploadDir, "objects")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create objects directory: %w", err)
+	}
+	content, err := dedup.Open(store, objectsDir, checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serve the embedded frontend unless a directory overrides it
+	webHandler := webui.New(web.Dist(), true)
+	if cfg.WebDir != "" {
+		if info, err := os.Stat(cfg.WebDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("web directory %s does not exist", cfg.WebDir)
+		}
+		webHandler = webui.New(os.DirFS(cfg.WebDir), false)
+	}
+
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -31,9 +228,33 @@ func New(cfg *config.Config) (*Server, error) {
 	// Add recovery middleware
 	router.Use(gin.Recovery())
 
+	// Files changed on disk outside an upload change the storage in use
+	guard := quota.NewGuard(store)
+	broker := events.NewBroker()
+	broker.Observe(func(models.Event) { guard.Invalidate() })
+
 	server := &Server{
-		config: cfg,
-		router: router,
+		config:   store,
+		router:   router,
+		logger:   logger,
+		logLevel: logLevel,
+		loader:   loader,
+
+		accessLog:  accessLog,
+		audit:      auditLog,
+		metrics:    metrics.New(store),
+		quota:      guard,
+		expiry:     expiry,
+		janitor:    retention.NewJanitor(store, expiry, auditLog, bin, index, checksums, broker),
+		trash:      bin,
+		versions:   versionStore,
+		checksums:  checksums,
+		content:    content,
+		metadata:   meta,
+		index:      index,
+		thumbnails: thumbnail.NewCache(thumbnailsDir),
+		events:     broker,
+		web:        webHandler,
 	}
 
 	// Setup routes
@@ -46,40 +267,96 @@ func New(cfg *config.Config) (*Server, error) {
 func (s *Server) Start() error {
 	s.printStartupBanner()
 
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	if err := s.router.Run(addr); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	cfg := s.config.Get()
+	errCh := make(chan error, 3)
+
+	go s.watchReloadSignal()
+	go s.runJanitor()
+
+	// Changes made on disk are announced too; without a watcher, clients
+	// still hear about changes made through the web interface
+	if err := s.events.Watch(cfg.UploadDir); err != nil {
+		slog.Warn("file changes on disk will not be announced", "error", err)
+	}
+
+	if cfg.IsS3Enabled() {
+		go func() {
+			errCh <- s.startS3()
+		}()
 	}
 
+	if cfg.IsSFTPEnabled() {
+		sftpServer, err := sftpserver.New(s.config, s.audit, s.metrics, s.quota, s.expiry, s.trash, s.versions, s.checksums, s.content, s.metadata, s.index)
+		if err != nil {
+			return fmt.Errorf("failed to create SFTP server: %w", err)
+		}
+		go func() {
+			if err := sftpServer.ListenAndServe(); err != nil {
+				errCh <- fmt.Errorf("failed to start SFTP server: %w", err)
+			}
+		}()
+	}
+
+	go func() {
+		addr := fmt.Sprintf(":%d", cfg.Port)
+		if err := s.router.Run(addr); err != nil {
+			errCh <- fmt.Errorf("failed to start server: %w", err)
+		}
+	}()
+
+	return <-errCh
+}
+
+// startS3 serves the S3-compatible API on its own port
+func (s *Server) startS3() error {
+	addr := fmt.Sprintf(":%d", s.config.Get().S3Port)
+	handler := s.instrumentS3(s3.NewHandler(s.config, s.audit, s.metrics, s.quota, s.trash, s.versions, s.checksums, s.content, s.metadata, s.index))
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		return fmt.Errorf("failed to start S3 endpoint: %w", err)
+	}
 	return nil
 }
 
 // printStartupBanner displays server information
 func (s *Server) printStartupBanner() {
+	cfg := s.config.Get()
 	localIP := getLocalIP()
 
 	fmt.Println("\n╔════════════════════════════════════════════════════════════╗")
 	fmt.Println("║              LocalShare Server Started                      ║")
 	fmt.Println("╠════════════════════════════════════════════════════════════╣")
-	fmt.Printf("║  Local:    http://localhost:%d                          ║\n", s.config.Port)
+	fmt.Printf("║  Local:    http://localhost:%d                          ║\n", cfg.Port)
 	if localIP != "" {
-		fmt.Printf("║  Network:  http://%-15s:%d                      ║\n", localIP, s.config.Port)
+		fmt.Printf("║  Network:  http://%-15s:%d                      ║\n", localIP, cfg.Port)
 	}
 	fmt.Println("╠════════════════════════════════════════════════════════════╣")
-	fmt.Printf("║  Upload Directory: %-39s ║\n", truncateString(s.config.UploadDir, 39))
+	fmt.Printf("║  Upload Directory: %-39s ║\n", truncateString(cfg.UploadDir, 39))
+
+	if cfg.ConfigFile != "" {
+		fmt.Printf("║  Config File: %-44s ║\n", truncateString(cfg.ConfigFile, 44))
+	}
 
-	if s.config.IsPINProtected() {
+	if cfg.IsPINProtected() {
 		fmt.Println("║  PIN Protection: ENABLED                                ║")
 	}
 
-	if s.config.IsAdminAuthEnabled() {
+	if cfg.IsAdminAuthEnabled() {
 		fmt.Println("║  Admin Auth: ENABLED                                    ║")
 	}
 
-	fmt.Printf("║  Max File Size: %d MB                                  ║\n", s.config.MaxFileSizeMB)
+	fmt.Printf("║  Max File Size: %d MB                                  ║\n", cfg.MaxFileSizeMB)
+
+	if cfg.IsS3Enabled() {
+		fmt.Printf("║  S3 Endpoint: http://localhost:%d (bucket %s)\n", cfg.S3Port, cfg.S3Bucket)
+	}
+
+	if cfg.IsSFTPEnabled() {
+		fmt.Printf("║  SFTP: sftp -P %d %s@%s\n", cfg.SFTPPort, cfg.AdminUser, localIP)
+	}
+
 	fmt.Println("╚════════════════════════════════════════════════════════════╝")
 	fmt.Println("\n Type the Network URL)")
-	fmt.Println("Press Ctrl+C to stop the server\n")
+	fmt.Print("Press Ctrl+C to stop the server\n\n")
 }
 
 // getLocalIP returns the local IP address
@@ -0,0 +1,469 @@
+package sftpserver
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const tmpDirName = "sftp-tmp"
+
+// errFileTooLarge is returned when a write would exceed the maximum file size
+var errFileTooLarge = errors.New("file size exceeds maximum")
+
+// handlers implements the pkg/sftp request server interfaces over the flat
+// upload directory. Only "/" is a directory; every other path names a file.
+type handlers struct {
+	config    *config.Store
+	audit     *audit.Log
+	metrics   *metrics.Metrics
+	quota     *quota.Guard
+	expiry    *retention.Store
+	trash     *trash.Bin
+	versions  *versions.Store
+	checksums *checksum.Store
+	content   *dedup.Store
+	metadata  *metadata.Store
+	index     *search.Index
+	isAdmin   bool
+
+	// user and clientIP identify the session in the audit trail
+	user     string
+	clientIP string
+}
+
+// newHandlers creates the SFTP request handlers for one session
+func (s *Server) newHandlers(conn ssh.ConnMetadata, isAdmin bool) sftp.Handlers {
+	h := &handlers{
+		config:    s.config,
+		audit:     s.audit,
+		metrics:   s.metrics,
+		quota:     s.quota,
+		expiry:    s.expiry,
+		trash:     s.trash,
+		versions:  s.versions,
+		checksums: s.checksums,
+		content:   s.content,
+		metadata:  s.metadata,
+		index:     s.index,
+		isAdmin:   isAdmin,
+		user:      conn.User(),
+		clientIP:  remoteIP(conn.RemoteAddr()),
+	}
+	return sftp.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileList: h,
+	}
+}
+
+// record adds an operation performed in this session to the audit trail
+func (h *handlers) record(e models.AuditEvent) {
+	e.Protocol = audit.ProtocolSFTP
+	e.Actor = h.user
+	e.ClientIP = h.clientIP
+	h.audit.Record(e)
+}
+
+// canWrite reports whether the session may modify files. Like the HTTP
+// API, only the admin may write when admin authentication is enabled.
+func (h *handlers) canWrite() bool {
+	return h.isAdmin || !h.config.Get().IsAdminAuthEnabled()
+}
+
+// filePath maps an SFTP path onto a file in the upload directory
+func (h *handlers) filePath(p string) (string, error) {
+	dir, name := path.Split(path.Clean("/" + p))
+	if dir != "/" {
+		return "", sftp.ErrSSHFxNoSuchFile
+	}
+	filePath, err := fileutil.GetFilePath(h.config.Get().UploadDir, name)
+	if err != nil {
+		return "", sftp.ErrSSHFxNoSuchFile
+	}
+	return filePath, nil
+}
+
+// Fileread opens a file for download
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	filePath, err := h.filePath(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, sftp.ErrSSHFxNoSuchFile
+	}
+
+	if info, err := f.Stat(); err == nil {
+		h.record(models.AuditEvent{
+			Action:   audit.ActionDownload,
+			Filename: info.Name(),
+			Size:     info.Size(),
+		})
+	}
+	return &download{
+		File:    f,
+		metrics: h.metrics,
+		done:    h.metrics.StartTransfer(audit.ProtocolSFTP, metrics.DirectionDownload),
+	}, nil
+}
+
+// Filewrite opens a file for upload. Data is staged in a temporary file and
+// only moved into place once the transfer completes within the size limit.
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if !h.canWrite() {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	filePath, err := h.filePath(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	// SFTP does not announce the file size, so the limits are enforced as
+	// the file grows; this only refuses uploads once storage is already full
+	res, err := h.quota.Reserve(0)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := h.config.Get()
+	tmpDir, err := fileutil.StateDir(cfg.UploadDir, tmpDirName)
+	if err != nil {
+		res.Release()
+		return nil, sftp.ErrSSHFxFailure
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "put-*")
+	if err != nil {
+		res.Release()
+		return nil, sftp.ErrSSHFxFailure
+	}
+
+	return &upload{
+		session: h,
+		done:    h.metrics.StartTransfer(audit.ProtocolSFTP, metrics.DirectionUpload),
+		res:     res,
+		file:    tmp,
+		dst:     filePath,
+		maxSize: cfg.MaxFileSize(),
+		hash:    checksum.NewHasher(cfg.HashBLAKE3),
+	}, nil
+}
+
+// Filecmd handles rename, remove and attribute changes
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		// Permissions and timestamps are managed by LocalShare
+		return nil
+	case "Rename":
+		if !h.canWrite() {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		src, err := h.filePath(r.Filepath)
+		if err != nil {
+			return err
+		}
+		dst, err := h.filePath(r.Target)
+		if err != nil {
+			return err
+		}
+		if fileutil.FileExists(dst) {
+			return sftp.ErrSSHFxFailure
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return sftp.ErrSSHFxNoSuchFile
+		}
+		// The file keeps the expiry its uploader chose under its new name
+		if err := h.expiry.Rename(filepath.Base(src), filepath.Base(dst)); err != nil {
+			slog.Warn("sftp rename lost file expiry", slog.String("file", filepath.Base(dst)), slog.String("error", err.Error()))
+		}
+		// Checksums that fail to move are recomputed on download
+		h.checksums.Rename(filepath.Base(src), filepath.Base(dst))
+		if err := h.metadata.Rename(filepath.Base(src), filepath.Base(dst)); err != nil {
+			slog.Warn("sftp rename lost file metadata", slog.String("file", filepath.Base(dst)), slog.String("error", err.Error()))
+		}
+		if err := h.versions.Rename(filepath.Base(src), filepath.Base(dst)); err != nil {
+			slog.Warn("sftp rename lost file versions", slog.String("file", filepath.Base(dst)), slog.String("error", err.Error()))
+		}
+		h.index.Remove(filepath.Base(src))
+		h.index.Add(dst)
+		h.record(models.AuditEvent{
+			Action:   audit.ActionRename,
+			Filename: filepath.Base(src),
+			Target:   filepath.Base(dst),
+		})
+		return nil
+	case "Remove":
+		if !h.canWrite() {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		filePath, err := h.filePath(r.Filepath)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return sftp.ErrSSHFxNoSuchFile
+		}
+		if err := h.trash.Remove(filePath, h.user, h.clientIP); err != nil {
+			return sftp.ErrSSHFxNoSuchFile
+		}
+		h.index.Remove(info.Name())
+		h.record(models.AuditEvent{
+			Action:   audit.ActionDelete,
+			Filename: info.Name(),
+			Size:     info.Size(),
+		})
+		return nil
+	}
+
+	// Directories and links are not part of the flat share
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// Filelist handles directory listings and stat calls
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if path.Clean("/"+r.Filepath) == "/" {
+		switch r.Method {
+		case "List":
+			return h.listRoot()
+		case "Stat":
+			info, err := os.Stat(h.config.Get().UploadDir)
+			if err != nil {
+				return nil, sftp.ErrSSHFxFailure
+			}
+			return listerAt{info}, nil
+		}
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+
+	filePath, err := h.filePath(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "List", "Stat":
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, sftp.ErrSSHFxNoSuchFile
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// listRoot lists the upload directory, hiding LocalShare's state directory
+func (h *handlers) listRoot() (sftp.ListerAt, error) {
+	entries, err := os.ReadDir(h.config.Get().UploadDir)
+	if err != nil {
+		return nil, sftp.ErrSSHFxFailure
+	}
+
+	infos := make(listerAt, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() == fileutil.StateDirName {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// listerAt serves a fixed slice of file infos
+type listerAt []os.FileInfo
+
+// ListAt copies entries starting at offset into ls
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// download is an open SFTP download that counts the bytes served
+type download struct {
+	*os.File
+	metrics *metrics.Metrics
+	done    func()
+}
+
+// ReadAt reads from the file, counting the bytes sent
+func (d *download) ReadAt(p []byte, off int64) (int, error) {
+	n, err := d.File.ReadAt(p, off)
+	d.metrics.AddBytes(audit.ProtocolSFTP, metrics.DirectionDownload, int64(n))
+	return n, err
+}
+
+// Close closes the file and ends the transfer
+func (d *download) Close() error {
+	d.done()
+	return d.File.Close()
+}
+
+// upload is an in-progress SFTP upload staged in a temporary file
+type upload struct {
+	session *handlers
+	done    func()
+	res     *quota.Reservation
+	file    *os.File
+	dst     string
+	maxSize int64
+
+	mu       sync.Mutex
+	failed   bool
+	reserved int64
+
+	// hash covers the first hashed bytes. Clients usually write in order;
+	// if one skips ahead or rewrites, hash is dropped and the checksums are
+	// left to be computed on download.
+	hash   *checksum.Hasher
+	hashed int64
+	size   int64
+}
+
+// WriteAt writes to the staging file, refusing writes past the size limit
+func (u *upload) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > u.maxSize {
+		u.fail()
+		return 0, errFileTooLarge
+	}
+	if err := u.grow(off + int64(len(p))); err != nil {
+		u.fail()
+		return 0, err
+	}
+	n, err := u.file.WriteAt(p, off)
+	if err != nil {
+		u.fail()
+	}
+	u.session.metrics.AddBytes(audit.ProtocolSFTP, metrics.DirectionUpload, int64(n))
+
+	u.mu.Lock()
+	if u.hash != nil {
+		if off == u.hashed {
+			u.hash.Write(p[:n])
+			u.hashed += int64(n)
+		} else {
+			u.hash = nil
+		}
+	}
+	u.size = max(u.size, off+int64(n))
+	u.mu.Unlock()
+
+	return n, err
+}
+
+// grow extends the quota reservation to cover a staged file of size bytes
+func (u *upload) grow(size int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if size <= u.reserved {
+		return nil
+	}
+	if err := u.res.Grow(size - u.reserved); err != nil {
+		return err
+	}
+	u.reserved = size
+	return nil
+}
+
+// TransferError is called by the request server when the transfer is aborted
+func (u *upload) TransferError(err error) {
+	u.fail()
+}
+
+func (u *upload) fail() {
+	u.mu.Lock()
+	u.failed = true
+	u.mu.Unlock()
+}
+
+// Close moves the staged file into place, or discards it if the transfer failed
+func (u *upload) Close() error {
+	u.mu.Lock()
+	failed := u.failed
+	e := models.AuditEvent{
+		Action:   audit.ActionUpload,
+		Filename: filepath.Base(u.dst),
+		Size:     u.size,
+	}
+	var sums *checksum.Sums
+	if u.hash != nil && u.hashed == u.size {
+		s := u.hash.Sums()
+		sums = &s
+		e.SHA256 = s.SHA256
+	}
+	u.mu.Unlock()
+
+	u.done()
+	defer u.res.Release()
+	u.file.Close()
+	if failed {
+		os.Remove(u.file.Name())
+		return nil
+	}
+
+	if sums != nil {
+		if err := u.session.content.Intern(u.file.Name(), sums.SHA256); err != nil {
+			os.Remove(u.file.Name())
+			return err
+		}
+	}
+	if err := u.session.versions.Replace(u.file.Name(), u.dst); err != nil {
+		os.Remove(u.file.Name())
+		return err
+	}
+	if sums != nil {
+		u.session.checksums.Set(u.dst, *sums)
+	}
+	name := filepath.Base(u.dst)
+	u.session.metadata.RecordUpload(name, metadata.New(u.dst, u.session.user, u.session.clientIP, name))
+	u.session.index.Add(u.dst)
+
+	u.session.record(e)
+	return nil
+}
+
+// remoteIP returns the host part of a network address
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,244 @@
+package sftpserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/checksum"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/dedup"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/internal/quota"
+	"github.com/OderoCeasar/localshare/internal/retention"
+	"github.com/OderoCeasar/localshare/internal/search"
+	"github.com/OderoCeasar/localshare/internal/trash"
+	"github.com/OderoCeasar/localshare/internal/versions"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	hostKeyFile = "ssh_host_ed25519_key"
+	roleKey     = "role"
+	roleAdmin   = "admin"
+	roleUser    = "user"
+)
+
+// Server is an SSH server that only offers the SFTP subsystem, backed by the
+// upload directory and the same accounts and policies as the HTTP API
+type Server struct {
+	config    *config.Store
+	audit     *audit.Log
+	metrics   *metrics.Metrics
+	quota     *quota.Guard
+	expiry    *retention.Store
+	trash     *trash.Bin
+	versions  *versions.Store
+	checksums *checksum.Store
+	content   *dedup.Store
+	metadata  *metadata.Store
+	index     *search.Index
+	sshConfig *ssh.ServerConfig
+}
+
+// New creates a new SFTP server, generating and persisting a host key on first run
+func New(cfg *config.Store, auditLog *audit.Log, m *metrics.Metrics, guard *quota.Guard, expiry *retention.Store, bin *trash.Bin, store *versions.Store, checksums *checksum.Store, content *dedup.Store, meta *metadata.Store, index *search.Index) (*Server, error) {
+	signer, err := loadOrCreateHostKey(cfg.Get().UploadDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH host key: %w", err)
+	}
+
+	s := &Server{
+		config:    cfg,
+		audit:     auditLog,
+		metrics:   m,
+		quota:     guard,
+		expiry:    expiry,
+		trash:     bin,
+		versions:  store,
+		checksums: checksums,
+		content:   content,
+		metadata:  meta,
+		index:     index,
+	}
+
+	s.sshConfig = &ssh.ServerConfig{
+		NoClientAuth:         true,
+		NoClientAuthCallback: s.authenticateNone,
+		PasswordCallback:     s.authenticate,
+		ServerVersion:        "SSH-2.0-LocalShare",
+	}
+	s.sshConfig.AddHostKey(signer)
+
+	return s, nil
+}
+
+// authenticateNone allows logins without a password when neither a PIN nor
+// an admin account is configured, matching the open HTTP API. With only an
+// admin account, clients fall through to a password prompt.
+func (s *Server) authenticateNone(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+	cfg := s.config.Get()
+	if cfg.IsPINProtected() || cfg.IsAdminAuthEnabled() {
+		return nil, errors.New("password required")
+	}
+	return &ssh.Permissions{Extensions: map[string]string{roleKey: roleUser}}, nil
+}
+
+// authenticate maps SSH password logins onto LocalShare's admin account and
+// PIN. Logging in as the admin with the wrong password fails outright rather
+// than falling back to a user login. Without a PIN, any other login is let
+// in without checking its password, as the HTTP API is open then too.
+func (s *Server) authenticate(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	cfg := s.config.Get()
+
+	if cfg.IsAdminAuthEnabled() {
+		userMatch := subtle.ConstantTimeCompare([]byte(conn.User()), []byte(cfg.AdminUser)) == 1
+		passMatch := subtle.ConstantTimeCompare(password, []byte(cfg.AdminPass)) == 1
+		if userMatch && passMatch {
+			return &ssh.Permissions{Extensions: map[string]string{roleKey: roleAdmin}}, nil
+		}
+		if userMatch {
+			return nil, s.loginFailed(conn)
+		}
+	}
+
+	if cfg.IsPINProtected() {
+		if subtle.ConstantTimeCompare(password, []byte(cfg.PIN)) == 1 {
+			return &ssh.Permissions{Extensions: map[string]string{roleKey: roleUser}}, nil
+		}
+		return nil, s.loginFailed(conn)
+	}
+
+	return &ssh.Permissions{Extensions: map[string]string{roleKey: roleUser}}, nil
+}
+
+// loginFailed records a rejected login and returns the error refusing it
+func (s *Server) loginFailed(conn ssh.ConnMetadata) error {
+	s.audit.Record(models.AuditEvent{
+		Action:   audit.ActionLoginFailed,
+		Protocol: audit.ProtocolSFTP,
+		Actor:    conn.User(),
+		ClientIP: remoteIP(conn.RemoteAddr()),
+	})
+	s.metrics.AuthFailed(audit.ProtocolSFTP)
+	return errors.New("invalid credentials")
+}
+
+// ListenAndServe accepts SSH connections on the configured SFTP port
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.Get().SFTPPort))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn performs the SSH handshake and serves SFTP sessions on the connection
+func (s *Server) handleConn(nConn net.Conn) {
+	defer nConn.Close()
+
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, s.sshConfig)
+	if err != nil {
+		slog.Warn("sftp handshake failed", slog.String("client_ip", nConn.RemoteAddr().String()), slog.String("error", err.Error()))
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	slog.Info("sftp login", slog.String("user", conn.User()), slog.String("client_ip", conn.RemoteAddr().String()))
+	s.audit.Record(models.AuditEvent{
+		Action:   audit.ActionLogin,
+		Protocol: audit.ProtocolSFTP,
+		Actor:    conn.User(),
+		ClientIP: remoteIP(conn.RemoteAddr()),
+	})
+
+	isAdmin := conn.Permissions != nil && conn.Permissions.Extensions[roleKey] == roleAdmin
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go s.serveSession(channel, requests, s.newHandlers(conn, isAdmin))
+	}
+}
+
+// serveSession waits for the sftp subsystem request and serves the session
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request, handlers sftp.Handlers) {
+	defer channel.Close()
+
+	for req := range requests {
+		// The payload is an SSH string: a uint32 length followed by the subsystem name
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		server := sftp.NewRequestServer(channel, handlers)
+		if err := server.Serve(); err != nil && err != io.EOF {
+			slog.Warn("sftp session ended with error", slog.String("error", err.Error()))
+		}
+		server.Close()
+		return
+	}
+}
+
+// loadOrCreateHostKey reads the persisted host key or generates a new ed25519 key
+func loadOrCreateHostKey(uploadDir string) (ssh.Signer, error) {
+	dir, err := fileutil.StateDir(uploadDir, "")
+	if err != nil {
+		return nil, err
+	}
+	keyPath := filepath.Join(dir, hostKeyFile)
+
+	if data, err := os.ReadFile(keyPath); err == nil {
+		return ssh.ParsePrivateKey(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "localshare host key")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	return ssh.NewSignerFromKey(key)
+}
@@ -0,0 +1,85 @@
+package sftpserver
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/audit"
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/metrics"
+)
+
+// connMetadata is the SSH connection of a client logging in
+type connMetadata struct {
+	user string
+}
+
+func (c connMetadata) User() string          { return c.user }
+func (c connMetadata) SessionID() []byte     { return nil }
+func (c connMetadata) ClientVersion() []byte { return []byte("SSH-2.0-test") }
+func (c connMetadata) ServerVersion() []byte { return []byte("SSH-2.0-LocalShare") }
+func (c connMetadata) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 50000}
+}
+func (c connMetadata) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name      string
+		pin       string
+		adminAuth bool
+		user      string
+		password  string
+		wantRole  string // "" when the login is refused
+	}{
+		{name: "admin", adminAuth: true, user: "admin", password: "secret", wantRole: roleAdmin},
+		{name: "admin with a wrong password", adminAuth: true, user: "admin", password: "guess"},
+		{name: "admin with the PIN as password", pin: "1234", adminAuth: true, user: "admin", password: "1234"},
+		{name: "guest with the PIN", pin: "1234", adminAuth: true, user: "guest", password: "1234", wantRole: roleUser},
+		{name: "guest with a wrong PIN", pin: "1234", user: "guest", password: "0000"},
+		{name: "guest without a PIN", adminAuth: true, user: "guest", password: "anything", wantRole: roleUser},
+		{name: "open share", user: "admin", password: "anything", wantRole: roleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.UploadDir = t.TempDir()
+			cfg.PIN = tt.pin
+			cfg.AdminAuth = tt.adminAuth
+			cfg.AdminPass = "secret"
+			store := config.NewStore(&cfg)
+			auditLog, err := audit.Open(filepath.Join(t.TempDir(), audit.FileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer auditLog.Close()
+			s := &Server{config: store, audit: auditLog, metrics: metrics.New(store)}
+
+			perms, err := s.authenticate(connMetadata{user: tt.user}, []byte(tt.password))
+			if tt.wantRole == "" {
+				if err == nil {
+					t.Fatalf("login succeeded as %s, want it refused", perms.Extensions[roleKey])
+				}
+				// Refused logins are audited
+				failed, _, err := auditLog.Query(audit.Filter{Actions: []string{audit.ActionLoginFailed}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(failed) != 1 || failed[0].Actor != tt.user || failed[0].ClientIP != "192.168.1.20" {
+					t.Errorf("audit = %+v, want a failed login by %s", failed, tt.user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("login refused: %v", err)
+			}
+			if role := perms.Extensions[roleKey]; role != tt.wantRole {
+				t.Errorf("role = %s, want %s", role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package thumbnail
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSize is the thumbnail size used when none is requested
+const DefaultSize = 256
+
+// Sizes are the thumbnail sizes that can be requested, in pixels along the
+// longer side. Keeping them few bounds the cache.
+var Sizes = []int{64, 128, 256, 512}
+
+// maxPixels is the largest image that is decoded, to bound memory use
+const maxPixels = 50_000_000
+
+// samples is how many source pixels are averaged along each axis for each
+// thumbnail pixel
+const samples = 4
+
+var (
+	// ErrUnsupported is returned for files that are not JPEG, PNG or GIF images
+	ErrUnsupported = errors.New("thumbnails are only available for JPEG, PNG and GIF images")
+
+	// ErrTooLarge is returned for images with too many pixels to decode safely
+	ErrTooLarge = fmt.Errorf("images over %d megapixels are not thumbnailed", maxPixels/1_000_000)
+)
+
+// ValidSize reports whether size is one of Sizes
+func ValidSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Cache generates thumbnails on first request and keeps them in dir, one
+// directory per file. A thumbnail carries the modification time of the file
+// it was made from, so replacing the file invalidates it.
+type Cache struct {
+	dir string
+}
+
+// NewCache creates a thumbnail cache in dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Get returns the path of a thumbnail of the image at filePath no larger
+// than size pixels on either side, generating it if needed
+func (c *Cache) Get(filePath string, size int) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(filePath)
+	thumbPath := filepath.Join(c.dir, name, strconv.Itoa(size))
+	if thumb, err := os.Stat(thumbPath); err == nil && thumb.ModTime().Equal(info.ModTime()) {
+		return thumbPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(c.dir, name), 0755); err != nil {
+		return "", err
+	}
+	if err := generate(filePath, thumbPath, size); err != nil {
+		return "", err
+	}
+	if err := os.Chtimes(thumbPath, time.Time{}, info.ModTime()); err != nil {
+		return "", err
+	}
+	return thumbPath, nil
+}
+
+// Prune removes the thumbnails of files in uploadDir that are gone or have
+// changed since
+func (c *Cache) Prune(uploadDir string) error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		thumbDir := filepath.Join(c.dir, entry.Name())
+		info, err := os.Stat(filepath.Join(uploadDir, entry.Name()))
+		if err == nil && !stale(thumbDir, info.ModTime()) {
+			continue
+		}
+		if err := os.RemoveAll(thumbDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stale reports whether any thumbnail in dir was made from content other
+// than that last modified at modTime
+func stale(dir string, modTime time.Time) bool {
+	thumbs, err := os.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+	for _, t := range thumbs {
+		if strings.HasPrefix(t.Name(), ".") {
+			// A thumbnail still being generated
+			continue
+		}
+		info, err := t.Info()
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// generate writes a thumbnail of the image at src to dst: a PNG for PNG and
+// GIF images, which may be transparent, and a JPEG otherwise
+func generate(src, dst string, size int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return ErrUnsupported
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return ErrTooLarge
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return ErrUnsupported
+	}
+
+	thumb := scale(img, size)
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == "png" || format == "gif" {
+		err = png.Encode(tmp, thumb)
+	} else {
+		err = jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: 80})
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// scale shrinks img to fit within size pixels on either side, keeping its
+// aspect ratio. Each thumbnail pixel averages a grid of source pixels.
+// Images already small enough are copied unchanged.
+func scale(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			var r, g, bl, a uint64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					// Sample at the centres of a grid over the source area
+					px := b.Min.X + (2*(x*samples+sx)+1)*w/(2*tw*samples)
+					py := b.Min.Y + (2*(y*samples+sy)+1)*h/(2*th*samples)
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+				}
+			}
+			n := uint64(samples * samples)
+			thumb.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return thumb
+}
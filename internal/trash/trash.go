@@ -0,0 +1,265 @@
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// indexFile lists the trashed files; each file's content is stored next to
+// it under its ID
+const indexFile = "index.json"
+
+var (
+	// ErrNotFound is returned for an ID that is not in the trash
+	ErrNotFound = errors.New("trash item not found")
+
+	// ErrExists is returned when restoring over a file that now exists
+	ErrExists = errors.New("a file with the original name already exists")
+)
+
+// Bin keeps deleted files in a hidden directory so they can be restored
+// until they are purged. With trash_days set to 0, files are deleted
+// immediately instead. A file's metadata goes into the trash with it.
+type Bin struct {
+	config   *config.Store
+	dir      string
+	metadata *metadata.Store
+
+	mu    sync.Mutex
+	items map[string]models.TrashItem
+}
+
+// Open loads the trash stored in dir
+func Open(cfg *config.Store, dir string, meta *metadata.Store) (*Bin, error) {
+	b := &Bin{
+		config:   cfg,
+		dir:      dir,
+		metadata: meta,
+		items:    make(map[string]models.TrashItem),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash index: %w", err)
+	}
+	if err := json.Unmarshal(data, &b.items); err != nil {
+		return nil, fmt.Errorf("failed to parse trash index: %w", err)
+	}
+	return b, nil
+}
+
+// Remove deletes the file or folder at filePath, moving it to the trash if
+// the trash is enabled. deletedBy and clientIP identify who deleted it. A missing
+// file returns an error satisfying os.IsNotExist.
+func (b *Bin) Remove(filePath, deletedBy, clientIP string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Folders, such as extracted archives, go as a whole
+	size := info.Size()
+	if info.IsDir() {
+		if size, err = fileutil.TotalSize(filePath); err != nil {
+			return err
+		}
+	}
+
+	if b.config.Get().TrashDays == 0 {
+		if err := os.RemoveAll(filePath); err != nil {
+			return err
+		}
+		b.metadata.Remove(info.Name())
+		return nil
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := os.Rename(filePath, filepath.Join(b.dir, id)); err != nil {
+		return err
+	}
+	// Metadata that fails to save is pruned once the file is gone
+	md, _ := b.metadata.Remove(info.Name())
+
+	item := models.TrashItem{
+		ID:           id,
+		OriginalPath: info.Name(),
+		Size:         size,
+		DeletedBy:    deletedBy,
+		ClientIP:     clientIP,
+		DeletedAt:    time.Now().UTC(),
+		Metadata:     md,
+	}
+	if md != nil {
+		item.UploaderIP = md.UploaderIP
+	}
+	b.items[id] = item
+	return b.save()
+}
+
+// List returns the trashed files, most recently deleted first
+func (b *Bin) List() []models.TrashItem {
+	retention := b.retention()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items := make([]models.TrashItem, 0, len(b.items))
+	for _, item := range b.items {
+		if retention > 0 {
+			purgeAt := item.DeletedAt.Add(retention)
+			item.PurgeAt = &purgeAt
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items
+}
+
+// Restore moves a trashed file back to its original name in uploadDir.
+// The item is returned along with ErrExists so callers can name the conflict.
+func (b *Bin) Restore(id, uploadDir string) (models.TrashItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item, ok := b.items[id]
+	if !ok {
+		return models.TrashItem{}, ErrNotFound
+	}
+
+	dst, err := fileutil.GetFilePath(uploadDir, item.OriginalPath)
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+	if fileutil.FileExists(dst) {
+		return item, ErrExists
+	}
+	if err := os.Rename(filepath.Join(b.dir, id), dst); err != nil {
+		return models.TrashItem{}, err
+	}
+	if item.Metadata != nil {
+		md := *item.Metadata
+		md.UploaderIP = item.UploaderIP
+		b.metadata.Set(item.OriginalPath, md)
+	}
+
+	delete(b.items, id)
+	return item, b.save()
+}
+
+// Purge permanently deletes one trashed file
+func (b *Bin) Purge(id string) (models.TrashItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item, ok := b.items[id]
+	if !ok {
+		return models.TrashItem{}, ErrNotFound
+	}
+	if err := b.purge(id); err != nil {
+		return models.TrashItem{}, err
+	}
+	return item, b.save()
+}
+
+// PurgeBefore permanently deletes every file trashed before cutoff, or all
+// of them for a zero cutoff, and returns what was deleted
+func (b *Bin) PurgeBefore(cutoff time.Time) ([]models.TrashItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var purged []models.TrashItem
+	var firstErr error
+	for id, item := range b.items {
+		if !cutoff.IsZero() && !item.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := b.purge(id); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged = append(purged, item)
+	}
+
+	if len(purged) > 0 {
+		if err := b.save(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return purged, firstErr
+}
+
+// PurgeExpired permanently deletes files that have been in the trash
+// longer than the configured number of days
+func (b *Bin) PurgeExpired(now time.Time) ([]models.TrashItem, error) {
+	retention := b.retention()
+	if retention <= 0 {
+		// With the trash disabled, anything left over from before is purged
+		return b.PurgeBefore(time.Time{})
+	}
+	return b.PurgeBefore(now.Add(-retention))
+}
+
+// retention returns how long files stay in the trash
+func (b *Bin) retention() time.Duration {
+	return time.Duration(b.config.Get().TrashDays) * 24 * time.Hour
+}
+
+// purge deletes a trashed file's content and forgets it. The caller must
+// hold b.mu and save the index afterwards.
+func (b *Bin) purge(id string) error {
+	// RemoveAll also deletes trashed folders and ignores missing content
+	if err := os.RemoveAll(filepath.Join(b.dir, id)); err != nil {
+		return err
+	}
+	delete(b.items, id)
+	return nil
+}
+
+// save writes the index atomically. The caller must hold b.mu.
+func (b *Bin) save() error {
+	data, err := json.MarshalIndent(b.items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(filepath.Join(b.dir, indexFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to save trash index: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random identifier for a trashed file
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
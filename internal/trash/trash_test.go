@@ -0,0 +1,303 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/metadata"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// testBin is a trash bin over a fresh upload directory
+type testBin struct {
+	*Bin
+	config    *config.Store
+	uploadDir string
+	dir       string
+	metadata  *metadata.Store
+}
+
+func newTestBin(t *testing.T, trashDays int) *testBin {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	cfg.TrashDays = trashDays
+	store := config.NewStore(&cfg)
+
+	dir, err := fileutil.StateDir(cfg.UploadDir, "trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := metadata.Open(filepath.Join(cfg.UploadDir, fileutil.StateDirName, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(store, dir, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testBin{Bin: b, config: store, uploadDir: cfg.UploadDir, dir: dir, metadata: meta}
+}
+
+// create writes a file with content into the upload directory
+func (tb *testBin) create(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(tb.uploadDir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name      string
+		trashDays int
+		wantItems int
+	}{
+		{name: "trash enabled", trashDays: 30, wantItems: 1},
+		{name: "trash disabled", trashDays: 0, wantItems: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBin(t, tt.trashDays)
+			path := tb.create(t, "a.txt", "hello")
+			tb.metadata.Set("a.txt", models.FileMetadata{Description: "greeting"})
+
+			if err := tb.Remove(path, "admin", "10.0.0.1"); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("a.txt still exists: %v", err)
+			}
+			if _, ok := tb.metadata.Get("a.txt"); ok {
+				t.Error("metadata of a.txt was left behind")
+			}
+
+			items := tb.List()
+			if len(items) != tt.wantItems {
+				t.Fatalf("List = %d items, want %d", len(items), tt.wantItems)
+			}
+			if tt.wantItems == 0 {
+				return
+			}
+			item := items[0]
+			if item.OriginalPath != "a.txt" || item.Size != 5 || item.DeletedBy != "admin" || item.ClientIP != "10.0.0.1" {
+				t.Errorf("item = %+v", item)
+			}
+			if item.Metadata == nil || item.Metadata.Description != "greeting" {
+				t.Errorf("item metadata = %+v, want the file's", item.Metadata)
+			}
+			if item.PurgeAt == nil || !item.PurgeAt.Equal(item.DeletedAt.Add(30*24*time.Hour)) {
+				t.Errorf("PurgeAt = %v, want 30 days after deletion", item.PurgeAt)
+			}
+		})
+	}
+}
+
+func TestRemoveMissing(t *testing.T) {
+	tb := newTestBin(t, 30)
+	if err := tb.Remove(filepath.Join(tb.uploadDir, "none.txt"), "", ""); !os.IsNotExist(err) {
+		t.Errorf("Remove error = %v, want one satisfying os.IsNotExist", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		// recreate writes a new file under the original name before restoring
+		recreate bool
+		unknown  bool
+		wantErr  error
+	}{
+		{name: "restores content and metadata"},
+		{name: "original name taken", recreate: true, wantErr: ErrExists},
+		{name: "unknown item", unknown: true, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBin(t, 30)
+			path := tb.create(t, "a.txt", "hello")
+			tb.metadata.Set("a.txt", models.FileMetadata{Tags: []string{"keep"}})
+			if err := tb.Remove(path, "admin", ""); err != nil {
+				t.Fatal(err)
+			}
+			id := tb.List()[0].ID
+			if tt.unknown {
+				id = "0000000000000000"
+			}
+			if tt.recreate {
+				tb.create(t, "a.txt", "newer")
+			}
+
+			_, err := tb.Restore(id, tb.uploadDir)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Restore error = %v, want %v", err, tt.wantErr)
+			}
+
+			want, wantItems := "hello", 0
+			if tt.wantErr != nil {
+				want, wantItems = "", 1
+				if tt.recreate {
+					want = "newer"
+				}
+			}
+			data, _ := os.ReadFile(path)
+			if string(data) != want {
+				t.Errorf("a.txt = %q, want %q", data, want)
+			}
+			if n := len(tb.List()); n != wantItems {
+				t.Errorf("trash holds %d items, want %d", n, wantItems)
+			}
+			if md, ok := tb.metadata.Get("a.txt"); (tt.wantErr == nil) != (ok && len(md.Tags) == 1) {
+				t.Errorf("metadata after restore = %+v, %v", md, ok)
+			}
+		})
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	tests := []struct {
+		name      string
+		trashDays int
+		after     time.Duration
+		wantLeft  int
+	}{
+		{name: "within retention", trashDays: 7, after: 6 * 24 * time.Hour, wantLeft: 1},
+		{name: "past retention", trashDays: 7, after: 8 * 24 * time.Hour, wantLeft: 0},
+		{name: "trash since disabled", trashDays: 0, after: 0, wantLeft: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBin(t, 7)
+			if err := tb.Remove(tb.create(t, "a.txt", "hello"), "", ""); err != nil {
+				t.Fatal(err)
+			}
+			id := tb.List()[0].ID
+			tb.config.Update(func(next *config.Config) error {
+				next.TrashDays = tt.trashDays
+				return nil
+			})
+
+			purged, err := tb.PurgeExpired(time.Now().Add(tt.after))
+			if err != nil {
+				t.Fatalf("PurgeExpired: %v", err)
+			}
+			if len(purged) != 1-tt.wantLeft {
+				t.Errorf("purged %d items, want %d", len(purged), 1-tt.wantLeft)
+			}
+			if n := len(tb.List()); n != tt.wantLeft {
+				t.Errorf("trash holds %d items, want %d", n, tt.wantLeft)
+			}
+			_, err = os.Stat(filepath.Join(tb.dir, id))
+			if exists := err == nil; exists != (tt.wantLeft == 1) {
+				t.Errorf("trashed content exists = %v, want %v", exists, tt.wantLeft == 1)
+			}
+		})
+	}
+}
+
+func TestReopen(t *testing.T) {
+	tb := newTestBin(t, 30)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := tb.Remove(tb.create(t, name, name), "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tb.Purge(tb.List()[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(tb.config, tb.dir, tb.metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := reopened.List()
+	if len(items) != 1 || items[0].OriginalPath != "a.txt" {
+		t.Errorf("reopened trash = %+v, want a.txt only", items)
+	}
+	if _, err := reopened.Purge("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Purge error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUploaderIP(t *testing.T) {
+	tb := newTestBin(t, 30)
+	path := tb.create(t, "a.txt", "hello")
+	tb.metadata.Set("a.txt", models.FileMetadata{Uploader: "alice", UploaderIP: "192.168.1.20"})
+	if err := tb.Remove(path, "bob", "192.168.1.30"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Admins listing the trash see where the file came from, after a
+	// restart too, and a restored file keeps it
+	reopened, err := Open(tb.config, tb.dir, tb.metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := reopened.List()
+	if len(items) != 1 || items[0].UploaderIP != "192.168.1.20" {
+		t.Fatalf("trash = %+v, want a.txt uploaded from 192.168.1.20", items)
+	}
+	if _, err := reopened.Restore(items[0].ID, tb.uploadDir); err != nil {
+		t.Fatal(err)
+	}
+	if md, _ := tb.metadata.Get("a.txt"); md.UploaderIP != "192.168.1.20" {
+		t.Errorf("restored metadata = %+v, want uploaded from 192.168.1.20", md)
+	}
+}
+
+func TestFolder(t *testing.T) {
+	tests := []struct {
+		name      string
+		trashDays int
+		wantItems int
+	}{
+		{name: "trash enabled", trashDays: 30, wantItems: 1},
+		{name: "trash disabled", trashDays: 0, wantItems: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBin(t, tt.trashDays)
+			folder := filepath.Join(tb.uploadDir, "site")
+			if err := os.MkdirAll(filepath.Join(folder, "css"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			tb.create(t, "site/index.html", "hello")
+			tb.create(t, "site/css/site.css", "body{}")
+
+			if err := tb.Remove(folder, "", ""); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			if _, err := os.Stat(folder); !os.IsNotExist(err) {
+				t.Errorf("site still exists: %v", err)
+			}
+			items := tb.List()
+			if len(items) != tt.wantItems {
+				t.Fatalf("List = %d items, want %d", len(items), tt.wantItems)
+			}
+			if tt.wantItems == 0 {
+				return
+			}
+			if items[0].Size != 11 {
+				t.Errorf("trashed folder size = %d, want 11", items[0].Size)
+			}
+
+			if _, err := tb.Purge(items[0].ID); err != nil {
+				t.Fatalf("Purge: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(tb.dir, items[0].ID)); !os.IsNotExist(err) {
+				t.Errorf("purged folder still exists: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package versions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/internal/models"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// indexFile lists the kept versions of every file; each version's content
+// is stored next to it under its ID
+const indexFile = "index.json"
+
+// ErrNotFound is returned for a version that does not exist
+var ErrNotFound = errors.New("version not found")
+
+// ErrIsDir is returned when a file would replace a folder
+var ErrIsDir = errors.New("a folder with that name exists")
+
+// Store keeps the previous contents of files that are overwritten. Up to
+// max_versions versions are kept per file, and the oldest versions across
+// all files are dropped once they take up more than versions_max_size_mb.
+type Store struct {
+	config *config.Store
+	dir    string
+
+	mu    sync.Mutex
+	index map[string][]models.FileVersion
+}
+
+// Open loads the version store in dir
+func Open(cfg *config.Store, dir string) (*Store, error) {
+	s := &Store{
+		config: cfg,
+		dir:    dir,
+		index:  make(map[string][]models.FileVersion),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version index: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.index); err != nil {
+		return nil, fmt.Errorf("failed to parse version index: %w", err)
+	}
+	return s, nil
+}
+
+// Replace moves src to dst. If dst already exists and versioning is
+// enabled, its current content is kept as a version first. A folder at dst
+// returns ErrIsDir.
+func (s *Store) Replace(src, dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Folders, such as extracted archives, are never replaced by a file
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return ErrIsDir
+	}
+
+	kept, err := s.keep(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if kept != nil {
+			// Put the previous content back rather than leave nothing in place
+			os.Rename(filepath.Join(s.dir, kept.ID), dst)
+			s.drop(filepath.Base(dst), kept.ID)
+		}
+		return err
+	}
+	if kept != nil {
+		s.prune()
+		return s.save()
+	}
+	return nil
+}
+
+// List returns the kept versions of the named file, newest first
+func (s *Store) List(name string) []models.FileVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.index[name]
+	versions := make([]models.FileVersion, len(list))
+	for i, v := range list {
+		versions[len(list)-1-i] = v
+	}
+	return versions
+}
+
+// Path returns the path of a version's content. The file is only valid
+// until the version is pruned or restored.
+func (s *Store) Path(name, id string) (string, models.FileVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.find(name, id)
+	if !ok {
+		return "", models.FileVersion{}, ErrNotFound
+	}
+	return filepath.Join(s.dir, v.ID), v, nil
+}
+
+// Restore makes a version the current content of dst, keeping the content
+// it replaces as a new version
+func (s *Store) Restore(dst, id string) (models.FileVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := filepath.Base(dst)
+	v, ok := s.find(name, id)
+	if !ok {
+		return models.FileVersion{}, ErrNotFound
+	}
+
+	kept, err := s.keep(dst)
+	if err != nil {
+		return models.FileVersion{}, err
+	}
+	if err := os.Rename(filepath.Join(s.dir, v.ID), dst); err != nil {
+		if kept != nil {
+			// Put the current content back rather than leave nothing in place
+			os.Rename(filepath.Join(s.dir, kept.ID), dst)
+			s.drop(name, kept.ID)
+		}
+		return models.FileVersion{}, err
+	}
+	s.drop(name, v.ID)
+
+	s.prune()
+	return v, s.save()
+}
+
+// Rename moves the kept versions of oldName to newName, so a renamed file
+// keeps its history. Versions left under newName by an earlier file of that
+// name are kept alongside them, oldest first, within the usual limits.
+func (s *Store) Rename(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved, ok := s.index[oldName]
+	if !ok {
+		return nil
+	}
+	delete(s.index, oldName)
+
+	list := append(s.index[newName], moved...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].ReplacedAt.Before(list[j].ReplacedAt)
+	})
+	s.index[newName] = list
+
+	s.prune()
+	return s.save()
+}
+
+// Prune drops versions beyond the configured limits
+func (s *Store) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.prune() {
+		return nil
+	}
+	return s.save()
+}
+
+// keep moves the file at filePath into the store if it exists and
+// versioning is enabled, returning the new version or nil. The caller must
+// hold s.mu.
+func (s *Store) keep(filePath string) (*models.FileVersion, error) {
+	if s.config.Get().MaxVersions == 0 {
+		return nil, nil
+	}
+
+	info, err := os.Stat(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filePath, filepath.Join(s.dir, id)); err != nil {
+		return nil, err
+	}
+
+	v := models.FileVersion{
+		ID:           id,
+		Size:         info.Size(),
+		ModifiedTime: info.ModTime(),
+		ReplacedAt:   time.Now().UTC(),
+	}
+	name := info.Name()
+	s.index[name] = append(s.index[name], v)
+	return &v, nil
+}
+
+// prune removes the oldest versions of each file beyond max_versions, then
+// the oldest versions overall while they exceed versions_max_size_mb. It
+// reports whether anything was removed. The caller must hold s.mu.
+func (s *Store) prune() bool {
+	cfg := s.config.Get()
+	pruned := false
+
+	for name, list := range s.index {
+		for len(list) > cfg.MaxVersions {
+			s.remove(list[0].ID)
+			list = list[1:]
+			pruned = true
+		}
+		if len(list) == 0 {
+			delete(s.index, name)
+		} else {
+			s.index[name] = list
+		}
+	}
+
+	maxSize := cfg.VersionsMaxSize()
+	if maxSize <= 0 {
+		return pruned
+	}
+
+	type entry struct {
+		name string
+		v    models.FileVersion
+	}
+	var all []entry
+	var total int64
+	for name, list := range s.index {
+		for _, v := range list {
+			all = append(all, entry{name, v})
+			total += v.Size
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].v.ReplacedAt.Before(all[j].v.ReplacedAt)
+	})
+	for _, e := range all {
+		if total <= maxSize {
+			break
+		}
+		s.remove(e.v.ID)
+		s.drop(e.name, e.v.ID)
+		total -= e.v.Size
+		pruned = true
+	}
+	return pruned
+}
+
+// find looks up a version of the named file. The caller must hold s.mu.
+func (s *Store) find(name, id string) (models.FileVersion, bool) {
+	for _, v := range s.index[name] {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return models.FileVersion{}, false
+}
+
+// drop forgets a version without touching its content. The caller must hold s.mu.
+func (s *Store) drop(name, id string) {
+	list := s.index[name]
+	for i, v := range list {
+		if v.ID == id {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(s.index, name)
+	} else {
+		s.index[name] = list
+	}
+}
+
+// remove deletes a version's content
+func (s *Store) remove(id string) {
+	os.Remove(filepath.Join(s.dir, id))
+}
+
+// save writes the index atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFileAtomic(filepath.Join(s.dir, indexFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to save version index: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random identifier for a version
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
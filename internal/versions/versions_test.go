@@ -0,0 +1,279 @@
+package versions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OderoCeasar/localshare/internal/config"
+	"github.com/OderoCeasar/localshare/pkg/fileutil"
+)
+
+// testStore is a version store over a fresh upload directory
+type testStore struct {
+	*Store
+	config    *config.Store
+	uploadDir string
+}
+
+func newTestStore(t *testing.T, maxVersions int, maxSizeMB int64) *testStore {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	cfg.MaxVersions = maxVersions
+	cfg.VersionsMaxSizeMB = maxSizeMB
+	store := config.NewStore(&cfg)
+
+	dir, err := fileutil.StateDir(cfg.UploadDir, "versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testStore{Store: s, config: store, uploadDir: cfg.UploadDir}
+}
+
+// upload replaces name with content, as a finished upload does
+func (ts *testStore) upload(t *testing.T, name, content string) {
+	t.Helper()
+	staged, err := os.CreateTemp(ts.uploadDir, ".staged-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged.WriteString(content)
+	staged.Close()
+	if err := ts.Replace(staged.Name(), filepath.Join(ts.uploadDir, name)); err != nil {
+		t.Fatalf("Replace(%s): %v", name, err)
+	}
+}
+
+// contents returns the content of every kept version of name, newest first
+func (ts *testStore) contents(t *testing.T, name string) []string {
+	t.Helper()
+	var out []string
+	for _, v := range ts.List(name) {
+		path, _, err := ts.Path(name, v.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxVersions  int
+		uploads      []string
+		wantCurrent  string
+		wantVersions []string
+	}{
+		{name: "new file", maxVersions: 5, uploads: []string{"v1"}, wantCurrent: "v1"},
+		{name: "overwrites kept", maxVersions: 5, uploads: []string{"v1", "v2", "v3"}, wantCurrent: "v3", wantVersions: []string{"v2", "v1"}},
+		{name: "oldest pruned", maxVersions: 2, uploads: []string{"v1", "v2", "v3", "v4"}, wantCurrent: "v4", wantVersions: []string{"v3", "v2"}},
+		{name: "versioning disabled", maxVersions: 0, uploads: []string{"v1", "v2"}, wantCurrent: "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestStore(t, tt.maxVersions, 0)
+			for _, content := range tt.uploads {
+				ts.upload(t, "a.txt", content)
+			}
+
+			data, err := os.ReadFile(filepath.Join(ts.uploadDir, "a.txt"))
+			if err != nil || string(data) != tt.wantCurrent {
+				t.Errorf("a.txt = %q, %v; want %q", data, err, tt.wantCurrent)
+			}
+			if got := ts.contents(t, "a.txt"); !equal(got, tt.wantVersions) {
+				t.Errorf("versions = %v, want %v", got, tt.wantVersions)
+			}
+
+			// Pruned versions leave no content behind
+			entries, _ := os.ReadDir(ts.dir)
+			files := 0
+			for _, e := range entries {
+				if e.Name() != indexFile {
+					files++
+				}
+			}
+			if files != len(tt.wantVersions) {
+				t.Errorf("version directory holds %d files, want %d", files, len(tt.wantVersions))
+			}
+		})
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	const kb = 1024
+	ts := newTestStore(t, 5, 1)
+
+	big := string(make([]byte, 400*kb))
+	ts.upload(t, "a.txt", "a1"+big)
+	ts.upload(t, "b.txt", "b1"+big)
+	ts.upload(t, "a.txt", "a2")
+	ts.upload(t, "b.txt", "b2")
+	ts.upload(t, "a.txt", "a3"+big)
+	ts.upload(t, "a.txt", "a4")
+
+	// The kept versions were a1, b1 and a3, 1200 KB together, so the
+	// oldest across all files goes
+	if got := len(ts.List("a.txt")); got != 2 {
+		t.Errorf("a.txt has %d versions, want 2", got)
+	}
+	if got := len(ts.List("b.txt")); got != 1 {
+		t.Errorf("b.txt has %d versions, want 1", got)
+	}
+	if got := ts.contents(t, "a.txt"); len(got) == 2 && got[1][:2] != "a2" {
+		t.Errorf("oldest kept version of a.txt starts %q, want a2", got[1][:2])
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ts := newTestStore(t, 5, 0)
+	ts.upload(t, "a.txt", "v1")
+	ts.upload(t, "a.txt", "v2")
+	dst := filepath.Join(ts.uploadDir, "a.txt")
+
+	v1 := ts.List("a.txt")[0]
+	if _, err := ts.Restore(dst, v1.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "v1" {
+		t.Errorf("a.txt = %q, want v1", data)
+	}
+	// The content it replaced is kept in turn
+	if got := ts.contents(t, "a.txt"); !equal(got, []string{"v2"}) {
+		t.Errorf("versions = %v, want [v2]", got)
+	}
+
+	if _, err := ts.Restore(dst, v1.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restoring a restored version: error = %v, want ErrNotFound", err)
+	}
+	if _, _, err := ts.Path("b.txt", v1.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Path of another file's version: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreFailure(t *testing.T) {
+	ts := newTestStore(t, 5, 0)
+	ts.upload(t, "a.txt", "v1")
+	ts.upload(t, "a.txt", "v2")
+	dst := filepath.Join(ts.uploadDir, "a.txt")
+
+	// A version whose content has gone missing cannot be restored
+	v1 := ts.List("a.txt")[0]
+	path, _, err := ts.Path("a.txt", v1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+
+	if _, err := ts.Restore(dst, v1.ID); err == nil {
+		t.Fatal("Restore succeeded without the version's content")
+	}
+	// The current content stays in place and is not kept as a version
+	if data, _ := os.ReadFile(dst); string(data) != "v2" {
+		t.Errorf("a.txt = %q after a failed restore, want v2", data)
+	}
+	if got := ts.List("a.txt"); len(got) != 1 || got[0].ID != v1.ID {
+		t.Errorf("versions = %+v after a failed restore, want only %s", got, v1.ID)
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxVersions int
+		// target holds uploads made to new.txt before the rename
+		target  []string
+		wantOld []string
+		wantNew []string
+	}{
+		{name: "versions follow the file", maxVersions: 5, wantNew: []string{"o2", "o1"}},
+		{
+			name:        "merged with the target's versions",
+			maxVersions: 5,
+			target:      []string{"n1", "n2"},
+			wantNew:     []string{"o2", "o1", "n1"},
+		},
+		{
+			name:        "merged within the limit",
+			maxVersions: 2,
+			target:      []string{"n1", "n2"},
+			wantNew:     []string{"o2", "o1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestStore(t, tt.maxVersions, 0)
+			for _, content := range tt.target {
+				ts.upload(t, "new.txt", content)
+			}
+			for _, content := range []string{"o1", "o2", "o3"} {
+				ts.upload(t, "old.txt", content)
+			}
+
+			if err := ts.Rename("old.txt", "new.txt"); err != nil {
+				t.Fatalf("Rename: %v", err)
+			}
+			if got := ts.contents(t, "old.txt"); !equal(got, tt.wantOld) {
+				t.Errorf("old.txt versions = %v, want %v", got, tt.wantOld)
+			}
+			if got := ts.contents(t, "new.txt"); !equal(got, tt.wantNew) {
+				t.Errorf("new.txt versions = %v, want %v", got, tt.wantNew)
+			}
+
+			// The index must survive a restart
+			reopened, err := Open(ts.config, ts.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(reopened.List("new.txt")); got != len(tt.wantNew) {
+				t.Errorf("reopened store has %d versions of new.txt, want %d", got, len(tt.wantNew))
+			}
+		})
+	}
+}
+
+func TestReplaceFolder(t *testing.T) {
+	ts := newTestStore(t, 5, 0)
+	if err := os.Mkdir(filepath.Join(ts.uploadDir, "site"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	staged := filepath.Join(ts.uploadDir, ".staged")
+	if err := os.WriteFile(staged, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.Replace(staged, filepath.Join(ts.uploadDir, "site")); !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Replace over a folder: error = %v, want ErrIsDir", err)
+	}
+	if info, err := os.Stat(filepath.Join(ts.uploadDir, "site")); err != nil || !info.IsDir() {
+		t.Errorf("site is no longer a folder: %v", err)
+	}
+	if n := len(ts.List("site")); n != 0 {
+		t.Errorf("site has %d versions, want none", n)
+	}
+}
@@ -0,0 +1,183 @@
+package webui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// indexFile is served for the root and for client-side routes
+const indexFile = "index.html"
+
+// encodings lists the precompressed variants in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Handler serves a built single-page frontend. Requests for files that do
+// not exist fall back to index.html so client-side routes work on reload.
+// When a client accepts it, a precompressed .br or .gz variant is sent in
+// place of the original file.
+type Handler struct {
+	fsys fs.FS
+
+	// immutable marks an embedded build, whose content can never change
+	// while the server runs, so entity tags are computed once and cached
+	immutable bool
+	etags     sync.Map
+}
+
+// New creates a handler serving fsys. Set immutable for embedded builds.
+func New(fsys fs.FS, immutable bool) *Handler {
+	return &Handler{
+		fsys:      fsys,
+		immutable: immutable,
+	}
+}
+
+// Available reports whether the frontend's index.html is present
+func (h *Handler) Available() bool {
+	_, err := fs.Stat(h.fsys, indexFile)
+	return err == nil
+}
+
+// ServeHTTP serves the requested file, or index.html if there is none
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || !h.isFile(name) {
+		// Missing hashed assets are real 404s; anything else is a client route
+		if strings.HasPrefix(name, "assets/") {
+			http.NotFound(w, r)
+			return
+		}
+		name = indexFile
+	}
+
+	if !h.isFile(name) {
+		http.Error(w, "Frontend not built: run `npm run build && go generate` in web/ or start with --web-dir", http.StatusNotFound)
+		return
+	}
+
+	h.serveFile(w, r, name)
+}
+
+// serveFile writes name, or its best precompressed variant, with caching headers
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	header := w.Header()
+
+	// Vite fingerprints everything under assets/, so a URL's content never
+	// changes; other files keep their URL across builds and must be revalidated
+	if strings.HasPrefix(name, "assets/") {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+
+	served := name
+	header.Set("Vary", "Accept-Encoding")
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, enc := range encodings {
+		if acceptsEncoding(accepted, enc.name) && h.isFile(name+enc.ext) {
+			served = name + enc.ext
+			header.Set("Content-Encoding", enc.name)
+			break
+		}
+	}
+
+	f, err := h.fsys.Open(served)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if etag := h.etag(served, content); etag != "" {
+		header.Set("ETag", etag)
+	}
+
+	// Range requests against a compressed body would address the wrong bytes
+	if served != name {
+		r.Header.Del("Range")
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns a cached content hash for embedded files. Files served from
+// disk rely on their modification time instead.
+func (h *Handler) etag(name string, content io.ReadSeeker) string {
+	if !h.immutable {
+		return ""
+	}
+	if etag, ok := h.etags.Load(name); ok {
+		return etag.(string)
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, content); err != nil {
+		return ""
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+
+	etag := `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+	h.etags.Store(name, etag)
+	return etag
+}
+
+// isFile reports whether name exists and is a regular file
+func (h *Handler) isFile(name string) bool {
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		// An explicit q=0 means "not acceptable"
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		perm     os.FileMode
+	}{
+		{name: "new file", perm: 0600},
+		{name: "replaces a file", existing: "old content that is longer", perm: 0644},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "index.json")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := WriteFileAtomic(path, []byte("{}"), tt.perm); err != nil {
+				t.Fatalf("WriteFileAtomic: %v", err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != "{}" {
+				t.Errorf("content = %q, want {}", data)
+			}
+			if info, _ := os.Stat(path); info.Mode().Perm() != tt.perm {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), tt.perm)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("directory holds %d entries, want only the file", len(entries))
+			}
+		})
+	}
+
+	// A missing directory fails without creating anything
+	if err := WriteFileAtomic(filepath.Join(t.TempDir(), "missing", "index.json"), nil, 0600); err == nil {
+		t.Error("WriteFileAtomic into a missing directory succeeded")
+	}
+}
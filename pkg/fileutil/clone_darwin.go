@@ -0,0 +1,20 @@
+//go:build darwin
+
+package fileutil
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// Clone creates dst as a copy-on-write clone of src, sharing its content
+// on disk until either file is changed. dst must not exist. Filesystems
+// without clones, such as HFS+, return ErrCloneUnsupported.
+func Clone(src, dst string) error {
+	err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EXDEV) {
+		return ErrCloneUnsupported
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package fileutil
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Clone creates dst as a copy-on-write clone of src (a reflink), sharing
+// its content on disk until either file is changed. dst must not exist.
+// Filesystems without clones, such as ext4, return ErrCloneUnsupported.
+func Clone(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		os.Remove(dst)
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) ||
+			errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EXDEV) {
+			return ErrCloneUnsupported
+		}
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package fileutil
+
+// Clone is not supported on this platform
+func Clone(src, dst string) error {
+	return ErrCloneUnsupported
+}
@@ -0,0 +1,9 @@
+package fileutil
+
+// DiskUsage describes the filesystem holding a directory
+type DiskUsage struct {
+	// Free is the space available to unprivileged users, in bytes
+	Free uint64
+	// Total is the size of the filesystem, in bytes
+	Total uint64
+}
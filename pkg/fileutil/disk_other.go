@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package fileutil
+
+import "errors"
+
+// GetDiskUsage is not supported on this platform
+func GetDiskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.New("disk usage is not supported on this platform")
+}
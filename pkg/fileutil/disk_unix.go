@@ -0,0 +1,17 @@
+//go:build unix
+
+package fileutil
+
+import "golang.org/x/sys/unix"
+
+// GetDiskUsage reports the free and total space of the filesystem holding path
+func GetDiskUsage(path string) (DiskUsage, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Free:  uint64(st.Bavail) * uint64(st.Bsize),
+		Total: uint64(st.Blocks) * uint64(st.Bsize),
+	}, nil
+}
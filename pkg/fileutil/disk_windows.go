@@ -0,0 +1,22 @@
+//go:build windows
+
+package fileutil
+
+import "golang.org/x/sys/windows"
+
+// GetDiskUsage reports the free and total space of the volume holding path
+func GetDiskUsage(path string) (DiskUsage, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+
+	var free, total uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, nil); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Free:  free,
+		Total: total,
+	}, nil
+}
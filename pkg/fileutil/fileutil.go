@@ -3,6 +3,7 @@ package fileutil
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,6 +14,13 @@ import (
 // ErrInvalidPath is returned when a path contains invalid characters
 var ErrInvalidPath = errors.New("invalid file path")
 
+// ErrCloneUnsupported is returned where files cannot be cloned
+var ErrCloneUnsupported = errors.New("file clones are not supported")
+
+// StateDirName is the hidden directory inside the upload directory where
+// LocalShare keeps its own bookkeeping. It is never listed or served.
+const StateDirName = ".localshare"
+
 // SanitizeFilename removes
 func SanitizeFilename(filename string) (string, error) {
 
@@ -28,6 +36,11 @@ func SanitizeFilename(filename string) (string, error) {
 		return "", ErrInvalidPath
 	}
 
+	// Reserve the internal state directory
+	if base == StateDirName {
+		return "", ErrInvalidPath
+	}
+
 	return base, nil
 }
 
@@ -40,6 +53,10 @@ func ListFiles(dirPath string) ([]models.FileInfo, error) {
 
 	files := make([]models.FileInfo, 0, len(entries))
 	for _, entry := range entries {
+		if entry.Name() == StateDirName {
+			continue
+		}
+
 		info, err := entry.Info()
 		if err != nil {
 			// Skip files we can't read
@@ -57,6 +74,62 @@ func ListFiles(dirPath string) ([]models.FileInfo, error) {
 	return files, nil
 }
 
+// TotalSize returns the total size of the files in dirPath and its
+// subdirectories, leaving out the internal state directory apart from the
+// named subdirectories of it in include. Content hard-linked in several
+// places counts once.
+func TotalSize(dirPath string, include ...string) (int64, error) {
+	var total int64
+	seen := make(map[fileID]bool)
+
+	walk := func(root string) error {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				// Skip files we can't read
+				return nil
+			}
+			if d.IsDir() {
+				if path == filepath.Join(dirPath, StateDirName) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			// Hard links to the same content take up its space once
+			if id, ok := linkedID(path, info); ok {
+				if seen[id] {
+					return nil
+				}
+				seen[id] = true
+			}
+			total += info.Size()
+			return nil
+		})
+	}
+
+	if err := walk(dirPath); err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, name := range include {
+		err := walk(filepath.Join(dirPath, StateDirName, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to read directory: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// fileID identifies content on disk, which all hard links to it share
+type fileID struct {
+	dev, ino uint64
+}
+
 // EnsureDir creates a directory if it doesn't exist
 func EnsureDir(dirPath string) error {
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
@@ -82,11 +155,34 @@ func DeleteFile(filePath string) error {
 	return nil
 }
 
-// GetFilePath safely joins the directory and filename
-func GetFilePath(dir, filename string) (string, error) {
-	sanitized, err := SanitizeFilename(filename)
-	if err != nil {
+// StateDir returns the path of a named subdirectory of the internal state
+// directory, creating it if necessary
+func StateDir(uploadDir, name string) (string, error) {
+	dir := filepath.Join(uploadDir, StateDirName, name)
+	if err := EnsureDir(dir); err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, sanitized), nil
+	return dir, nil
+}
+
+// GetFilePath safely joins the directory and filename. A slash-separated
+// path names a file inside a folder, such as an extracted archive, and
+// each of its elements must be a plain file name.
+func GetFilePath(dir, filename string) (string, error) {
+	if !strings.Contains(filename, "/") {
+		sanitized, err := SanitizeFilename(filename)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, sanitized), nil
+	}
+
+	parts := strings.Split(filename, "/")
+	for _, part := range parts {
+		sanitized, err := SanitizeFilename(part)
+		if err != nil || sanitized != part {
+			return "", ErrInvalidPath
+		}
+	}
+	return filepath.Join(dir, filepath.Join(parts...)), nil
 }
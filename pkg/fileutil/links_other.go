@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package fileutil
+
+import "os"
+
+// linkedID is not supported on this platform, so every link counts as a copy
+func linkedID(path string, info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkedID returns the identity of the file described by info if it has
+// more than one hard link, so the links can be told apart from copies
+func linkedID(path string, info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// linkedID returns the identity of the file at path if it has more than
+// one hard link, so the links can be told apart from copies
+func linkedID(path string, info os.FileInfo) (fileID, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	defer f.Close()
+
+	var d windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &d); err != nil || d.NumberOfLinks < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(d.VolumeSerialNumber), ino: uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)}, true
+}
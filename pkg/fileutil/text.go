@@ -0,0 +1,25 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// textExtensions are the plain-text, Markdown and source file extensions
+var textExtensions = map[string]bool{
+	".txt": true, ".text": true, ".log": true, ".csv": true, ".tsv": true,
+	".md": true, ".markdown": true, ".rst": true, ".adoc": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true, ".xml": true,
+	".html": true, ".htm": true, ".css": true, ".scss": true,
+	".go": true, ".py": true, ".rb": true, ".rs": true, ".java": true, ".kt": true, ".swift": true,
+	".c": true, ".h": true, ".cpp": true, ".hpp": true, ".cc": true, ".cs": true,
+	".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".vue": true, ".svelte": true,
+	".php": true, ".pl": true, ".lua": true, ".sh": true, ".bash": true, ".zsh": true, ".ps1": true,
+	".sql": true, ".r": true, ".tex": true,
+}
+
+// IsText reports whether the named file is plain text, Markdown or source
+// code, judging by its extension
+func IsText(name string) bool {
+	return textExtensions[strings.ToLower(filepath.Ext(name))]
+}
@@ -0,0 +1,114 @@
+// Command compress writes gzip and brotli variants next to each compressible
+// file in a frontend build so the server can send them without compressing
+// on every request.
+//
+// Usage:
+//
+//	go run ./compress <dir>
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minSize is the smallest file worth compressing
+const minSize = 1024
+
+// compressible lists the extensions of text formats that shrink well
+var compressible = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".mjs":  true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+	".xml":  true,
+	".map":  true,
+	".wasm": true,
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: compress <dir>")
+		os.Exit(2)
+	}
+
+	var files, written int
+	err := filepath.WalkDir(os.Args[1], func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !compressible[strings.ToLower(filepath.Ext(path))] {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if len(data) < minSize {
+			return nil
+		}
+		files++
+
+		gz, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+		br, err := brotliBytes(data)
+		if err != nil {
+			return err
+		}
+
+		// A variant that isn't smaller would only cost bandwidth
+		for ext, variant := range map[string][]byte{".gz": gz, ".br": br} {
+			if len(variant) >= len(data) {
+				continue
+			}
+			if err := os.WriteFile(path+ext, variant, 0644); err != nil {
+				return err
+			}
+			written++
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "compress:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("compressed %d files into %d variants\n", files, written)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func brotliBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,26 @@
+// Package web embeds the built frontend into the LocalShare binary.
+//
+// Build the frontend and its precompressed variants before building the
+// binary:
+//
+//	cd web && npm run build && go generate
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:generate go run ./compress dist
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the embedded frontend build, rooted at the dist directory
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
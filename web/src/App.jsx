@@ -1,9 +1,11 @@
 import { useState, useEffect } from 'react';
-import { Upload, Download, Trash2, Lock, LogIn, LogOut, AlertCircle, CheckCircle, Loader2, FileText, RefreshCw } from 'lucide-react';
+import { Upload, Download, Trash2, Lock, LogIn, LogOut, AlertCircle, CheckCircle, Loader2, FileText, RefreshCw, Eye, Folder, ArrowLeft } from 'lucide-react';
 
 export default function App() {
   const [config, setConfig] = useState(null);
   const [files, setFiles] = useState([]);
+  // The folder being browsed, such as an extracted archive; empty for the top level
+  const [folder, setFolder] = useState('');
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
   const [success, setSuccess] = useState('');
@@ -18,9 +20,13 @@ export default function App() {
   
   // Upload state
   const [selectedFile, setSelectedFile] = useState(null);
+  const [extract, setExtract] = useState(false);
   const [uploading, setUploading] = useState(false);
   const [refreshing, setRefreshing] = useState(false);
 
+  // Text preview state
+  const [textPreview, setTextPreview] = useState(null);
+
   const API_BASE = '/api';
 
   useEffect(() => {
@@ -31,7 +37,17 @@ export default function App() {
     if (!config) return;
     if (config.pinProtected && !pinVerified) return;
     fetchFiles();
-  }, [config, pinVerified]);
+  }, [config, pinVerified, folder]);
+
+  // Refresh the list when files change, here or on another device
+  useEffect(() => {
+    if (!config) return;
+    if (config.pinProtected && !pinVerified) return;
+    const source = new EventSource(`${API_BASE}/events`, { withCredentials: true });
+    const refresh = () => fetchFiles();
+    ['added', 'removed', 'renamed', 'modified'].forEach((type) => source.addEventListener(type, refresh));
+    return () => source.close();
+  }, [config, pinVerified, folder]);
 
   // Auto-clear messages after 5 seconds
   useEffect(() => {
@@ -63,7 +79,8 @@ export default function App() {
   const fetchFiles = async () => {
     setRefreshing(true);
     try {
-      const res = await fetch(`${API_BASE}/files`, {
+      const query = folder ? `?path=${encodeURIComponent(folder)}` : '';
+      const res = await fetch(`${API_BASE}/files${query}`, {
         credentials: 'include'
       });
       
@@ -71,6 +88,11 @@ export default function App() {
         setPinVerified(false);
         return;
       }
+      if (res.status === 404 && folder) {
+        // The folder was deleted while open
+        setFolder('');
+        return;
+      }
       
       const data = await res.json();
       setFiles(data.files || []);
@@ -172,6 +194,9 @@ export default function App() {
     setSuccess('');
     
     const formData = new FormData();
+    if (extract && isArchive(selectedFile.name)) {
+      formData.append('extract', 'true');
+    }
     formData.append('file', selectedFile);
     
     try {
@@ -185,8 +210,10 @@ export default function App() {
         setError('Admin authentication required');
         setShowAdminLogin(true);
       } else if (res.ok) {
-        setSuccess('File uploaded successfully');
+        const data = await res.json();
+        setSuccess(data.extracted ? `Extracted ${data.extracted.files} files into ${data.extracted.target}` : 'File uploaded successfully');
         setSelectedFile(null);
+        setExtract(false);
         document.getElementById('fileInput').value = '';
         fetchFiles();
       } else {
@@ -200,9 +227,14 @@ export default function App() {
     }
   };
 
+  // pathOf returns the path of a listed file, and urlPath the same with
+  // each element escaped for a URL
+  const pathOf = (name) => (folder ? `${folder}/${name}` : name);
+  const urlPath = (name) => pathOf(name).split('/').map(encodeURIComponent).join('/');
+
   const downloadFile = async (filename) => {
     try {
-      const res = await fetch(`${API_BASE}/files/download/${filename}`, {
+      const res = await fetch(`${API_BASE}/files/download/${urlPath(filename)}`, {
         credentials: 'include'
       });
       
@@ -225,6 +257,23 @@ export default function App() {
     }
   };
 
+  const previewText = async (filename) => {
+    try {
+      const res = await fetch(`${API_BASE}/files/text/${urlPath(filename)}`, {
+        credentials: 'include'
+      });
+      const data = await res.json();
+
+      if (res.ok) {
+        setTextPreview(data);
+      } else {
+        setError(data.error || 'Failed to preview file');
+      }
+    } catch (err) {
+      setError('Failed to preview file');
+    }
+  };
+
   const deleteFile = async (filename) => {
     if (!confirm(`Delete ${filename}?`)) return;
     
@@ -261,6 +310,14 @@ export default function App() {
     return date.toLocaleDateString() + ' ' + date.toLocaleTimeString();
   };
 
+  const isArchive = (filename) => /\.(zip|tar|tar\.gz|tgz)$/i.test(filename);
+
+  const hasThumbnail = (filename) => /\.(jpe?g|png|gif)$/i.test(filename);
+
+  // Images and PDFs open in the browser; everything else is shown as text
+  // if the server finds it to be text
+  const canPreview = (filename) => /\.(jpe?g|png|gif|webp|avif|bmp|pdf)$/i.test(filename);
+
   const handlePinKeyPress = (e) => {
     if (e.key === 'Enter') {
       verifyPIN();
@@ -439,6 +496,48 @@ export default function App() {
           </div>
         )}
 
+        {/* Text Preview Modal */}
+        {textPreview && (
+          <div
+            className="fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center p-4 z-50 animate-fade-in"
+            onClick={() => setTextPreview(null)}
+          >
+            <div
+              className="bg-white rounded-2xl p-6 w-full max-w-4xl max-h-[90vh] flex flex-col animate-slide-up"
+              onClick={(e) => e.stopPropagation()}
+            >
+              <div className="flex items-start justify-between gap-4 mb-4">
+                <div className="min-w-0">
+                  <h3 className="text-xl font-bold truncate">{textPreview.name}</h3>
+                  <p className="text-xs text-gray-500">
+                    {[textPreview.language, textPreview.encoding, `${textPreview.lines} lines`, formatBytes(textPreview.size)]
+                      .filter(Boolean)
+                      .join(' • ')}
+                    {textPreview.truncated && ` • showing the first ${textPreview.previewLines}`}
+                  </p>
+                </div>
+                <button
+                  onClick={() => setTextPreview(null)}
+                  className="bg-gray-200 text-gray-800 px-4 py-2 rounded-lg hover:bg-gray-300 transition"
+                >
+                  Close
+                </button>
+              </div>
+              {textPreview.html ? (
+                // Rendered and sanitized by the server
+                <div
+                  className="markdown overflow-auto"
+                  dangerouslySetInnerHTML={{ __html: textPreview.html }}
+                />
+              ) : (
+                <pre className="overflow-auto bg-gray-50 rounded-lg p-4 text-sm font-mono whitespace-pre">
+                  {textPreview.content}
+                </pre>
+              )}
+            </div>
+          </div>
+        )}
+
         {/* Upload Section */}
         <div className="bg-white rounded-2xl shadow-lg p-6 mb-6 animate-fade-in">
           <h2 className="text-xl font-bold mb-4 flex items-center gap-2">
@@ -479,6 +578,16 @@ export default function App() {
                 <p className="text-sm font-medium text-gray-900">{selectedFile.name}</p>
                 <p className="text-xs text-gray-600">{formatBytes(selectedFile.size)}</p>
               </div>
+              {isArchive(selectedFile.name) && (
+                <label className="flex items-center gap-2 text-sm text-gray-700">
+                  <input
+                    type="checkbox"
+                    checked={extract}
+                    onChange={(e) => setExtract(e.target.checked)}
+                  />
+                  Extract into a folder
+                </label>
+              )}
             </div>
           )}
         </div>
@@ -486,7 +595,18 @@ export default function App() {
         {/* Files List */}
         <div className="bg-white rounded-2xl shadow-lg p-6 animate-fade-in">
           <div className="flex items-center justify-between mb-4">
-            <h2 className="text-xl font-bold">Files ({files.length})</h2>
+            <div className="flex items-center gap-2 min-w-0">
+              {folder && (
+                <button
+                  onClick={() => setFolder(folder.includes('/') ? folder.slice(0, folder.lastIndexOf('/')) : '')}
+                  className="p-1 text-gray-600 hover:bg-gray-100 rounded-lg transition"
+                  title="Back"
+                >
+                  <ArrowLeft className="w-5 h-5" />
+                </button>
+              )}
+              <h2 className="text-xl font-bold truncate">{folder || 'Files'} ({files.length})</h2>
+            </div>
             <button
               onClick={fetchFiles}
               disabled={refreshing}
@@ -514,8 +634,28 @@ export default function App() {
                 >
                   <div className="flex-1 min-w-0">
                     <div className="flex items-center gap-2 mb-1">
-                      <FileText className="w-4 h-4 text-gray-400 flex-shrink-0" />
-                      <p className="font-medium text-gray-900 truncate">{file.name}</p>
+                      {file.isDir ? (
+                        <Folder className="w-4 h-4 text-blue-500 flex-shrink-0" />
+                      ) : hasThumbnail(file.name) ? (
+                        <img
+                          src={`${API_BASE}/files/thumbnail/${urlPath(file.name)}?size=64`}
+                          alt=""
+                          loading="lazy"
+                          className="w-8 h-8 rounded object-cover flex-shrink-0"
+                        />
+                      ) : (
+                        <FileText className="w-4 h-4 text-gray-400 flex-shrink-0" />
+                      )}
+                      {file.isDir ? (
+                        <button
+                          onClick={() => setFolder(pathOf(file.name))}
+                          className="font-medium text-blue-600 hover:underline truncate"
+                        >
+                          {file.name}
+                        </button>
+                      ) : (
+                        <p className="font-medium text-gray-900 truncate">{file.name}</p>
+                      )}
                     </div>
                     <div className="flex items-center gap-3 text-xs text-gray-500">
                       <span>{formatBytes(file.size)}</span>
@@ -525,20 +665,44 @@ export default function App() {
                   </div>
                   
                   <div className="flex gap-2 ml-4">
-                    <button
-                      onClick={() => downloadFile(file.name)}
-                      className="p-2 text-blue-600 hover:bg-blue-50 rounded-lg transition"
-                      title="Download"
-                    >
-                      <Download className="w-5 h-5" />
-                    </button>
-                    <button
-                      onClick={() => deleteFile(file.name)}
-                      className="p-2 text-red-600 hover:bg-red-50 rounded-lg transition opacity-0 group-hover:opacity-100"
-                      title="Delete"
-                    >
-                      <Trash2 className="w-5 h-5" />
-                    </button>
+                    {file.isDir ? null : canPreview(file.name) ? (
+                      <a
+                        href={`${API_BASE}/files/preview/${urlPath(file.name)}`}
+                        target="_blank"
+                        rel="noopener noreferrer"
+                        className="p-2 text-gray-600 hover:bg-gray-100 rounded-lg transition"
+                        title="Preview"
+                      >
+                        <Eye className="w-5 h-5" />
+                      </a>
+                    ) : (
+                      <button
+                        onClick={() => previewText(file.name)}
+                        className="p-2 text-gray-600 hover:bg-gray-100 rounded-lg transition"
+                        title="Preview"
+                      >
+                        <Eye className="w-5 h-5" />
+                      </button>
+                    )}
+                    {!file.isDir && (
+                      <button
+                        onClick={() => downloadFile(file.name)}
+                        className="p-2 text-blue-600 hover:bg-blue-50 rounded-lg transition"
+                        title="Download"
+                      >
+                        <Download className="w-5 h-5" />
+                      </button>
+                    )}
+                    {/* Folders are deleted as a whole, from the top level */}
+                    {!folder && (
+                      <button
+                        onClick={() => deleteFile(file.name)}
+                        className="p-2 text-red-600 hover:bg-red-50 rounded-lg transition opacity-0 group-hover:opacity-100"
+                        title="Delete"
+                      >
+                        <Trash2 className="w-5 h-5" />
+                      </button>
+                    )}
                   </div>
                 </div>
               ))}